@@ -5,6 +5,9 @@ IMAGE_NAME="go_build"
 CONTAINER_NAME="go_build_for_bbb"
 DOCKER_HUB="harrisonchen0418"
 GIT_COMMIT=$(git rev-parse --short HEAD 2>/dev/null || echo "nogit")
+VERSION=$(git describe --tags --always --dirty 2>/dev/null || echo "dev")
+BUILDINFO="github.com/HarrisonZz/web_server_in_go/internal/buildinfo"
+LDFLAGS="-X $BUILDINFO.Version=$VERSION -X $BUILDINFO.Commit=$GIT_COMMIT"
 
 function build_bin() {
   echo "[*] Building ARMv7 binary only..."
@@ -17,11 +20,12 @@ function build_bin() {
     -v "$PWD:/src" \
     -w /src \
     --name "$CONTAINER_NAME" \
+    -e LDFLAGS="$LDFLAGS" \
     "$IMAGE_NAME" \
     bash -c '
       echo "[*] Running go build..."
       go mod tidy
-      GOOS=linux GOARCH=arm GOARM=7 go build -buildvcs=false -o out/app-bbb.bin .
+      GOOS=linux GOARCH=arm GOARM=7 go build -buildvcs=false -ldflags "$LDFLAGS" -o out/app-bbb.bin .
     '
 
   echo "[✔] Binary built successfully: ./out/app-bbb.bin"
@@ -0,0 +1,240 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/handler"
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	"github.com/HarrisonZz/web_server_in_go/internal/util"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 結果
+const (
+	ResultOK    = "ok"
+	ResultError = "error"
+)
+
+// actor 的來源；server 沒有驗證身分，header 與 Basic Auth 的使用者名稱都只是 client 自己宣稱的值
+const (
+	ActorHeaderClaim    = "header_claim"     // AUDIT_IDENTITY_HEADER，未驗證
+	ActorBasicAuthClaim = "basic_auth_claim" // Basic Auth 使用者名稱，未檢查密碼
+	ActorAnonymous      = "anonymous"
+	ActorSystem         = "system" // 排程、reconcile、MQTT 等非 HTTP 來源，actor 為 Source
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+
+	queueSize    = 1024 // 等待寫入 store 的紀錄上限
+	writeTimeout = 2 * time.Second
+)
+
+// Entry 是一筆裝置變更紀錄；Old / New 為變更前後的值（JSON）
+type Entry struct {
+	ID          string    `json:"id,omitempty"`
+	Time        time.Time `json:"time"`
+	Actor       string    `json:"actor"`        // HTTP 請求時是 client 宣稱的身分，不可當作已驗證的使用者
+	ActorSource string    `json:"actor_source"` // 見 Actor* 常數
+	ClientIP    string    `json:"client_ip,omitempty"`
+	TraceID     string    `json:"trace_id,omitempty"`
+	Source      string    `json:"source"`
+	Device      string    `json:"device"`
+	Operation   string    `json:"operation"`
+	Target      string    `json:"target,omitempty"`
+	Old         any       `json:"old,omitempty"`
+	New         any       `json:"new,omitempty"`
+	Result      string    `json:"result"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Filter 是 GET /audit 的查詢條件，空值表示不限制
+type Filter struct {
+	Device    string
+	Operation string
+	Since     time.Time
+	Limit     int
+}
+
+func (f Filter) match(e Entry) bool {
+	return (f.Device == "" || e.Device == f.Device) &&
+		(f.Operation == "" || e.Operation == f.Operation) &&
+		!e.Time.Before(f.Since)
+}
+
+// Store 是只能附加的紀錄儲存；Query 依時間排序回傳最新的 Limit 筆
+type Store interface {
+	Append(ctx context.Context, e Entry) error
+	Query(ctx context.Context, f Filter) ([]Entry, error)
+	Close() error
+}
+
+var (
+	store Store
+
+	// Record 只把紀錄放進 queue，由 writer 寫入 store；
+	// 呼叫端常持有裝置的 lock，store 變慢（Redis 來回、檔案輪替）不能卡住裝置操作
+	queueMu    sync.RWMutex
+	queue      chan Entry
+	writerDone chan struct{}
+)
+
+// Init 設定 store、啟動背景 writer 並註冊 GET /audit
+func Init(s Store) {
+	store = s
+	queue = make(chan Entry, queueSize)
+	writerDone = make(chan struct{})
+	go writer(s, queue, writerDone)
+	handler.RegisterRoute(http.MethodGet, "/audit", queryAudit)
+}
+
+// Close 等 queue 中的紀錄寫完後關閉 store，之後的 Record 只寫 log
+func Close() error {
+	queueMu.Lock()
+	q := queue
+	queue = nil
+	queueMu.Unlock()
+	if q == nil {
+		return nil
+	}
+	close(q)
+	<-writerDone
+	return store.Close()
+}
+
+// writer 依序寫入 store；寫入失敗只記錄 log，不影響已經完成的變更
+func writer(s Store, q <-chan Entry, done chan<- struct{}) {
+	defer close(done)
+	for e := range q {
+		ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+		if err := s.Append(ctx, e); err != nil {
+			logger.Error(fmt.Sprintf("[AUDIT] append failed op=%s device=%s error=%v", e.Operation, e.Device, err))
+		}
+		cancel()
+	}
+}
+
+// Actor 是發出變更的一方，由 Middleware 從 request 取得；ID 未經驗證，Source 說明其來源
+type Actor struct {
+	ID     string
+	Source string // 見 Actor* 常數
+	IP     string
+}
+
+type actorKey struct{}
+
+func WithActor(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, a)
+}
+
+func ActorFrom(ctx context.Context) (Actor, bool) {
+	a, ok := ctx.Value(actorKey{}).(Actor)
+	return a, ok
+}
+
+var identityHeader = util.Getenv("AUDIT_IDENTITY_HEADER", "X-Client-ID")
+
+// Middleware 依 AUDIT_IDENTITY_HEADER、Basic Auth 使用者的順序取得 client 宣稱的身分，寫進 request context。
+// 兩者都由 client 提供、server 不驗證，紀錄中以 actor_source 標明是 claim
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a := Actor{ID: c.GetHeader(identityHeader), Source: ActorHeaderClaim, IP: c.ClientIP()}
+		if a.ID == "" {
+			if user, _, ok := c.Request.BasicAuth(); ok && user != "" {
+				a.ID, a.Source = user, ActorBasicAuthClaim
+			}
+		}
+		if a.ID == "" {
+			a.ID, a.Source = ActorAnonymous, ActorAnonymous
+		}
+		c.Request = c.Request.WithContext(WithActor(c.Request.Context(), a))
+		c.Next()
+	}
+}
+
+// Record 補上時間、actor 與 trace ID 後交給背景 writer，不會等待 store；
+// queue 滿了（store 長時間過慢）時把整筆紀錄寫進 error log，避免遺失
+func Record(ctx context.Context, e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if a, ok := ActorFrom(ctx); ok {
+		if e.Actor == "" {
+			e.Actor, e.ActorSource = a.ID, a.Source
+		}
+		if e.ClientIP == "" {
+			e.ClientIP = a.IP
+		}
+	}
+	// 沒有 HTTP client 的變更（排程、reconcile、MQTT）以來源作為 actor
+	if e.Actor == "" {
+		e.Actor, e.ActorSource = e.Source, ActorSystem
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		e.TraceID = sc.TraceID().String()
+	}
+	if e.Result == "" {
+		e.Result = ResultOK
+	}
+
+	queueMu.RLock()
+	defer queueMu.RUnlock()
+	if queue == nil {
+		return
+	}
+	select {
+	case queue <- e:
+	default:
+		b, _ := json.Marshal(e)
+		logger.Error(fmt.Sprintf("[AUDIT] queue full, entry not stored: %s", b))
+	}
+}
+
+// Result 依 err 回傳 (result, error message)，方便填入 Entry
+func Result(err error) (string, string) {
+	if err != nil {
+		return ResultError, err.Error()
+	}
+	return ResultOK, ""
+}
+
+func queryAudit(c *gin.Context) {
+	if store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "audit store not configured", "code": "audit_unavailable"})
+		return
+	}
+
+	since, err := util.ParseSince(c.Query("since"), time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_query"})
+		return
+	}
+	limit := defaultLimit
+	if v := c.Query("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxLimit), "code": "invalid_query"})
+			return
+		}
+	}
+
+	f := Filter{Device: c.Query("device"), Operation: c.Query("op"), Since: since, Limit: limit}
+	entries, err := store.Query(c.Request.Context(), f)
+	if err != nil {
+		logger.Error(fmt.Sprintf("[AUDIT] query failed error=%v from=%s", err, c.ClientIP()))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "audit_query_failed"})
+		return
+	}
+	if entries == nil {
+		entries = []Entry{}
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "count": len(entries)})
+}
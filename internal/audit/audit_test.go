@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// slowStore 模擬很慢的 store（Redis 延遲、檔案輪替）
+type slowStore struct {
+	delay time.Duration
+
+	mu      sync.Mutex
+	entries []Entry
+	closed  bool
+}
+
+func (s *slowStore) Append(_ context.Context, e Entry) error {
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+func (s *slowStore) Query(context.Context, Filter) ([]Entry, error) { return nil, nil }
+
+func (s *slowStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestRecordDoesNotWaitForStore(t *testing.T) {
+	s := &slowStore{delay: 200 * time.Millisecond}
+	Init(s)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		Record(context.Background(), Entry{Source: "test", Device: "led", Operation: "led.set"})
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Fatalf("Record blocked for %v", d)
+	}
+
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.entries) != 3 || !s.closed {
+		t.Fatalf("stored %d entries (closed=%t), want 3 and closed", len(s.entries), s.closed)
+	}
+	for _, e := range s.entries {
+		if e.Actor != "test" || e.Result != ResultOK || e.Time.IsZero() {
+			t.Fatalf("entry not filled in: %+v", e)
+		}
+	}
+
+	// Close 之後的 Record 不可 panic
+	Record(context.Background(), Entry{Source: "test"})
+}
+
+func TestMiddlewareLabelsClaims(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		header     string
+		basicUser  string
+		wantID     string
+		wantSource string
+	}{
+		{"header", "alice", "", "alice", ActorHeaderClaim},
+		{"header wins over basic auth", "alice", "bob", "alice", ActorHeaderClaim},
+		{"basic auth", "", "bob", "bob", ActorBasicAuthClaim},
+		{"anonymous", "", "", ActorAnonymous, ActorAnonymous},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Actor
+			r := gin.New()
+			r.Use(Middleware())
+			r.GET("/", func(c *gin.Context) { got, _ = ActorFrom(c.Request.Context()) })
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(identityHeader, tt.header)
+			}
+			if tt.basicUser != "" {
+				req.SetBasicAuth(tt.basicUser, "not-checked")
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got.ID != tt.wantID || got.Source != tt.wantSource {
+				t.Fatalf("actor = %+v, want id=%s source=%s", got, tt.wantID, tt.wantSource)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// fileStore 以 JSONL 附加寫入，超過 maxBytes 時輪替成 path.1 … path.N
+type fileStore struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	backups  int
+	f        *os.File
+	size     int64
+}
+
+func NewFileStore(path string, maxBytes int64, backups int) (Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	s := &fileStore{path: path, maxBytes: maxBytes, backups: backups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileStore) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.size = f, st.Size()
+	return nil
+}
+
+func (s *fileStore) Append(_ context.Context, e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.maxBytes > 0 && s.size > 0 && s.size+int64(len(b)) > s.maxBytes {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("rotate %s: %w", s.path, err)
+		}
+	}
+	n, err := s.f.Write(b)
+	s.size += int64(n)
+	return err
+}
+
+// rotate 將 path.i 改名為 path.i+1，最舊的一份被覆蓋
+func (s *fileStore) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	if s.backups <= 0 {
+		if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return s.open()
+	}
+	for i := s.backups - 1; i >= 1; i-- {
+		old := fmt.Sprintf("%s.%d", s.path, i)
+		if err := os.Rename(old, fmt.Sprintf("%s.%d", s.path, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(s.path, s.path+".1"); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+// Query 由最舊的輪替檔讀到目前的檔案，只保留符合條件的最後 Limit 筆；
+// 只在開檔時持有 lock，讀取與解碼期間 Append 不會被擋住
+func (s *fileStore) Query(_ context.Context, f Filter) ([]Entry, error) {
+	files, err := s.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, sf := range files {
+			sf.f.Close()
+		}
+	}()
+
+	var out []Entry
+	for _, sf := range files {
+		if err := scanEntries(io.LimitReader(sf.f, sf.size), func(e Entry) {
+			if !f.match(e) {
+				return
+			}
+			out = append(out, e)
+			if f.Limit > 0 && len(out) > f.Limit {
+				out = out[1:]
+			}
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+type snapshotFile struct {
+	f    *os.File
+	size int64
+}
+
+// snapshot 在 lock 內由舊到新開啟所有輪替檔並記下當下的大小；
+// 已開啟的檔案不受之後輪替的 rename 影響，之後附加的內容也不會讀到
+func (s *fileStore) snapshot() ([]snapshotFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, s.backups+1)
+	for i := s.backups; i >= 1; i-- {
+		names = append(names, fmt.Sprintf("%s.%d", s.path, i))
+	}
+	names = append(names, s.path)
+
+	files := make([]snapshotFile, 0, len(names))
+	for _, name := range names {
+		f, err := os.Open(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err == nil {
+			var st os.FileInfo
+			if st, err = f.Stat(); err == nil {
+				files = append(files, snapshotFile{f: f, size: st.Size()})
+				continue
+			}
+			f.Close()
+		}
+		for _, sf := range files {
+			sf.f.Close()
+		}
+		return nil, err
+	}
+	return files, nil
+}
+
+func scanEntries(r io.Reader, fn func(Entry)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e Entry
+		// 斷電留下的半行直接略過
+		if json.Unmarshal(sc.Bytes(), &e) != nil {
+			continue
+		}
+		fn(e)
+	}
+	return sc.Err()
+}
+
+func (s *fileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+// streamStore 寫入 Redis stream，以 MAXLEN ~ 限制長度
+type streamStore struct {
+	rdb    *redis.Client
+	key    string
+	maxLen int64
+}
+
+const streamPage = 500
+
+func NewStreamStore(rdb *redis.Client, key string, maxLen int64) Store {
+	return &streamStore{rdb: rdb, key: key, maxLen: maxLen}
+}
+
+func (s *streamStore) Append(ctx context.Context, e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.key,
+		MaxLen: s.maxLen,
+		Approx: true,
+		Values: map[string]any{"entry": b},
+	}).Err()
+}
+
+// Query 從最新的紀錄往回讀，直到湊滿 Limit 筆或早於 Since
+func (s *streamStore) Query(ctx context.Context, f Filter) ([]Entry, error) {
+	start := "-"
+	if !f.Since.IsZero() {
+		start = fmt.Sprintf("%d", f.Since.UnixMilli())
+	}
+
+	var out []Entry
+	end := "+"
+	for {
+		msgs, err := s.rdb.XRevRangeN(ctx, s.key, end, start, streamPage).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			raw, _ := m.Values["entry"].(string)
+			var e Entry
+			if json.Unmarshal([]byte(raw), &e) != nil {
+				continue
+			}
+			e.ID = m.ID
+			if f.match(e) {
+				out = append(out, e)
+			}
+			if f.Limit > 0 && len(out) == f.Limit {
+				slices.Reverse(out)
+				return out, nil
+			}
+		}
+		if len(msgs) < streamPage {
+			break
+		}
+		end = "(" + msgs[len(msgs)-1].ID
+	}
+	slices.Reverse(out)
+	return out, nil
+}
+
+func (s *streamStore) Close() error { return nil }
@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileStoreQueryAcrossRotation(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewFileStore(filepath.Join(t.TempDir(), "audit.jsonl"), 512, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		e := Entry{Time: base.Add(time.Duration(i) * time.Second), Device: "led", Operation: "led.set", Target: fmt.Sprint(i), Result: ResultOK}
+		if i%2 == 1 {
+			e.Device = "fan"
+		}
+		if err := s.Append(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := s.Query(ctx, Filter{Device: "led", Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var targets []string
+	for _, e := range got {
+		targets = append(targets, e.Target)
+	}
+	if fmt.Sprint(targets) != "[14 16 18]" {
+		t.Fatalf("targets = %v, want [14 16 18]", targets)
+	}
+}
+
+func TestFileStoreQueryWhileAppending(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewFileStore(filepath.Join(t.TempDir(), "audit.jsonl"), 1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			_ = s.Append(ctx, Entry{Time: time.Now(), Device: "led", Operation: "led.set", Result: ResultOK})
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if _, err := s.Query(ctx, Filter{Limit: 10}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+}
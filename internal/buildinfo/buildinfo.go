@@ -0,0 +1,47 @@
+package buildinfo
+
+import (
+	"runtime/debug"
+	"sync"
+)
+
+// 建置時以 -ldflags 注入，例如：
+//
+//	go build -ldflags "-X github.com/HarrisonZz/web_server_in_go/internal/buildinfo.Version=v1.2.0 \
+//	  -X github.com/HarrisonZz/web_server_in_go/internal/buildinfo.Commit=$(git rev-parse --short HEAD)"
+var (
+	Version = ""
+	Commit  = ""
+)
+
+// Info 是目前 binary 的版本資訊
+type Info struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit,omitempty"`
+}
+
+var (
+	once sync.Once
+	info Info
+)
+
+// Get 回傳 ldflags 注入的版本；未注入時退回 Go 記錄的 module 版本與 vcs.revision（-buildvcs=false 時沒有）
+func Get() Info {
+	once.Do(func() {
+		info = Info{Version: Version, Commit: Commit}
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+				info.Version = bi.Main.Version
+			}
+			for _, s := range bi.Settings {
+				if s.Key == "vcs.revision" && info.Commit == "" {
+					info.Commit = s.Value
+				}
+			}
+		}
+		if info.Version == "" {
+			info.Version = "dev"
+		}
+	})
+	return info
+}
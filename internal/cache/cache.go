@@ -12,6 +12,10 @@ type Cache interface {
 	Get(ctx context.Context, key string) ([]byte, bool, error)
 	Set(ctx context.Context, key string, val []byte, ttl time.Duration) error
 	Del(ctx context.Context, key string) error
+	// HGetAll 回傳 hash 的所有 field；key 不存在時回傳空 map
+	HGetAll(ctx context.Context, key string) (map[string][]byte, error)
+	// HApply 在同一個交易中寫入 set 的 field、刪除 del 的 field
+	HApply(ctx context.Context, key string, set map[string][]byte, del []string) error
 	Close() error
 }
 
@@ -53,6 +57,69 @@ func (c *RedisCache) Del(ctx context.Context, key string) error {
 	return c.rdb.Del(ctx, key).Err()
 }
 
+func (c *RedisCache) HGetAll(ctx context.Context, key string) (map[string][]byte, error) {
+	m, err := c.rdb.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string][]byte, len(m))
+	for k, v := range m {
+		out[k] = []byte(v)
+	}
+	return out, nil
+}
+
+func (c *RedisCache) HApply(ctx context.Context, key string, set map[string][]byte, del []string) error {
+	if len(set) == 0 && len(del) == 0 {
+		return nil
+	}
+	values := make([]any, 0, 2*len(set))
+	for k, v := range set {
+		values = append(values, k, v)
+	}
+	_, err := c.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		if len(values) > 0 {
+			p.HSet(ctx, key, values...)
+		}
+		if len(del) > 0 {
+			p.HDel(ctx, key, del...)
+		}
+		return nil
+	})
+	return err
+}
+
+// Client 提供底層 client 給需要 Redis 其他資料結構的功能（例如 stream）
+func (c *RedisCache) Client() *redis.Client {
+	return c.rdb
+}
+
+// Watch 每隔 interval PING 一次，可用狀態改變時呼叫 fn；一開始視為可用，ctx 結束時停止
+func (c *RedisCache) Watch(ctx context.Context, interval time.Duration, fn func(up bool, err error)) {
+	go func() {
+		up := true
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			pctx, cancel := context.WithTimeout(ctx, time.Second)
+			err := c.rdb.Ping(pctx).Err()
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			if now := err == nil; now != up {
+				up = now
+				fn(up, err)
+			}
+		}
+	}()
+}
+
 func (c *RedisCache) Close() error {
 	return c.rdb.Close()
 }
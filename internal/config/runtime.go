@@ -0,0 +1,175 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 可在執行中調整的設定 key（ConfigMap / Secret 的 data key）
+const (
+	KeyLogLevel    = "log_level"
+	KeyOSCacheTTL  = "os_cache_ttl"
+	KeyPodCacheTTL = "pod_cache_ttl"
+	KeyRateLimit   = "rate_limit_rps"
+	KeyRateBurst   = "rate_limit_burst"
+)
+
+// Runtime 是不需重啟即可套用的設定
+type Runtime struct {
+	LogLevel    string        `json:"log_level"` // debug | info | warn | error
+	OSCacheTTL  time.Duration `json:"os_cache_ttl"`
+	PodCacheTTL time.Duration `json:"pod_cache_ttl"`
+	RateLimit   float64       `json:"rate_limit_rps"` // 每個 client IP 每秒請求數，0 表示不限
+	RateBurst   int           `json:"rate_limit_burst"`
+}
+
+// ChangeFunc 在設定套用後呼叫
+type ChangeFunc func(old, cur Runtime)
+
+var (
+	current atomic.Pointer[Runtime]
+
+	mu        sync.Mutex
+	listeners []ChangeFunc
+)
+
+func init() {
+	d := Defaults()
+	current.Store(&d)
+}
+
+// Defaults 讀取 LOG_LEVEL、OS_CACHE_TTL、POD_CACHE_TTL、RATE_LIMIT_RPS、RATE_LIMIT_BURST；
+// 未設定或格式錯誤時使用內建預設值。ConfigMap 刪掉某個 key 時會回到這裡的值
+func Defaults() Runtime {
+	base := Runtime{
+		LogLevel:    "info",
+		OSCacheTTL:  2 * time.Hour, // node 資訊改變時會主動清除，可設長一點
+		PodCacheTTL: 30 * time.Second,
+		RateBurst:   20,
+	}
+	env := map[string]string{}
+	for key, name := range map[string]string{
+		KeyLogLevel:    "LOG_LEVEL",
+		KeyOSCacheTTL:  "OS_CACHE_TTL",
+		KeyPodCacheTTL: "POD_CACHE_TTL",
+		KeyRateLimit:   "RATE_LIMIT_RPS",
+		KeyRateBurst:   "RATE_LIMIT_BURST",
+	} {
+		if v := os.Getenv(name); v != "" {
+			env[key] = v
+		}
+	}
+	// 逐一套用，單一環境變數錯誤不影響其他設定
+	for k, v := range env {
+		if r, err := Parse(base, map[string]string{k: v}); err == nil {
+			base = r
+		}
+	}
+	return base
+}
+
+// IsKey 回報 k 是否為可調整的設定 key；Secret 可能同時放其他用途的 key，監看時只取這些
+func IsKey(k string) bool {
+	switch k {
+	case KeyLogLevel, KeyOSCacheTTL, KeyPodCacheTTL, KeyRateLimit, KeyRateBurst:
+		return true
+	}
+	return false
+}
+
+// Parse 以 base 為底套用 data，未知的 key 視為錯誤，避免打錯字的設定被默默忽略；
+// Secret 中其他用途的 key 由呼叫端先以 IsKey 過濾
+func Parse(base Runtime, data map[string]string) (Runtime, error) {
+	r := base
+	var errs []error
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// 錯誤訊息不含值，設定可能來自 Secret
+	for _, k := range keys {
+		v := strings.TrimSpace(data[k])
+		var reason string
+		switch k {
+		case KeyLogLevel:
+			switch l := strings.ToLower(v); l {
+			case "debug", "info", "warn", "error":
+				r.LogLevel = l
+			default:
+				reason = "must be one of debug, info, warn, error"
+			}
+		case KeyOSCacheTTL:
+			r.OSCacheTTL, reason = parseTTL(v, r.OSCacheTTL)
+		case KeyPodCacheTTL:
+			r.PodCacheTTL, reason = parseTTL(v, r.PodCacheTTL)
+		case KeyRateLimit:
+			if f, err := strconv.ParseFloat(v, 64); err != nil || f < 0 {
+				reason = "must be a number >= 0"
+			} else {
+				r.RateLimit = f
+			}
+		case KeyRateBurst:
+			if n, err := strconv.Atoi(v); err != nil || n < 1 {
+				reason = "must be an integer >= 1"
+			} else {
+				r.RateBurst = n
+			}
+		default:
+			reason = "unknown key"
+		}
+		if reason != "" {
+			errs = append(errs, fmt.Errorf("%s: %s", k, reason))
+		}
+	}
+	return r, errors.Join(errs...)
+}
+
+// parseTTL 接受 0（不快取）到 24h，不合法時回傳 old 與原因
+func parseTTL(v string, old time.Duration) (time.Duration, string) {
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 || d > 24*time.Hour {
+		return old, "must be a duration between 0 and 24h"
+	}
+	return d, ""
+}
+
+// Current 回傳目前生效的設定
+func Current() Runtime {
+	return *current.Load()
+}
+
+// Apply 以 Defaults 為底驗證整份 data；任一個值不合法時整份拒絕，維持目前的設定
+func Apply(data map[string]string) (Runtime, error) {
+	r, err := Parse(Defaults(), data)
+	if err != nil {
+		return Current(), err
+	}
+
+	mu.Lock()
+	old := *current.Swap(&r)
+	fns := listeners
+	mu.Unlock()
+
+	if old != r {
+		for _, fn := range fns {
+			fn(old, r)
+		}
+	}
+	return r, nil
+}
+
+// OnChange 註冊設定改變時的 callback（例如調整 log level）
+func OnChange(fn ChangeFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	listeners = append(listeners, fn)
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	base := Runtime{LogLevel: "info", OSCacheTTL: time.Hour, PodCacheTTL: 30 * time.Second, RateBurst: 20}
+
+	tests := []struct {
+		name    string
+		data    map[string]string
+		want    Runtime
+		wantErr []string // 錯誤訊息須包含的片段
+	}{
+		{name: "empty keeps base", data: nil, want: base},
+		{
+			name: "all keys",
+			data: map[string]string{
+				KeyLogLevel: " DEBUG ", KeyOSCacheTTL: "10m", KeyPodCacheTTL: "0s",
+				KeyRateLimit: "2.5", KeyRateBurst: "5",
+			},
+			want: Runtime{LogLevel: "debug", OSCacheTTL: 10 * time.Minute, PodCacheTTL: 0, RateLimit: 2.5, RateBurst: 5},
+		},
+		{name: "ttl upper bound", data: map[string]string{KeyOSCacheTTL: "24h"}, want: Runtime{LogLevel: "info", OSCacheTTL: 24 * time.Hour, PodCacheTTL: 30 * time.Second, RateBurst: 20}},
+		{name: "ttl too long", data: map[string]string{KeyOSCacheTTL: "25h"}, want: base, wantErr: []string{"os_cache_ttl"}},
+		{name: "negative ttl", data: map[string]string{KeyPodCacheTTL: "-1s"}, want: base, wantErr: []string{"pod_cache_ttl"}},
+		{name: "bad level", data: map[string]string{KeyLogLevel: "verbose"}, want: base, wantErr: []string{"log_level"}},
+		{name: "negative rate", data: map[string]string{KeyRateLimit: "-1"}, want: base, wantErr: []string{"rate_limit_rps"}},
+		{name: "zero burst", data: map[string]string{KeyRateBurst: "0"}, want: base, wantErr: []string{"rate_limit_burst"}},
+		{name: "unknown key", data: map[string]string{"log_lvl": "debug"}, want: base, wantErr: []string{"log_lvl: unknown key"}},
+		{
+			// 合法的值仍會套用在回傳值上，所有錯誤一起回報
+			name:    "valid and invalid together",
+			data:    map[string]string{KeyLogLevel: "error", KeyRateBurst: "x", "typo": "1"},
+			want:    Runtime{LogLevel: "error", OSCacheTTL: time.Hour, PodCacheTTL: 30 * time.Second, RateBurst: 20},
+			wantErr: []string{"rate_limit_burst", "typo"},
+		},
+		{name: "error hides the value", data: map[string]string{KeyRateLimit: "s3cr3t"}, want: base, wantErr: []string{"rate_limit_rps: must be"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(base, tt.data)
+			if got != tt.want {
+				t.Fatalf("Parse = %+v, want %+v", got, tt.want)
+			}
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, s := range tt.wantErr {
+				if !strings.Contains(err.Error(), s) {
+					t.Fatalf("error %q does not mention %q", err, s)
+				}
+			}
+			for _, v := range tt.data {
+				if len(v) > 3 && strings.Contains(err.Error(), v) {
+					t.Fatalf("error %q leaks value %q", err, v)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyRejectsWholeData(t *testing.T) {
+	before := Current()
+	var calls int
+	OnChange(func(old, cur Runtime) { calls++ })
+
+	if _, err := Apply(map[string]string{KeyLogLevel: "debug", KeyRateBurst: "0"}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if Current() != before || calls != 0 {
+		t.Fatalf("invalid data was applied: %+v (calls=%d)", Current(), calls)
+	}
+
+	r, err := Apply(map[string]string{KeyLogLevel: "debug"})
+	if err != nil || r.LogLevel != "debug" || Current() != r || calls != 1 {
+		t.Fatalf("Apply = %+v, %v (calls=%d)", r, err, calls)
+	}
+	t.Cleanup(func() { current.Store(&before) })
+}
@@ -0,0 +1,146 @@
+package events
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Event 是推送給 SSE / WebSocket client 的一筆事件
+type Event struct {
+	ID     uint64    `json:"id"`
+	Type   string    `json:"type"`
+	Source string    `json:"source,omitempty"`
+	Time   time.Time `json:"time"`
+	Data   any       `json:"data,omitempty"`
+}
+
+// TypeReset 表示 client 的 Last-Event-ID 已不在歷史紀錄中，需要重新取得完整狀態
+const TypeReset = "reset"
+
+// Hub 將事件廣播給所有訂閱者，並保留最近的事件供斷線重連時補送
+type Hub struct {
+	mu      sync.Mutex
+	nextID  uint64
+	history []Event // ring buffer，依 ID 遞增
+	start   int
+	size    int
+	subs    map[*Subscriber]struct{}
+	bufSize int
+}
+
+// Subscriber 的 C 在 client 太慢被踢除或取消訂閱時會被關閉
+type Subscriber struct {
+	C       <-chan Event
+	ch      chan Event
+	dropped bool
+}
+
+// Dropped 表示因為 buffer 滿了被 Hub 主動踢除
+func (s *Subscriber) Dropped() bool { return s.dropped }
+
+// NewHub 建立 Hub；historySize 為可補送的事件數，bufSize 為每個 client 的 buffer 大小，
+// 負數的 historySize 視為 0（不補送），bufSize 至少為 1
+func NewHub(historySize, bufSize int) *Hub {
+	historySize, bufSize = max(historySize, 0), max(bufSize, 1)
+	return &Hub{
+		// 以啟動時間作為起始 ID，重啟後舊的 Last-Event-ID 不會和新事件重疊
+		nextID:  uint64(time.Now().UnixMilli()) * 1000,
+		history: make([]Event, historySize),
+		subs:    map[*Subscriber]struct{}{},
+		bufSize: bufSize,
+	}
+}
+
+// NewHubFromEnv 以 EVENTS_HISTORY（預設 256）與 EVENTS_CLIENT_BUFFER（預設 32）建立 Hub
+func NewHubFromEnv() *Hub {
+	return NewHub(envPositive("EVENTS_HISTORY", 256), envPositive("EVENTS_CLIENT_BUFFER", 32))
+}
+
+// envPositive 讀取整數環境變數，未設定、格式錯誤或小於 1 時使用 def
+func envPositive(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v >= 1 {
+		return v
+	}
+	return def
+}
+
+// Publish 廣播事件；不會阻塞，buffer 已滿的訂閱者直接踢除
+func (h *Hub) Publish(typ, source string, data any) Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	ev := Event{ID: h.nextID, Type: typ, Source: source, Time: time.Now().UTC(), Data: data}
+
+	if n := len(h.history); n > 0 {
+		h.history[(h.start+h.size)%n] = ev
+		if h.size < n {
+			h.size++
+		} else {
+			h.start = (h.start + 1) % n
+		}
+	}
+
+	for s := range h.subs {
+		select {
+		case s.ch <- ev:
+		default:
+			s.dropped = true
+			h.remove(s)
+		}
+	}
+	return ev
+}
+
+// Subscribe 註冊新的訂閱者，lastID > 0 時一併回傳之後的歷史事件；
+// 若 lastID 已超出保留範圍，backlog 只有一筆 TypeReset 事件
+func (h *Hub) Subscribe(lastID uint64) (*Subscriber, []Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan Event, h.bufSize)
+	s := &Subscriber{C: ch, ch: ch}
+	h.subs[s] = struct{}{}
+
+	if lastID == 0 || lastID == h.nextID {
+		return s, nil
+	}
+
+	n := len(h.history)
+	if h.size == 0 || lastID > h.nextID || lastID+1 < h.history[h.start].ID {
+		return s, []Event{{ID: h.nextID, Type: TypeReset, Time: time.Now().UTC()}}
+	}
+
+	var backlog []Event
+	for i := 0; i < h.size; i++ {
+		ev := h.history[(h.start+i)%n]
+		if ev.ID > lastID {
+			backlog = append(backlog, ev)
+		}
+	}
+	return s, backlog
+}
+
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(s)
+}
+
+// remove 呼叫端須持有 h.mu
+func (h *Hub) remove(s *Subscriber) {
+	if _, ok := h.subs[s]; !ok {
+		return
+	}
+	delete(h.subs, s)
+	close(s.ch)
+}
+
+// Subscribers 回傳目前的訂閱者數量
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
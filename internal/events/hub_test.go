@@ -0,0 +1,244 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestEnvPositive(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"", 32},
+		{"64", 64},
+		{"1", 1},
+		{"0", 32},
+		{"-5", 32},
+		{"abc", 32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("EVENTS_CLIENT_BUFFER", tt.value)
+			t.Setenv("EVENTS_HISTORY", tt.value)
+			if got := envPositive("EVENTS_CLIENT_BUFFER", 32); got != tt.want {
+				t.Fatalf("envPositive = %d, want %d", got, tt.want)
+			}
+			// 任何設定值都不可讓 Hub 在 make 時 panic
+			h := NewHubFromEnv()
+			sub, _ := h.Subscribe(0)
+			h.Publish("state", "api", nil)
+			h.Unsubscribe(sub)
+		})
+	}
+}
+
+func ids(evs []Event) []uint64 {
+	out := []uint64{}
+	for _, ev := range evs {
+		out = append(out, ev.ID)
+	}
+	return out
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	tests := []struct {
+		name      string
+		history   int
+		publish   int
+		lastID    func(first uint64) uint64 // first 是第一筆事件的 ID
+		want      func(first uint64) []uint64
+		wantReset bool
+	}{
+		{
+			name: "no last id", history: 4, publish: 3,
+			lastID: func(uint64) uint64 { return 0 },
+			want:   func(uint64) []uint64 { return []uint64{} },
+		},
+		{
+			name: "replays newer events", history: 4, publish: 3,
+			lastID: func(f uint64) uint64 { return f },
+			want:   func(f uint64) []uint64 { return []uint64{f + 1, f + 2} },
+		},
+		{
+			name: "up to date", history: 4, publish: 3,
+			lastID: func(f uint64) uint64 { return f + 2 },
+			want:   func(uint64) []uint64 { return []uint64{} },
+		},
+		{
+			// ring buffer 只留最後 4 筆（f+2 ~ f+5），f+1 之後的仍可完整補送
+			name: "wrapped history still covers last id", history: 4, publish: 6,
+			lastID: func(f uint64) uint64 { return f + 1 },
+			want:   func(f uint64) []uint64 { return []uint64{f + 2, f + 3, f + 4, f + 5} },
+		},
+		{
+			name: "wrapped history lost events", history: 4, publish: 6,
+			lastID:    func(f uint64) uint64 { return f },
+			wantReset: true,
+		},
+		{
+			name: "id from the future", history: 4, publish: 2,
+			lastID:    func(f uint64) uint64 { return f + 100 },
+			wantReset: true,
+		},
+		{
+			name: "no history", history: 0, publish: 2,
+			lastID:    func(f uint64) uint64 { return f },
+			wantReset: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHub(tt.history, 8)
+			var first uint64
+			for i := 0; i < tt.publish; i++ {
+				ev := h.Publish("state", "api", i)
+				if i == 0 {
+					first = ev.ID
+				}
+			}
+
+			sub, backlog := h.Subscribe(tt.lastID(first))
+			defer h.Unsubscribe(sub)
+			if tt.wantReset {
+				if len(backlog) != 1 || backlog[0].Type != TypeReset || backlog[0].ID != first+uint64(tt.publish)-1 {
+					t.Fatalf("backlog = %+v, want a single reset at the latest id", backlog)
+				}
+				return
+			}
+			if got, want := ids(backlog), tt.want(first); !reflect.DeepEqual(got, want) {
+				t.Fatalf("backlog ids = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSlowSubscriberDropped(t *testing.T) {
+	h := NewHub(4, 2)
+	slow, _ := h.Subscribe(0)
+	fast, _ := h.Subscribe(0)
+
+	for i := 0; i < 3; i++ {
+		h.Publish("state", "api", i)
+		// fast 即時讀取，slow 不讀
+		if ev := <-fast.C; ev.Data != i {
+			t.Fatalf("fast got %v, want %d", ev.Data, i)
+		}
+	}
+
+	// 第三筆事件時 slow 的 buffer（2）已滿，被踢除並關閉 channel
+	if !slow.Dropped() {
+		t.Fatal("slow subscriber was not dropped")
+	}
+	var got []any
+	for ev := range slow.C {
+		got = append(got, ev.Data)
+	}
+	if !reflect.DeepEqual(got, []any{0, 1}) {
+		t.Fatalf("slow received %v before being dropped, want [0 1]", got)
+	}
+	if fast.Dropped() || h.Subscribers() != 1 {
+		t.Fatalf("fast dropped=%v subscribers=%d", fast.Dropped(), h.Subscribers())
+	}
+
+	// 主動取消訂閱不算被踢除，重複取消也不會 panic
+	h.Unsubscribe(fast)
+	h.Unsubscribe(fast)
+	if fast.Dropped() || h.Subscribers() != 0 {
+		t.Fatalf("fast dropped=%v subscribers=%d", fast.Dropped(), h.Subscribers())
+	}
+}
+
+// sseIDs 取出 SSE 回應中的 id 與 event 欄位
+func sseIDs(body string) []string {
+	var out []string
+	for _, block := range strings.Split(body, "\n\n") {
+		var id, typ string
+		for _, line := range strings.Split(block, "\n") {
+			if v, ok := strings.CutPrefix(line, "id: "); ok {
+				id = v
+			}
+			if v, ok := strings.CutPrefix(line, "event: "); ok {
+				typ = v
+			}
+		}
+		if id != "" {
+			out = append(out, typ+":"+id)
+		}
+	}
+	return out
+}
+
+func TestServeSSEResume(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewHub(3, 8)
+	var first uint64
+	for i := 0; i < 5; i++ {
+		ev := h.Publish("state", "api", i)
+		if i == 0 {
+			first = ev.ID
+		}
+	}
+	id := func(n uint64) string { return fmt.Sprint(first + n) }
+
+	tests := []struct {
+		name   string
+		header string
+		query  string
+		want   []string
+	}{
+		{name: "fresh client", want: nil},
+		{name: "header resumes", header: id(2), want: []string{"state:" + id(3), "state:" + id(4)}},
+		{name: "query resumes", query: id(3), want: []string{"state:" + id(4)}},
+		{name: "header wins over query", header: id(3), query: id(2), want: []string{"state:" + id(4)}},
+		{name: "stale id gets reset", header: id(0), want: []string{"reset:" + id(4)}},
+		{name: "invalid id is ignored", header: "abc", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			url := "/events"
+			if tt.query != "" {
+				url += "?last_event_id=" + tt.query
+			}
+			req := httptest.NewRequest(http.MethodGet, url, nil).WithContext(ctx)
+			if tt.header != "" {
+				req.Header.Set("Last-Event-ID", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r := gin.New()
+			r.GET("/events", func(c *gin.Context) { ServeSSE(c, h) })
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				r.ServeHTTP(w, req)
+			}()
+			// 等訂閱建立後再斷線，backlog 在訂閱時就已寫出
+			for h.Subscribers() == 0 {
+				select {
+				case <-done:
+					t.Fatal("handler returned early")
+				case <-time.After(time.Millisecond):
+				}
+			}
+			cancel()
+			<-done
+
+			if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+				t.Fatalf("Content-Type = %q", ct)
+			}
+			if got := sseIDs(w.Body.String()); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
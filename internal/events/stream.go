@@ -0,0 +1,168 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	heartbeatInterval = 15 * time.Second
+	wsWriteTimeout    = 10 * time.Second
+	wsPongTimeout     = 2 * heartbeatInterval
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// lastEventID 取自 Last-Event-ID header（瀏覽器 EventSource 自動帶上），或 ?last_event_id= 參數
+func lastEventID(c *gin.Context) uint64 {
+	v := c.GetHeader("Last-Event-ID")
+	if v == "" {
+		v = c.Query("last_event_id")
+	}
+	id, _ := strconv.ParseUint(v, 10, 64)
+	return id
+}
+
+// ServeSSE 以 text/event-stream 推送事件，直到 client 斷線或因太慢被踢除
+func ServeSSE(c *gin.Context, hub *Hub) {
+	sub, backlog := hub.Subscribe(lastEventID(c))
+	defer hub.Unsubscribe(sub)
+
+	// http.Server 的 WriteTimeout 會切斷長連線，這裡改為每次寫入前延長
+	rc := http.NewResponseController(c.Writer)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 關閉 nginx buffering
+	c.Status(http.StatusOK)
+
+	write := func(ev Event) error {
+		_ = rc.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		b, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, b); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	for _, ev := range backlog {
+		if err := write(ev); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-sub.C:
+			if !ok {
+				if sub.Dropped() {
+					logger.Warn(fmt.Sprintf("[EVENTS] SSE client dropped (slow consumer) from=%s", c.ClientIP()))
+				}
+				return
+			}
+			if err := write(ev); err != nil {
+				return
+			}
+		case <-ticker.C:
+			_ = rc.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// ServeWS 以 WebSocket 推送事件，每則訊息為一筆 JSON Event
+func ServeWS(c *gin.Context, hub *Hub) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade 失敗時已回應 client
+		logger.Warn(fmt.Sprintf("[EVENTS] websocket upgrade failed from=%s error=%v", c.ClientIP(), err))
+		return
+	}
+	defer conn.Close()
+
+	sub, backlog := hub.Subscribe(lastEventID(c))
+	defer hub.Unsubscribe(sub)
+
+	// 讀取端只處理 control frame；client 關閉或 pong 逾時時結束
+	closed := make(chan struct{})
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(ev Event) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return conn.WriteJSON(ev)
+	}
+
+	for _, ev := range backlog {
+		if err := write(ev); err != nil {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case ev, ok := <-sub.C:
+			if !ok {
+				reason := "unsubscribed"
+				if sub.Dropped() {
+					reason = "slow consumer"
+					logger.Warn(fmt.Sprintf("[EVENTS] websocket client dropped (slow consumer) from=%s", c.ClientIP()))
+				}
+				_ = conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, reason),
+					time.Now().Add(time.Second))
+				return
+			}
+			if err := write(ev); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
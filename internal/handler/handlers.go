@@ -2,11 +2,13 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/HarrisonZz/web_server_in_go/internal/config"
 	"github.com/HarrisonZz/web_server_in_go/internal/deps"
 	"github.com/HarrisonZz/web_server_in_go/internal/kubernetes"
 	"github.com/HarrisonZz/web_server_in_go/internal/logger"
@@ -17,19 +19,29 @@ import (
 
 var routes = []Route{
 	&pingRoute{},
+	&pingAllRoute{},
 	&healthzRoute{},
+	&readyzRoute{},
+	&podRoute{},
+	&leaderRoute{},
 	&osInfoRoute{},
 }
 
-func GetRoutes() map[string]gin.HandlerFunc {
-	// 回傳副本，防止外部修改
-	out := make(map[string]gin.HandlerFunc, len(routes))
-	for _, r := range routes {
+// OSInfoCacheKey 是 /os 回應的快取 key，node 資訊改變時需清除
+const OSInfoCacheKey = "sys:os-info"
 
-		if r.Method() == http.MethodGet {
-			out[r.Path()] = r.Handle
-		}
+// nodeIP 回傳目前 node 的 IP，尚未取得 node 資訊時為 "unknown"
+func nodeIP() string {
+	if node, ok := kubernetes.Snapshot(); ok && node.InternalIP != "" {
+		return node.InternalIP
 	}
+	return "unknown"
+}
+
+func GetRoutes() []Route {
+	// 回傳副本，防止外部修改
+	out := make([]Route, len(routes))
+	copy(out, routes)
 	return out
 }
 
@@ -49,28 +61,36 @@ func (r *pingRoute) Handle(c *gin.Context) {
 	start := time.Now()
 	span := trace.SpanFromContext(c.Request.Context())
 
-	r.response = fmt.Sprintf("pong from %s", kubernetes.NodeInfo.InternalIP)
+	ip := nodeIP()
+	r.response = fmt.Sprintf("pong from %s", ip)
 	c.Header("Content-Type", "text/plain")
 
 	Replyln(c, http.StatusOK, r.response)
 	elapsed := time.Since(start)
-	logger.Info(fmt.Sprintf(
+	logger.InfoCtx(c.Request.Context(), fmt.Sprintf(
 		"[PING] %s %s from=%s response=%s duration=%v",
 		r.Method(),
 		c.FullPath(),
 		c.ClientIP(),
-		kubernetes.NodeInfo.InternalIP,
+		ip,
 		elapsed,
 	))
 	span.SetAttributes(
-		attribute.String("node.ip", kubernetes.NodeInfo.InternalIP),
+		attribute.String("node.ip", ip),
 	)
 }
 
 type HealthResponse struct {
-	Node   string `json:"node"`
-	Memory string `json:"memory"`
-	CPU    string `json:"cpu"`
+	Status     string                     `json:"status"` // ok | degraded
+	Node       string                     `json:"node"`
+	Memory     string                     `json:"memory"`
+	CPU        string                     `json:"cpu"`
+	Ready      bool                       `json:"ready"` // 是否已取得 node 資訊
+	Degraded   []string                   `json:"degraded,omitempty"`
+	Conditions []kubernetes.NodeCondition `json:"conditions,omitempty"`
+	Taints     []kubernetes.Taint         `json:"taints,omitempty"`
+	Cordoned   bool                       `json:"cordoned"`
+	Usage      *kubernetes.NodeUsage      `json:"usage,omitempty"` // 沒有 metrics-server 時省略
 }
 
 type healthzRoute struct {
@@ -83,35 +103,70 @@ func (r *healthzRoute) Handle(c *gin.Context) {
 	start := time.Now()
 	span := trace.SpanFromContext(c.Request.Context())
 
-	logger.Info(fmt.Sprintf(
+	logger.InfoCtx(c.Request.Context(), fmt.Sprintf(
 		"[START] %s %s from %s",
 		r.Method(),
 		c.FullPath(),
 		c.ClientIP(),
 	))
 
+	node, ok := kubernetes.Snapshot()
 	r.response = HealthResponse{
-		Node:   kubernetes.NodeInfo.Name,
-		Memory: kubernetes.NodeInfo.Memory,
-		CPU:    kubernetes.NodeInfo.CPU,
+		Status:     "ok",
+		Node:       node.Name,
+		Memory:     node.Memory,
+		CPU:        node.CPU,
+		Ready:      ok,
+		Degraded:   node.Degraded(),
+		Conditions: node.Conditions,
+		Taints:     node.Taints,
+		Cordoned:   node.Unschedulable,
+	}
+	if u, err := kubernetes.Usage(c.Request.Context()); err == nil {
+		r.response.Usage = u
+	} else if !errors.Is(err, kubernetes.ErrNoMetrics) {
+		span.AddEvent("metrics.error", trace.WithAttributes(attribute.String("error", err.Error())))
 	}
 
-	c.JSON(http.StatusOK, r.response)
+	// liveness 只看 process 本身，node 有 pressure 時仍回 200，由 /readyz 決定是否導走流量
+	status := http.StatusOK
+	if len(r.response.Degraded) > 0 {
+		r.response.Status = "degraded"
+	}
+	c.JSON(status, r.response)
 
 	elapsed := time.Since(start)
-	logger.Info(fmt.Sprintf(
+	logger.InfoCtx(c.Request.Context(), fmt.Sprintf(
 		"[END] %s %s status=%d duration=%v",
 		r.Method(),
 		c.FullPath(),
-		http.StatusOK,
+		status,
 		elapsed,
 	))
 
 	span.SetAttributes(
-		attribute.String("node.ip", kubernetes.NodeInfo.InternalIP),
+		attribute.String("node.ip", node.InternalIP),
+		attribute.Bool("node.degraded", len(r.response.Degraded) > 0),
 	)
 }
 
+// readyzRoute 在取得 node 資訊前、或 node 有 pressure / 不是 Ready 時回 503，供 readiness probe 使用
+type readyzRoute struct{}
+
+func (r *readyzRoute) Method() string { return http.MethodGet }
+func (r *readyzRoute) Path() string   { return "/readyz" }
+func (r *readyzRoute) Handle(c *gin.Context) {
+	if !kubernetes.IsReady() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"ready": false, "error": "node info not available", "code": "node_info_unavailable"})
+		return
+	}
+	if node, _ := kubernetes.Snapshot(); len(node.Degraded()) > 0 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"ready": false, "degraded": node.Degraded(), "error": "node is degraded", "code": "node_degraded"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ready": true})
+}
+
 type osInfoRoute struct {
 	response map[string]any
 }
@@ -124,17 +179,21 @@ func (r *osInfoRoute) Handle(c *gin.Context) {
 
 	span := trace.SpanFromContext(c.Request.Context())
 
-	logger.Info(fmt.Sprintf(
+	logger.InfoCtx(c.Request.Context(), fmt.Sprintf(
 		"[START] %s %s from %s",
 		r.Method(),
 		c.FullPath(),
 		c.ClientIP(),
 	))
 
-	const (
-		key = "sys:os-info"
-		ttl = 2 * time.Hour // 資訊幾乎不會變動，可設長一點
-	)
+	key, ttl := OSInfoCacheKey, config.Current().OSCacheTTL
+
+	node, ok := kubernetes.Snapshot()
+	if !ok {
+		span.SetAttributes(attribute.String("cache.status", "skipped"))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "node info not available", "code": "node_info_unavailable"})
+		return
+	}
 
 	cache := deps.CacheFrom(c)
 
@@ -154,12 +213,12 @@ func (r *osInfoRoute) Handle(c *gin.Context) {
 			span.SetAttributes(attribute.String("cache.status", "miss"))
 
 			r.response = gin.H{
-				"node": kubernetes.NodeInfo.Name,
+				"node": node.Name,
 				"os": gin.H{
-					"architecture":    kubernetes.NodeInfo.Arch,
-					"operatingSystem": kubernetes.NodeInfo.OS,
-					"osImage":         kubernetes.NodeInfo.OSImage,
-					"kernelVersion":   kubernetes.NodeInfo.Kernel,
+					"architecture":    node.Arch,
+					"operatingSystem": node.OS,
+					"osImage":         node.OSImage,
+					"kernelVersion":   node.Kernel,
 				},
 			}
 			c.Header("X-Cache", cacheStatus)
@@ -167,15 +226,18 @@ func (r *osInfoRoute) Handle(c *gin.Context) {
 
 			jsonBytes, err := json.Marshal(r.response)
 			if err == nil {
-				_ = cache.Set(c, key, jsonBytes, ttl)
+				// TTL 為 0 表示不快取（Redis 的 0 是永不過期）
+				if ttl > 0 {
+					_ = cache.Set(c, key, jsonBytes, ttl)
+				}
 			} else {
-				logger.Warn(fmt.Sprintf("Cache store failed for key=%s: %v", key, err))
+				logger.WarnCtx(c.Request.Context(), fmt.Sprintf("Cache store failed for key=%s: %v", key, err))
 			}
 		}
 	}
 
 	elapsed := time.Since(start)
-	logger.Info(fmt.Sprintf(
+	logger.InfoCtx(c.Request.Context(), fmt.Sprintf(
 		"[END] %s %s status=%d duration=%v cache=%s",
 		r.Method(),
 		c.FullPath(),
@@ -185,7 +247,7 @@ func (r *osInfoRoute) Handle(c *gin.Context) {
 	))
 
 	span.SetAttributes(
-		attribute.String("node.name", kubernetes.NodeInfo.Name),
+		attribute.String("node.name", node.Name),
 		attribute.String("cache.status", cacheStatus),
 		attribute.String("http.route", c.FullPath()),
 	)
@@ -217,6 +279,6 @@ func Replyln(c *gin.Context, status int, msg string) {
 
 func NoRoute(c *gin.Context) {
 	path := c.Request.URL.Path
-	logger.Error(fmt.Sprintf("No route rule for path: %s", path))
+	logger.ErrorCtx(c.Request.Context(), fmt.Sprintf("No route rule for path: %s", path))
 	Replyln(c, http.StatusNotFound, "404 page not found")
 }
@@ -0,0 +1,17 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/kubernetes"
+	"github.com/gin-gonic/gin"
+)
+
+// leaderRoute 回報 leader election 狀態；非 leader 也回 200，方便比對各副本的看法
+type leaderRoute struct{}
+
+func (r *leaderRoute) Method() string { return http.MethodGet }
+func (r *leaderRoute) Path() string   { return "/leader" }
+func (r *leaderRoute) Handle(c *gin.Context) {
+	c.JSON(http.StatusOK, kubernetes.Leader())
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/kubernetes"
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	maxFanoutTimeout = 10 * time.Second
+	fanoutWorkers    = 16
+)
+
+var (
+	fanoutTimeout = func() time.Duration {
+		if d, err := time.ParseDuration(os.Getenv("PING_FANOUT_TIMEOUT")); err == nil && d > 0 {
+			return d
+		}
+		return 2 * time.Second
+	}()
+
+	peerClient = &http.Client{}
+	tracer     = otel.Tracer("web-server-in-go/handler")
+)
+
+// PeerResult 是 /ping/all 矩陣中的一列
+type PeerResult struct {
+	kubernetes.Peer
+	NodeIP    string  `json:"node_ip,omitempty"` // 對方 /ping 回報的 node IP
+	Status    int     `json:"status,omitempty"`
+	OK        bool    `json:"ok"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type pingAllRoute struct{}
+
+func (r *pingAllRoute) Method() string { return http.MethodGet }
+func (r *pingAllRoute) Path() string   { return "/ping/all" }
+func (r *pingAllRoute) Handle(c *gin.Context) {
+	start := time.Now()
+	ctx := c.Request.Context()
+	span := trace.SpanFromContext(ctx)
+
+	timeout := fanoutTimeout
+	if v := c.Query("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxFanoutTimeout {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("timeout must be a duration up to %v", maxFanoutTimeout), "code": "invalid_query"})
+			return
+		}
+		timeout = d
+	}
+
+	list, err := kubernetes.Peers(ctx)
+	if err != nil {
+		status, code := http.StatusBadGateway, "kubernetes_error"
+		if errors.Is(err, kubernetes.ErrNoClient) || errors.Is(err, kubernetes.ErrNoPeerService) || errors.Is(err, kubernetes.ErrNoPodIdentity) {
+			status, code = http.StatusServiceUnavailable, "peer_discovery_unavailable"
+		}
+		logger.ErrorCtx(ctx, fmt.Sprintf("[PING] peer discovery failed error=%v from=%s", err, c.ClientIP()))
+		c.JSON(status, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+
+	results := make([]PeerResult, len(list.Peers))
+	sem := make(chan struct{}, fanoutWorkers)
+	var wg sync.WaitGroup
+	for i, p := range list.Peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = pingPeer(ctx, p, timeout)
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, r := range results {
+		if !r.OK {
+			failed++
+		}
+	}
+	span.SetAttributes(
+		attribute.Int("ping.peers", len(results)),
+		attribute.Int("ping.failed", failed),
+	)
+
+	resp := gin.H{
+		"from":    nodeIP(),
+		"timeout": timeout.String(),
+		"peers":   results,
+		"summary": gin.H{"total": len(results), "ok": len(results) - failed, "failed": failed},
+	}
+	// EndpointSlice 查不到時 peers 來自 Endpoints，可能少了對方，不可讓 client 以為只有這些副本
+	if list.SliceErr != nil {
+		resp["peers_error"] = list.SliceErr.Error()
+		span.SetAttributes(attribute.String("ping.peers_error", list.SliceErr.Error()))
+	}
+	c.JSON(http.StatusOK, resp)
+	logger.InfoCtx(ctx, fmt.Sprintf(
+		"[PING] fan-out peers=%d failed=%d duration=%v from=%s",
+		len(results), failed, time.Since(start), c.ClientIP(),
+	))
+}
+
+// pingPeer 呼叫對方的 /ping，並以 client span + traceparent header 延續同一個 trace
+func pingPeer(ctx context.Context, p kubernetes.Peer, timeout time.Duration) PeerResult {
+	res := PeerResult{Peer: p}
+	url := "http://" + net.JoinHostPort(p.IP, strconv.Itoa(int(p.Port))) + "/ping"
+
+	ctx, span := tracer.Start(ctx, "ping.peer", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("k8s.pod.name", p.Pod),
+		attribute.String("server.address", p.IP),
+		attribute.Int("server.port", int(p.Port)),
+		attribute.String("url.full", url),
+	))
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	start := time.Now()
+	resp, err := peerClient.Do(req)
+	res.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		res.Error = err.Error()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "peer unreachable")
+		return res
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	res.Status = resp.StatusCode
+	res.OK = resp.StatusCode == http.StatusOK
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if !res.OK {
+		span.SetStatus(codes.Error, resp.Status)
+		return res
+	}
+	res.NodeIP = strings.TrimSpace(strings.TrimPrefix(string(body), "pong from "))
+	return res
+}
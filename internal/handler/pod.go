@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/config"
+	"github.com/HarrisonZz/web_server_in_go/internal/deps"
+	"github.com/HarrisonZz/web_server_in_go/internal/kubernetes"
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+type podRoute struct{}
+
+func (r *podRoute) Method() string { return http.MethodGet }
+func (r *podRoute) Path() string   { return "/pod" }
+func (r *podRoute) Handle(c *gin.Context) {
+	start := time.Now()
+	span := trace.SpanFromContext(c.Request.Context())
+	cacheStatus := "Miss"
+
+	key := kubernetes.PodCacheKey()
+	cache := deps.CacheFrom(c)
+
+	if cache != nil {
+		b, ok, err := cache.Get(c, key)
+		switch {
+		case err != nil:
+			span.AddEvent("redis.error", trace.WithAttributes(attribute.String("error", err.Error())))
+		case ok:
+			cacheStatus = "Hit"
+			span.SetAttributes(attribute.String("cache.status", "hit"))
+			c.Header("X-Cache", cacheStatus)
+			c.Data(http.StatusOK, "application/json; charset=utf-8", b)
+			return
+		}
+	}
+	span.SetAttributes(attribute.String("cache.status", "miss"))
+
+	pod, err := kubernetes.GetPod(c.Request.Context())
+	if err != nil {
+		status, code := http.StatusBadGateway, "kubernetes_error"
+		switch {
+		case errors.Is(err, kubernetes.ErrNoClient), errors.Is(err, kubernetes.ErrNoPodIdentity):
+			status, code = http.StatusServiceUnavailable, "kubernetes_unavailable"
+		case apierrors.IsNotFound(err):
+			status, code = http.StatusNotFound, "pod_not_found"
+		case apierrors.IsForbidden(err):
+			status, code = http.StatusForbidden, "forbidden"
+		}
+		logger.ErrorCtx(c.Request.Context(), fmt.Sprintf("[POD] lookup failed error=%v from=%s", err, c.ClientIP()))
+		c.JSON(status, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+
+	b, err := json.Marshal(pod)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "internal_error"})
+		return
+	}
+	// 只快取來自 API 的完整資料；TTL 不宜太長，restart count 與 container 狀態會變動，0 表示不快取
+	if ttl := config.Current().PodCacheTTL; cache != nil && pod.Source != kubernetes.SourceDownward && ttl > 0 {
+		if err := cache.Set(c, key, b, ttl); err != nil {
+			logger.WarnCtx(c.Request.Context(), fmt.Sprintf("Cache store failed for key=%s: %v", key, err))
+		}
+	}
+
+	c.Header("X-Cache", cacheStatus)
+	c.Data(http.StatusOK, "application/json; charset=utf-8", b)
+
+	span.SetAttributes(
+		attribute.String("k8s.pod.name", pod.Name),
+		attribute.String("k8s.namespace.name", pod.Namespace),
+	)
+	logger.InfoCtx(c.Request.Context(), fmt.Sprintf(
+		"[POD] %s/%s source=%s duration=%v cache=%s",
+		pod.Namespace, pod.Name, pod.Source, time.Since(start), cacheStatus,
+	))
+}
@@ -0,0 +1,304 @@
+package i2cdevice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/audit"
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	maxBatchOps         = 64
+	defaultBatchTimeout = 5 * time.Second
+	maxBatchTimeout     = 30 * time.Second
+	batchReplySlack     = 5 * time.Second // 寫回應本身的時間
+)
+
+// BatchOp 是 batch 中的一個步驟；compensate 為失敗時要寫回的值（value 或 raw）
+type BatchOp struct {
+	Op         string       `json:"op"` // read | write
+	Register   string       `json:"register"`
+	Value      any          `json:"value,omitempty"`
+	Raw        *int64       `json:"raw,omitempty"`
+	Compensate *BatchAction `json:"compensate,omitempty"`
+}
+
+type BatchAction struct {
+	Value any    `json:"value,omitempty"`
+	Raw   *int64 `json:"raw,omitempty"`
+}
+
+// BatchRequest 是 POST /devices/:name/batch 的 body；
+// restore=true 時，沒有指定 compensate 的可讀暫存器會在寫入前先讀出舊值作為補償
+type BatchRequest struct {
+	Ops     []BatchOp `json:"ops"`
+	Restore bool      `json:"restore"`
+	Verify  *bool     `json:"verify"`
+	Timeout string    `json:"timeout"`
+}
+
+// BatchResult 是單一步驟的結果
+type BatchResult struct {
+	Index    int            `json:"index"`
+	Op       string         `json:"op"`
+	Register string         `json:"register"`
+	Status   string         `json:"status"` // ok | failed | skipped | compensated | compensation_failed
+	Result   *RegisterValue `json:"result,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Code     string         `json:"code,omitempty"`
+}
+
+// batchStep 是驗證後的步驟
+type batchStep struct {
+	op      BatchOp
+	reg     *RegisterSpec
+	data    []byte // write 的資料
+	comp    []byte // 補償寫入的資料，nil 表示沒有
+	restore bool   // 寫入前讀取舊值作為補償
+}
+
+// BatchValidationError 指出第幾個步驟驗證失敗
+type BatchValidationError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchValidationError) Error() string {
+	return fmt.Sprintf("op %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchValidationError) Unwrap() error { return e.Err }
+
+// planBatch 在碰匯流排前驗證所有步驟，任何一步不合法就整批拒絕
+func planBatch(d *regDevice, req BatchRequest) ([]batchStep, error) {
+	if len(req.Ops) == 0 {
+		return nil, fmt.Errorf("%w: ops is required", ErrInvalidValue)
+	}
+	if len(req.Ops) > maxBatchOps {
+		return nil, fmt.Errorf("%w: at most %d ops per batch", ErrInvalidValue, maxBatchOps)
+	}
+
+	steps := make([]batchStep, 0, len(req.Ops))
+	for i, op := range req.Ops {
+		r, ok := d.regs[op.Register]
+		if !ok {
+			return nil, &BatchValidationError{Index: i, Err: ErrUnknownRegister}
+		}
+		st := batchStep{op: op, reg: r}
+
+		switch op.Op {
+		case "read":
+			if !r.readable() {
+				return nil, &BatchValidationError{Index: i, Err: ErrWriteOnly}
+			}
+		case "write":
+			raw, err := r.checkWrite(d, op.Value, op.Raw)
+			if err != nil {
+				return nil, &BatchValidationError{Index: i, Err: err}
+			}
+			st.data = r.encodeRaw(raw)
+
+			switch {
+			case op.Compensate != nil:
+				craw, err := r.checkWrite(d, op.Compensate.Value, op.Compensate.Raw)
+				if err != nil {
+					return nil, &BatchValidationError{Index: i, Err: fmt.Errorf("compensate: %w", err)}
+				}
+				st.comp = r.encodeRaw(craw)
+			case req.Restore && r.readable():
+				st.restore = true
+			}
+		default:
+			return nil, &BatchValidationError{Index: i, Err: fmt.Errorf("%w: op must be read or write", ErrInvalidValue)}
+		}
+		steps = append(steps, st)
+	}
+	return steps, nil
+}
+
+// runBatch 在單次持有匯流排 lock 的情況下依序執行；遇到第一個失敗即停止，並反向執行已完成寫入的補償
+func runBatch(ctx context.Context, d *regDevice, steps []batchStep, verify bool) ([]BatchResult, int, error) {
+	results := make([]BatchResult, len(steps))
+	for i, st := range steps {
+		results[i] = BatchResult{Index: i, Op: st.op.Op, Register: st.reg.Name, Status: "skipped"}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	failed := -1
+	var failErr error
+	for i := range steps {
+		st := &steps[i]
+		r := st.reg
+
+		var err error
+		switch st.op.Op {
+		case "read":
+			buf := make([]byte, r.Width)
+			if err = readRegOn(ctx, d.conn, r.Address, buf); err == nil {
+				v := newRegisterValue(d, r, r.decodeRaw(buf))
+				results[i].Result = &v
+			}
+		case "write":
+			if st.restore {
+				old := make([]byte, r.Width)
+				if err = readRegOn(ctx, d.conn, r.Address, old); err != nil {
+					break
+				}
+				st.comp = old
+			}
+			if err = writeRegOn(ctx, d.conn, r.Address, st.data); err != nil {
+				break
+			}
+			if verify && r.readable() {
+				err = verifyPlanOn(ctx, d.conn, []regWrite{{reg: r.Address, data: st.data, readReg: r.Address}})
+			}
+			if err == nil {
+				v := newRegisterValue(d, r, r.decodeRaw(st.data))
+				results[i].Result = &v
+			}
+		}
+
+		if err != nil {
+			results[i].Status = "failed"
+			results[i].Error = err.Error()
+			results[i].Code = errorCode(err)
+			failed, failErr = i, err
+			break
+		}
+		results[i].Status = "ok"
+	}
+
+	if failed < 0 {
+		return results, -1, nil
+	}
+
+	// 補償不受原本 deadline 影響，避免請求逾時後留下寫到一半的設定
+	cctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), defaultBatchTimeout)
+	defer cancel()
+	for i := failed; i >= 0; i-- {
+		st := steps[i]
+		// 失敗的那一步如果是寫入，也可能已部分生效（例如 verify 失敗），同樣補償
+		if st.op.Op != "write" || st.comp == nil || (i == failed && results[i].Result == nil && !isVerifyErr(failErr)) {
+			continue
+		}
+		if err := writeRegOn(cctx, d.conn, st.reg.Address, st.comp); err != nil {
+			results[i].Status = "compensation_failed"
+			results[i].Error = err.Error()
+			results[i].Code = errorCode(err)
+			continue
+		}
+		if i != failed {
+			results[i].Status = "compensated"
+		}
+	}
+	return results, failed, failErr
+}
+
+func isVerifyErr(err error) bool {
+	var vErr *VerifyError
+	return errors.As(err, &vErr)
+}
+
+func runDeviceBatch(c *gin.Context) {
+	span := trace.SpanFromContext(c.Request.Context())
+	start := time.Now()
+
+	d, ok := regDevices[c.Param("name")]
+	if !ok {
+		replyRegisterError(c, ErrUnknownDevice)
+		return
+	}
+
+	var req BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json", "code": "invalid_json"})
+		return
+	}
+
+	timeout := defaultBatchTimeout
+	if req.Timeout != "" {
+		t, err := time.ParseDuration(req.Timeout)
+		if err != nil || t <= 0 || t > maxBatchTimeout {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("timeout must be a duration up to %v", maxBatchTimeout), "code": "invalid_value"})
+			return
+		}
+		timeout = t
+	}
+
+	steps, err := planBatch(d, req)
+	if err != nil {
+		status, code := registerErrorStatus(err)
+		resp := gin.H{"error": err.Error(), "code": code}
+		var bErr *BatchValidationError
+		if errors.As(err, &bErr) {
+			resp["index"] = bErr.Index
+		}
+		c.JSON(status, resp)
+		return
+	}
+
+	verify := verifyWrites
+	if req.Verify != nil {
+		verify = *req.Verify
+	}
+
+	// timeout 加上補償可能超過 http.Server 的 WriteTimeout，延長這個 request 的寫入期限，
+	// 否則變更與補償都已生效，client 卻收不到結果
+	rc := http.NewResponseController(c.Writer)
+	if err := rc.SetWriteDeadline(time.Now().Add(timeout + defaultBatchTimeout + batchReplySlack)); err != nil {
+		logger.WarnCtx(c.Request.Context(), fmt.Sprintf("[REG] batch cannot extend write deadline: %v", err))
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+
+	span.SetAttributes(
+		attribute.String("device.name", d.spec.Name),
+		attribute.Int("batch.ops", len(steps)),
+	)
+
+	results, failed, err := runBatch(ctx, d, steps, verify)
+	result, msg := audit.Result(err)
+	audit.Record(c.Request.Context(), audit.Entry{
+		Source: SourceAPI, Device: d.spec.Name, Operation: "register.batch",
+		New: results, Result: result, Error: msg,
+	})
+	if err != nil {
+		span.SetAttributes(attribute.Int("batch.failed_index", failed))
+		logger.ErrorCtx(ctx, fmt.Sprintf(
+			"[BATCH] %s aborted at op=%d register=%s error=%v from=%s",
+			d.spec.Name, failed, steps[failed].reg.Name, err, c.ClientIP(),
+		))
+
+		status := http.StatusInternalServerError
+		var txErr *TxError
+		switch {
+		case errors.As(err, &txErr):
+			status = txErr.HTTPStatus()
+		case isVerifyErr(err):
+			status = http.StatusBadGateway
+		}
+		c.JSON(status, gin.H{
+			"error":        err.Error(),
+			"code":         errorCode(err),
+			"failed_index": failed,
+			"results":      results,
+		})
+		return
+	}
+
+	logger.InfoCtx(ctx, fmt.Sprintf(
+		"[BATCH] %s applied ops=%d duration=%v from=%s",
+		d.spec.Name, len(steps), time.Since(start), c.ClientIP(),
+	))
+	c.JSON(http.StatusOK, gin.H{"device": d.spec.Name, "results": results, "verified": verify})
+}
@@ -0,0 +1,177 @@
+package i2cdevice
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// fakeRegs 是記憶體中的暫存器，多 byte 讀取依序讀連續位址；fail 中的 "reg=data" 寫入回傳 EINVAL，stuck 的暫存器寫入不生效
+type fakeRegs struct {
+	mem   map[byte]byte
+	fail  map[string]bool
+	stuck map[byte]bool
+}
+
+func (f *fakeRegs) ReadReg(reg byte, buf []byte) error {
+	for i := range buf {
+		buf[i] = f.mem[reg+byte(i)]
+	}
+	return nil
+}
+
+func (f *fakeRegs) WriteReg(reg byte, buf []byte) error {
+	if f.fail[fmt.Sprintf("%02x=%02x", reg, buf[0])] {
+		return syscall.EINVAL
+	}
+	if !f.stuck[reg] {
+		f.mem[reg] = buf[0]
+	}
+	return nil
+}
+
+func newBatchDevice(conn Conn) *regDevice {
+	d := &regDevice{conn: conn, mu: &sync.Mutex{}, regs: map[string]*RegisterSpec{}}
+	for _, r := range []RegisterSpec{
+		{Name: "a", Address: 0x10, Access: AccessRW},
+		{Name: "b", Address: 0x11, Access: AccessRW},
+		{Name: "c", Address: 0x12, Access: AccessRW},
+		{Name: "id", Address: 0x13, Access: AccessRO},
+	} {
+		if err := r.normalize(); err != nil {
+			panic(err)
+		}
+		d.regs[r.Name] = &r
+	}
+	return d
+}
+
+func TestRunBatchCompensation(t *testing.T) {
+	raw := func(v int64) *int64 { return &v }
+	write := func(reg string, v int64) BatchOp { return BatchOp{Op: "write", Register: reg, Raw: raw(v)} }
+
+	tests := []struct {
+		name       string
+		req        BatchRequest
+		fail       []string
+		stuck      []byte
+		verify     bool
+		wantFailed int
+		wantStatus []string
+		wantMem    map[byte]byte
+	}{
+		{
+			name:       "all ok",
+			req:        BatchRequest{Ops: []BatchOp{write("a", 10), write("b", 20)}, Restore: true},
+			wantFailed: -1,
+			wantStatus: []string{"ok", "ok"},
+			wantMem:    map[byte]byte{0x10: 10, 0x11: 20, 0x12: 3},
+		},
+		{
+			name:       "restore previous values in reverse",
+			req:        BatchRequest{Ops: []BatchOp{{Op: "read", Register: "id"}, write("a", 10), write("c", 30), write("b", 20), write("c", 31)}, Restore: true},
+			fail:       []string{"11=14"},
+			wantFailed: 3,
+			wantStatus: []string{"ok", "compensated", "compensated", "failed", "skipped"},
+			wantMem:    map[byte]byte{0x10: 1, 0x11: 2, 0x12: 3},
+		},
+		{
+			name: "explicit compensate",
+			req: BatchRequest{Ops: []BatchOp{
+				{Op: "write", Register: "a", Raw: raw(10), Compensate: &BatchAction{Raw: raw(0)}},
+				write("b", 20),
+			}},
+			fail:       []string{"11=14"},
+			wantFailed: 1,
+			wantStatus: []string{"compensated", "failed"},
+			wantMem:    map[byte]byte{0x10: 0, 0x11: 2, 0x12: 3},
+		},
+		{
+			name:       "no compensation without restore",
+			req:        BatchRequest{Ops: []BatchOp{write("a", 10), write("b", 20)}},
+			fail:       []string{"11=14"},
+			wantFailed: 1,
+			wantStatus: []string{"ok", "failed"},
+			wantMem:    map[byte]byte{0x10: 10, 0x11: 2, 0x12: 3},
+		},
+		{
+			// verify 失敗時寫入可能已部分生效，失敗的那一步也要補償
+			name:       "verify failure compensates the failed step",
+			req:        BatchRequest{Ops: []BatchOp{write("a", 10), write("b", 20)}, Restore: true},
+			stuck:      []byte{0x11},
+			verify:     true,
+			wantFailed: 1,
+			wantStatus: []string{"compensated", "failed"},
+			wantMem:    map[byte]byte{0x10: 1, 0x11: 2, 0x12: 3},
+		},
+		{
+			name:       "compensation failure is reported",
+			req:        BatchRequest{Ops: []BatchOp{write("a", 10), write("b", 20)}, Restore: true},
+			fail:       []string{"11=14", "10=01"},
+			wantFailed: 1,
+			wantStatus: []string{"compensation_failed", "failed"},
+			wantMem:    map[byte]byte{0x10: 10, 0x11: 2, 0x12: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &fakeRegs{mem: map[byte]byte{0x10: 1, 0x11: 2, 0x12: 3, 0x13: 0x42}, fail: map[string]bool{}, stuck: map[byte]bool{}}
+			for _, f := range tt.fail {
+				conn.fail[f] = true
+			}
+			for _, r := range tt.stuck {
+				conn.stuck[r] = true
+			}
+			d := newBatchDevice(conn)
+
+			steps, err := planBatch(d, tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			results, failed, err := runBatch(context.Background(), d, steps, tt.verify)
+			if failed != tt.wantFailed || (err != nil) != (tt.wantFailed >= 0) {
+				t.Fatalf("failed = %d err = %v, want failed %d", failed, err, tt.wantFailed)
+			}
+			var status []string
+			for _, r := range results {
+				status = append(status, r.Status)
+			}
+			if !reflect.DeepEqual(status, tt.wantStatus) {
+				t.Fatalf("status = %v, want %v", status, tt.wantStatus)
+			}
+			for reg, want := range tt.wantMem {
+				if got := conn.mem[reg]; got != want {
+					t.Fatalf("reg 0x%02x = %d, want %d", reg, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanBatchRejects(t *testing.T) {
+	d := newBatchDevice(&fakeRegs{mem: map[byte]byte{}})
+	raw := func(v int64) *int64 { return &v }
+
+	tests := []struct {
+		name string
+		ops  []BatchOp
+	}{
+		{"empty", nil},
+		{"unknown register", []BatchOp{{Op: "read", Register: "nope"}}},
+		{"write read-only", []BatchOp{{Op: "write", Register: "id", Raw: raw(1)}}},
+		{"raw out of range", []BatchOp{{Op: "write", Register: "a", Raw: raw(256)}}},
+		{"bad compensate", []BatchOp{{Op: "write", Register: "a", Raw: raw(1), Compensate: &BatchAction{Raw: raw(-1)}}}},
+		{"unknown op", []BatchOp{{Op: "toggle", Register: "a"}}},
+		{"too many ops", make([]BatchOp, maxBatchOps+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := planBatch(d, BatchRequest{Ops: tt.ops}); err == nil {
+				t.Fatal("expected the batch to be rejected")
+			}
+		})
+	}
+}
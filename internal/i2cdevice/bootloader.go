@@ -0,0 +1,207 @@
+package i2cdevice
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// STM32 system bootloader 的 I2C 協定（ST AN4221）
+const (
+	blAck  = 0x79
+	blNack = 0x1F
+	blBusy = 0x76
+
+	blCmdGetID    = 0x02
+	blCmdRead     = 0x11
+	blCmdGo       = 0x21
+	blCmdWrite    = 0x31
+	blCmdExtErase = 0x44
+
+	blMaxChunk     = 256 // Read / Write Memory 單次上限
+	blMaxErasePage = 64  // 每次 Extended Erase 送出的頁數
+)
+
+var (
+	ErrBootloaderNack = errors.New("bootloader NACK")
+	ErrBootloaderBusy = errors.New("bootloader busy timeout")
+)
+
+// bootConn 是 bootloader 位址上的原始讀寫，*i2c.Device 即為實作
+type bootConn interface {
+	Read(buf []byte) error
+	Write(buf []byte) error
+	Close() error
+}
+
+// stm32Boot 實作 bootloader 指令；每個指令都是 cmd + ~cmd，之後等待 ACK
+type stm32Boot struct {
+	conn       bootConn
+	ackTimeout time.Duration // 一般指令等待 ACK 的上限
+	busyPoll   time.Duration // 收到 BUSY 時重新讀取的間隔
+}
+
+func newSTM32Boot(conn bootConn) *stm32Boot {
+	return &stm32Boot{conn: conn, ackTimeout: time.Second, busyPoll: 2 * time.Millisecond}
+}
+
+func xorSum(b []byte) byte {
+	var x byte
+	for _, v := range b {
+		x ^= v
+	}
+	return x
+}
+
+// waitAck 讀取 ACK / NACK，BUSY 時持續輪詢直到 timeout
+func (b *stm32Boot) waitAck(ctx context.Context, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	buf := make([]byte, 1)
+	for {
+		if err := b.conn.Read(buf); err != nil {
+			return err
+		}
+		switch buf[0] {
+		case blAck:
+			return nil
+		case blNack:
+			return ErrBootloaderNack
+		case blBusy:
+		default:
+			return fmt.Errorf("bootloader: unexpected response 0x%02x", buf[0])
+		}
+
+		if time.Now().After(deadline) {
+			return ErrBootloaderBusy
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(b.busyPoll):
+		}
+	}
+}
+
+func (b *stm32Boot) command(ctx context.Context, cmd byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := b.conn.Write([]byte{cmd, ^cmd}); err != nil {
+		return err
+	}
+	if err := b.waitAck(ctx, b.ackTimeout); err != nil {
+		return fmt.Errorf("command 0x%02x: %w", cmd, err)
+	}
+	return nil
+}
+
+// sendAddr 送出 4 bytes big-endian 位址與 XOR checksum
+func (b *stm32Boot) sendAddr(ctx context.Context, addr uint32) error {
+	buf := make([]byte, 5)
+	binary.BigEndian.PutUint32(buf, addr)
+	buf[4] = xorSum(buf[:4])
+	if err := b.conn.Write(buf); err != nil {
+		return err
+	}
+	if err := b.waitAck(ctx, b.ackTimeout); err != nil {
+		return fmt.Errorf("address 0x%08x: %w", addr, err)
+	}
+	return nil
+}
+
+// GetID 回傳 product ID，可用來確認 bootloader 已就緒
+func (b *stm32Boot) GetID(ctx context.Context) (uint16, error) {
+	if err := b.command(ctx, blCmdGetID); err != nil {
+		return 0, err
+	}
+	// N(=1) + PID 2 bytes + ACK
+	buf := make([]byte, 4)
+	if err := b.conn.Read(buf); err != nil {
+		return 0, err
+	}
+	if buf[0] != 1 || buf[3] != blAck {
+		return 0, fmt.Errorf("bootloader: malformed GetID response % x", buf)
+	}
+	return binary.BigEndian.Uint16(buf[1:3]), nil
+}
+
+// ErasePages 以 Extended Erase 清除指定頁，flash 清除較慢，逾時另外計算
+func (b *stm32Boot) ErasePages(ctx context.Context, pages []uint16, timeout time.Duration) error {
+	for len(pages) > 0 {
+		n := min(len(pages), blMaxErasePage)
+		batch := pages[:n]
+		pages = pages[n:]
+
+		if err := b.command(ctx, blCmdExtErase); err != nil {
+			return err
+		}
+		buf := make([]byte, 2+2*n+1)
+		binary.BigEndian.PutUint16(buf, uint16(n-1))
+		for i, p := range batch {
+			binary.BigEndian.PutUint16(buf[2+2*i:], p)
+		}
+		buf[len(buf)-1] = xorSum(buf[:len(buf)-1])
+		if err := b.conn.Write(buf); err != nil {
+			return err
+		}
+		if err := b.waitAck(ctx, timeout); err != nil {
+			return fmt.Errorf("erase pages %d-%d: %w", batch[0], batch[n-1], err)
+		}
+	}
+	return nil
+}
+
+// WriteMemory 寫入最多 256 bytes，長度須為 4 的倍數
+func (b *stm32Boot) WriteMemory(ctx context.Context, addr uint32, data []byte) error {
+	if len(data) == 0 || len(data) > blMaxChunk || len(data)%4 != 0 {
+		return fmt.Errorf("bootloader: invalid write length %d", len(data))
+	}
+	if err := b.command(ctx, blCmdWrite); err != nil {
+		return err
+	}
+	if err := b.sendAddr(ctx, addr); err != nil {
+		return err
+	}
+	buf := make([]byte, 0, len(data)+2)
+	buf = append(buf, byte(len(data)-1))
+	buf = append(buf, data...)
+	buf = append(buf, xorSum(buf))
+	if err := b.conn.Write(buf); err != nil {
+		return err
+	}
+	if err := b.waitAck(ctx, b.ackTimeout); err != nil {
+		return fmt.Errorf("write 0x%08x: %w", addr, err)
+	}
+	return nil
+}
+
+// ReadMemory 讀取最多 256 bytes
+func (b *stm32Boot) ReadMemory(ctx context.Context, addr uint32, buf []byte) error {
+	if len(buf) == 0 || len(buf) > blMaxChunk {
+		return fmt.Errorf("bootloader: invalid read length %d", len(buf))
+	}
+	if err := b.command(ctx, blCmdRead); err != nil {
+		return err
+	}
+	if err := b.sendAddr(ctx, addr); err != nil {
+		return err
+	}
+	n := byte(len(buf) - 1)
+	if err := b.conn.Write([]byte{n, ^n}); err != nil {
+		return err
+	}
+	if err := b.waitAck(ctx, b.ackTimeout); err != nil {
+		return fmt.Errorf("read 0x%08x: %w", addr, err)
+	}
+	return b.conn.Read(buf)
+}
+
+// Go 跳到 addr 執行（應用程式的 vector table）
+func (b *stm32Boot) Go(ctx context.Context, addr uint32) error {
+	if err := b.command(ctx, blCmdGo); err != nil {
+		return err
+	}
+	return b.sendAddr(ctx, addr)
+}
@@ -0,0 +1,242 @@
+package i2cdevice
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// simBootloader 在記憶體中模擬 STM32 I2C bootloader（FW_TARGET=sim），
+// 協定層與真實硬體走同一套程式碼，flash 內容在多次更新之間保留
+type simBootloader struct {
+	mu sync.Mutex
+
+	base       uint32
+	pageSize   int
+	flash      []byte
+	pid        uint16
+	writeDelay time.Duration // 每次 Write Memory 回 BUSY 的時間
+	eraseDelay time.Duration // 每頁 erase 回 BUSY 的時間
+
+	cmd     byte
+	stage   int
+	addr    uint32
+	out     []byte    // 等待 master 讀取的資料
+	pending []byte    // busy 結束後才放進 out 的 ACK
+	readyAt time.Time // busy 結束時間
+	jumping bool      // Go 的 ACK 被讀走後才真正跳轉
+	running bool      // 跳轉後 bootloader 不再回應
+	jumpTo  uint32
+}
+
+var errSimNoData = errors.New("sim bootloader: nothing to read")
+
+func newSimBootloader(base uint32, size, pageSize int) *simBootloader {
+	flash := make([]byte, size)
+	for i := range flash {
+		flash[i] = 0xFF
+	}
+	return &simBootloader{
+		base:       base,
+		pageSize:   pageSize,
+		flash:      flash,
+		pid:        0x0440,
+		writeDelay: time.Millisecond,
+		eraseDelay: 2 * time.Millisecond,
+	}
+}
+
+// reset 模擬裝置重開進 bootloader
+func (s *simBootloader) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stage, s.out, s.pending, s.jumping, s.running = 0, nil, nil, false, false
+}
+
+func (s *simBootloader) Close() error { return nil }
+
+func (s *simBootloader) Read(buf []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return syscall.ENXIO
+	}
+	if s.pending != nil {
+		if time.Now().Before(s.readyAt) {
+			buf[0] = blBusy
+			return nil
+		}
+		s.out = append(s.out, s.pending...)
+		s.pending = nil
+	}
+	if len(s.out) < len(buf) {
+		return errSimNoData
+	}
+	copy(buf, s.out)
+	s.out = s.out[len(buf):]
+	if s.jumping && len(s.out) == 0 {
+		s.jumping, s.running = false, true
+	}
+	return nil
+}
+
+func (s *simBootloader) Write(buf []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return syscall.ENXIO
+	}
+	if err := s.handle(buf); err != nil {
+		s.stage = 0
+		s.out = append(s.out, blNack)
+	}
+	return nil
+}
+
+func (s *simBootloader) ack(delay time.Duration) {
+	if delay <= 0 {
+		s.out = append(s.out, blAck)
+		return
+	}
+	s.pending = []byte{blAck}
+	s.readyAt = time.Now().Add(delay)
+}
+
+// inFlash 檢查 [addr, addr+n) 是否落在 flash 內，回傳 offset
+func (s *simBootloader) inFlash(addr uint32, n int) (int, error) {
+	if addr < s.base || int(addr-s.base)+n > len(s.flash) {
+		return 0, fmt.Errorf("address 0x%08x out of range", addr)
+	}
+	return int(addr - s.base), nil
+}
+
+func (s *simBootloader) handle(buf []byte) error {
+	switch s.stage {
+	case 0:
+		if len(buf) != 2 || buf[1] != ^buf[0] {
+			return errors.New("bad command frame")
+		}
+		s.cmd = buf[0]
+		switch s.cmd {
+		case blCmdGetID:
+			s.ack(0)
+			s.out = append(s.out, 1, byte(s.pid>>8), byte(s.pid), blAck)
+		case blCmdRead, blCmdWrite, blCmdGo, blCmdExtErase:
+			s.ack(0)
+			s.stage = 1
+		default:
+			return errors.New("unsupported command")
+		}
+		return nil
+
+	case 1:
+		if s.cmd == blCmdExtErase {
+			s.stage = 0
+			return s.erase(buf)
+		}
+		if len(buf) != 5 || xorSum(buf[:4]) != buf[4] {
+			return errors.New("bad address frame")
+		}
+		s.addr = binary.BigEndian.Uint32(buf)
+		if _, err := s.inFlash(s.addr, 1); err != nil {
+			return err
+		}
+		s.ack(0)
+		if s.cmd == blCmdGo {
+			s.stage, s.jumping, s.jumpTo = 0, true, s.addr
+			return nil
+		}
+		s.stage = 2
+		return nil
+
+	case 2:
+		s.stage = 0
+		if s.cmd == blCmdRead {
+			if len(buf) != 2 || buf[1] != ^buf[0] {
+				return errors.New("bad length frame")
+			}
+			n := int(buf[0]) + 1
+			off, err := s.inFlash(s.addr, n)
+			if err != nil {
+				return err
+			}
+			s.ack(0)
+			s.out = append(s.out, s.flash[off:off+n]...)
+			return nil
+		}
+
+		// Write Memory：N-1、資料、checksum
+		if len(buf) < 3 || len(buf) != int(buf[0])+3 || xorSum(buf[:len(buf)-1]) != buf[len(buf)-1] {
+			return errors.New("bad data frame")
+		}
+		data := buf[1 : len(buf)-1]
+		off, err := s.inFlash(s.addr, len(data))
+		if err != nil {
+			return err
+		}
+		// NOR flash 只能把 1 寫成 0，沒先 erase 的位置讀回會不一致
+		for i, v := range data {
+			s.flash[off+i] &= v
+		}
+		s.ack(s.writeDelay)
+		return nil
+	}
+	return errors.New("bad state")
+}
+
+func (s *simBootloader) erase(buf []byte) error {
+	if len(buf) < 3 || xorSum(buf[:len(buf)-1]) != buf[len(buf)-1] {
+		return errors.New("bad erase frame")
+	}
+	n := int(binary.BigEndian.Uint16(buf)) + 1
+	if len(buf) != 2+2*n+1 {
+		return errors.New("bad erase length")
+	}
+	pages := len(s.flash) / s.pageSize
+	for i := 0; i < n; i++ {
+		p := int(binary.BigEndian.Uint16(buf[2+2*i:]))
+		if p >= pages {
+			return fmt.Errorf("page %d out of range", p)
+		}
+		for j := p * s.pageSize; j < (p+1)*s.pageSize; j++ {
+			s.flash[j] = 0xFF
+		}
+	}
+	s.ack(time.Duration(n) * s.eraseDelay)
+	return nil
+}
+
+// simTarget 以 simBootloader 取代實際的 STM32
+type simTarget struct {
+	sim *simBootloader
+}
+
+func (t simTarget) Enter(context.Context) (bootConn, error) {
+	t.sim.reset()
+	return t.sim, nil
+}
+
+// Exclusive 模擬器與實際裝置無關，更新期間不影響 LED
+func (simTarget) Exclusive() bool { return false }
+
+// Probe 檢查是否已跳回應用程式，且 reset vector 指向 flash 內
+func (t simTarget) Probe(context.Context) error {
+	s := t.sim
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running || s.jumpTo != s.base {
+		return errors.New("sim: application not started")
+	}
+	reset := binary.LittleEndian.Uint32(s.flash[4:8])
+	if _, err := s.inFlash(reset&^1, 2); err != nil {
+		return fmt.Errorf("sim: reset vector 0x%08x: %w", reset, err)
+	}
+	return nil
+}
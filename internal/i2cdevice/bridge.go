@@ -0,0 +1,68 @@
+package i2cdevice
+
+import (
+	"context"
+	"errors"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/events"
+)
+
+const SourceMQTT = "mqtt"
+
+// Bridge 讓 HTTP 以外的入口（例如 MQTT）共用 LED 的驗證、寫入流程與事件
+type Bridge struct{}
+
+// NewBridge 在 I2C 裝置未初始化時回傳 false
+func NewBridge() (*Bridge, bool) {
+	if i2cDev == nil {
+		return nil, false
+	}
+	return &Bridge{}, true
+}
+
+// CommandResult 是非 HTTP 入口的執行結果，欄位對應 POST /led 的回應
+type CommandResult struct {
+	OK    bool      `json:"ok"`
+	State *LedState `json:"state,omitempty"`
+	Error string    `json:"error,omitempty"`
+	Code  string    `json:"code,omitempty"`
+}
+
+func (*Bridge) Events() *events.Hub { return ledEvents }
+
+// State 回傳目前的期望狀態與裝置可用狀態
+func (*Bridge) State() (LedState, bool) {
+	availMu.Lock()
+	up := available
+	availMu.Unlock()
+	return currentState(), up
+}
+
+// Command 以與 POST /led 相同的格式與驗證執行指令
+func (*Bridge) Command(ctx context.Context, payload []byte, source string) CommandResult {
+	st, verify, err := decodeCommand(payload)
+	if err == nil {
+		err = setLed(ctx, st, verify, source)
+	}
+	if err != nil {
+		return CommandResult{Error: err.Error(), Code: errorCode(err)}
+	}
+	return CommandResult{OK: true, State: &st}
+}
+
+// errorCode 對應 HTTP API 回應中的 code 欄位
+func errorCode(err error) string {
+	var txErr *TxError
+	var vErr *VerifyError
+	switch {
+	case errors.As(err, &txErr):
+		return txErr.Code()
+	case errors.As(err, &vErr):
+		return "verify_mismatch"
+	case errors.Is(err, ErrUnsupported):
+		return "unsupported"
+	case errors.Is(err, ErrInvalidCommand):
+		return "invalid_command"
+	}
+	return "i2c_error"
+}
@@ -0,0 +1,100 @@
+package i2cdevice
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/events"
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// 事件來源
+const (
+	SourceAPI       = "api"
+	SourceScheduler = "scheduler"
+	SourceReconcile = "reconcile"
+	SourceFirmware  = "firmware"
+)
+
+const (
+	EventState        = "state"
+	EventAvailability = "availability"
+)
+
+var (
+	ledEvents = events.NewHubFromEnv()
+
+	availMu        sync.Mutex
+	available      = true
+	availListeners []func(up bool, err error)
+)
+
+type stateEvent struct {
+	State    LedState  `json:"state"`
+	Previous *LedState `json:"previous,omitempty"`
+}
+
+type availabilityEvent struct {
+	Available bool   `json:"available"`
+	Error     string `json:"error,omitempty"`
+}
+
+func publishState(source string, prev *LedState, st LedState) {
+	ledEvents.Publish(EventState, source, stateEvent{State: st, Previous: prev})
+}
+
+// updateAvailability 依 transaction 結果更新裝置可用狀態，狀態改變時推送事件；
+// timeout / cancel 無法判斷裝置狀態，不列入計算
+func updateAvailability(err error) {
+	up := true
+	if err != nil {
+		var txErr *TxError
+		if !errors.As(err, &txErr) {
+			return
+		}
+		switch txErr.Class {
+		case ClassTransient, ClassUnavailable:
+			up = false
+		default:
+			return
+		}
+	}
+
+	availMu.Lock()
+	changed := available != up
+	available = up
+	fns := availListeners
+	availMu.Unlock()
+	if !changed {
+		return
+	}
+
+	ev := availabilityEvent{Available: up}
+	if err != nil {
+		ev.Error = err.Error()
+		logger.Error(fmt.Sprintf("[I2C] device became unavailable: %v", err))
+	} else {
+		logger.Info("[I2C] device available again")
+	}
+	ledEvents.Publish(EventAvailability, "i2c", ev)
+	for _, fn := range fns {
+		fn(up, err)
+	}
+}
+
+// OnAvailabilityChange 註冊裝置可用狀態改變時的 callback（例如送出 Kubernetes Event）
+func OnAvailabilityChange(fn func(up bool, err error)) {
+	availMu.Lock()
+	defer availMu.Unlock()
+	availListeners = append(availListeners, fn)
+}
+
+func ledEventsSSE(c *gin.Context) {
+	events.ServeSSE(c, ledEvents)
+}
+
+func ledEventsWS(c *gin.Context) {
+	events.ServeWS(c, ledEvents)
+}
@@ -0,0 +1,496 @@
+package i2cdevice
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/audit"
+	"github.com/HarrisonZz/web_server_in_go/internal/events"
+	"github.com/HarrisonZz/web_server_in_go/internal/handler"
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	"github.com/HarrisonZz/web_server_in_go/internal/util"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/io/i2c"
+)
+
+// 韌體更新相關設定，預設值對應 STM32F0（1 KiB page、64 KiB flash）
+var (
+	fwTargetKind    = util.Getenv("FW_TARGET", "i2c") // i2c | sim
+	fwBootAddr      = int(envUint("I2C_BOOTLOADER_ADDR", 0x56))
+	fwFlashBase     = uint32(envUint("FW_FLASH_BASE", 0x08000000))
+	fwFlashSize     = envInt("FW_FLASH_SIZE", 64*1024)
+	fwPageSize      = envInt("FW_PAGE_SIZE", 1024)
+	fwBootTimeout   = envDuration("FW_BOOT_TIMEOUT", 3*time.Second)
+	fwEraseTimeout  = envDuration("FW_ERASE_TIMEOUT", 30*time.Second)
+	fwUpdateTimeout = envDuration("FW_UPDATE_TIMEOUT", 5*time.Minute)
+
+	fwEvents = events.NewHubFromEnv()
+
+	// fwBusy 期間 primary 裝置的 transaction 直接回 unavailable，bootloader 獨佔 STM32
+	fwBusy atomic.Bool
+
+	fwMu  sync.Mutex
+	fwJob *FirmwareJob
+	fwTgt firmwareTarget
+
+	ErrFirmwareUpdating = fmt.Errorf("%w: firmware update in progress", ErrDeviceUnavailable)
+	ErrVerifyFailed     = errors.New("firmware read-back mismatch")
+)
+
+// BootloaderEnter 是應用程式韌體的暫存器，寫入 bootMagic 後重開進 system bootloader
+const (
+	BootloaderEnter = 0x07
+	bootMagic       = 0xB0
+)
+
+// 韌體更新階段，也是 SSE 的事件類型
+const (
+	PhaseReceived  = "received"
+	PhaseEntering  = "entering"
+	PhaseErasing   = "erasing"
+	PhaseWriting   = "writing"
+	PhaseVerifying = "verifying"
+	PhaseStarting  = "starting"
+	PhaseProbing   = "probing"
+	PhaseDone      = "done"
+	PhaseFailed    = "failed"
+)
+
+// firmwareTarget 負責讓裝置進出 bootloader；實際硬體與模擬器各有一個實作
+type firmwareTarget interface {
+	Enter(ctx context.Context) (bootConn, error)
+	Probe(ctx context.Context) error
+	// Exclusive 為 true 時更新期間獨佔 primary 裝置：停掉 sequencer、擋下 transaction，完成後重新套用 LED
+	Exclusive() bool
+}
+
+// FirmwareJob 是一次更新的狀態，同時作為進度事件的內容
+type FirmwareJob struct {
+	ID         string     `json:"id"`
+	Device     string     `json:"device"`
+	Filename   string     `json:"filename,omitempty"`
+	Size       int        `json:"size"`
+	SHA256     string     `json:"sha256"`
+	Phase      string     `json:"phase"`
+	Done       int        `json:"done"`
+	Total      int        `json:"total"`
+	Percent    int        `json:"percent"`
+	ProductID  string     `json:"product_id,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+func (j *FirmwareJob) running() bool {
+	return j.Phase != PhaseDone && j.Phase != PhaseFailed
+}
+
+// progress 更新階段與進度，階段改變或百分比變動時推送事件
+func progress(phase string, done, total int) {
+	fwMu.Lock()
+	j := fwJob
+	pct := 0
+	if total > 0 {
+		pct = done * 100 / total
+	}
+	changed := j.Phase != phase || j.Percent != pct
+	j.Phase, j.Done, j.Total, j.Percent = phase, done, total, pct
+	snap := *j
+	fwMu.Unlock()
+
+	if changed {
+		fwEvents.Publish(phase, SourceAPI, snap)
+	}
+}
+
+func currentJob() *FirmwareJob {
+	fwMu.Lock()
+	defer fwMu.Unlock()
+	if fwJob == nil {
+		return nil
+	}
+	j := *fwJob
+	return &j
+}
+
+// registerFirmwareRoutes 依 FW_TARGET 選擇實作；實際硬體需要已開啟的 STM32
+func registerFirmwareRoutes() {
+	switch fwTargetKind {
+	case "sim":
+		fwTgt = simTarget{sim: newSimBootloader(fwFlashBase, fwFlashSize, fwPageSize)}
+		logger.Info("Firmware update using simulated bootloader")
+	case "i2c":
+		if i2cDev == nil {
+			logger.Info("Skipping firmware update routes (I2C device not found)")
+			return
+		}
+		fwTgt = i2cTarget{}
+	default:
+		logger.Error(fmt.Sprintf("Skipping firmware update routes: unknown FW_TARGET %q", fwTargetKind))
+		return
+	}
+
+	handler.RegisterRoute(http.MethodPost, "/devices/:name/firmware", startFirmwareUpdate)
+	handler.RegisterRoute(http.MethodGet, "/devices/:name/firmware", getFirmwareJob)
+	handler.RegisterRoute(http.MethodGet, "/devices/:name/firmware/events", firmwareEventsSSE)
+}
+
+// i2cTarget 透過應用程式暫存器切換到 bootloader 位址
+type i2cTarget struct{}
+
+func (i2cTarget) Enter(ctx context.Context) (bootConn, error) {
+	// 裝置可能在回 ACK 前就重開，或本來就停在 bootloader（上次更新失敗），錯誤只記錄
+	mu.Lock()
+	err := i2cDev.WriteReg(BootloaderEnter, []byte{bootMagic})
+	mu.Unlock()
+	if err != nil {
+		logger.WarnCtx(ctx, fmt.Sprintf("[FW] enter bootloader write failed, trying bootloader anyway: %v", err))
+	}
+	return i2c.Open(&i2c.Devfs{Dev: defaultBus}, fwBootAddr)
+}
+
+func (i2cTarget) Exclusive() bool { return true }
+
+// Probe 在應用程式重新啟動後讀取 LED 狀態與能力；此時 fwBusy 已解除
+func (i2cTarget) Probe(ctx context.Context) error {
+	buf := make([]byte, 1)
+	mu.Lock()
+	defer mu.Unlock()
+	if err := readReg(ctx, LedQuery, buf); err != nil {
+		return err
+	}
+	probeCapabilities()
+	return nil
+}
+
+// checkImage 檢查 vector table：初始 SP 應在 SRAM，reset vector 應在 flash 內
+func checkImage(img []byte) error {
+	if len(img) < 8 {
+		return errors.New("image too small for a vector table")
+	}
+	sp := binary.LittleEndian.Uint32(img[0:4])
+	reset := binary.LittleEndian.Uint32(img[4:8]) &^ 1
+	if sp&0xFF000000 != 0x20000000 {
+		return fmt.Errorf("initial stack pointer 0x%08x is not in SRAM", sp)
+	}
+	if reset < fwFlashBase || reset >= fwFlashBase+uint32(fwFlashSize) {
+		return fmt.Errorf("reset vector 0x%08x is outside flash", reset)
+	}
+	return nil
+}
+
+func startFirmwareUpdate(c *gin.Context) {
+	span := trace.SpanFromContext(c.Request.Context())
+
+	if c.Param("name") != deviceName {
+		c.JSON(http.StatusNotFound, gin.H{"error": "device not found", "code": "not_found"})
+		return
+	}
+
+	// multipart 額外的欄位與 boundary 預留 64 KiB
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(fwFlashSize)+64*1024)
+	file, hdr, err := c.Request.FormFile("image")
+	if err != nil {
+		status := http.StatusBadRequest
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, gin.H{"error": fmt.Sprintf("multipart field \"image\" is required: %v", err), "code": "invalid_image"})
+		return
+	}
+	defer file.Close()
+
+	img, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_image"})
+		return
+	}
+	switch {
+	case len(img) == 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image is empty", "code": "invalid_image"})
+		return
+	case len(img) > fwFlashSize:
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("image is %d bytes, flash is %d bytes", len(img), fwFlashSize),
+			"code":  "image_too_large",
+		})
+		return
+	}
+
+	sum := sha256.Sum256(img)
+	digest := hex.EncodeToString(sum[:])
+	if want := strings.ToLower(strings.TrimSpace(c.PostForm("sha256"))); want != "" && want != digest {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":  "sha256 does not match the uploaded image",
+			"code":   "checksum_mismatch",
+			"sha256": digest,
+		})
+		return
+	}
+	if force, _ := strconv.ParseBool(c.PostForm("force")); !force {
+		if err := checkImage(img); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "code": "invalid_image"})
+			return
+		}
+	}
+
+	fwMu.Lock()
+	if fwJob != nil && fwJob.running() {
+		id := fwJob.ID
+		fwMu.Unlock()
+		c.JSON(http.StatusConflict, gin.H{"error": "firmware update already in progress", "code": "update_in_progress", "job": id})
+		return
+	}
+	now := time.Now().UTC()
+	job := &FirmwareJob{
+		ID:        strconv.FormatInt(now.UnixNano(), 36),
+		Device:    deviceName,
+		Filename:  hdr.Filename,
+		Size:      len(img),
+		SHA256:    digest,
+		Phase:     PhaseReceived,
+		StartedAt: now,
+	}
+	fwJob = job
+	snap := *job
+	fwMu.Unlock()
+
+	fwEvents.Publish(PhaseReceived, SourceAPI, snap)
+	span.SetAttributes(
+		attribute.String("firmware.job", job.ID),
+		attribute.Int("firmware.size", len(img)),
+		attribute.String("firmware.sha256", digest),
+	)
+	logger.InfoCtx(c.Request.Context(), fmt.Sprintf("[FW] update %s accepted size=%d sha256=%s from=%s", job.ID, len(img), digest, c.ClientIP()))
+
+	// 更新在背景執行，不隨 request 結束而取消，但保留 trace 與 client 身分
+	ctx := trace.ContextWithSpanContext(context.Background(), span.SpanContext())
+	if a, ok := audit.ActorFrom(c.Request.Context()); ok {
+		ctx = audit.WithActor(ctx, a)
+	}
+	go runFirmwareUpdate(ctx, job.ID, img)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"job":    snap,
+		"events": fmt.Sprintf("/devices/%s/firmware/events", deviceName),
+	})
+}
+
+func getFirmwareJob(c *gin.Context) {
+	if c.Param("name") != deviceName {
+		c.JSON(http.StatusNotFound, gin.H{"error": "device not found", "code": "not_found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"device": deviceName, "job": currentJob()})
+}
+
+func firmwareEventsSSE(c *gin.Context) {
+	if c.Param("name") != deviceName {
+		c.JSON(http.StatusNotFound, gin.H{"error": "device not found", "code": "not_found"})
+		return
+	}
+	events.ServeSSE(c, fwEvents)
+}
+
+func runFirmwareUpdate(ctx context.Context, id string, img []byte) {
+	ctx, span := tracer.Start(ctx, "firmware.update", trace.WithAttributes(attribute.String("firmware.job", id)))
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, fwUpdateTimeout)
+	defer cancel()
+	start := time.Now()
+
+	// 停掉 sequencer；等進行中的 transaction 結束後才讓 bootloader 接手。
+	// 模擬器不碰實際的 STM32，LED 與 transaction 照常運作
+	exclusive := fwTgt.Exclusive()
+	if exclusive {
+		cmdMu.Lock()
+		stopSequencer()
+		mu.Lock()
+		fwBusy.Store(true)
+		mu.Unlock()
+		cmdMu.Unlock()
+	}
+
+	err := flashImage(ctx, img)
+	if exclusive {
+		fwBusy.Store(false)
+	}
+	if err == nil {
+		err = probeAfterUpdate(ctx)
+	}
+
+	fwMu.Lock()
+	now := time.Now().UTC()
+	fwJob.FinishedAt = &now
+	if err != nil {
+		fwJob.Phase, fwJob.Error = PhaseFailed, err.Error()
+	} else {
+		fwJob.Phase = PhaseDone
+	}
+	snap := *fwJob
+	fwMu.Unlock()
+	fwEvents.Publish(snap.Phase, SourceAPI, snap)
+
+	result, msg := audit.Result(err)
+	audit.Record(ctx, audit.Entry{
+		Source: SourceAPI, Device: snap.Device, Operation: "firmware.update", Target: snap.ID,
+		New: gin.H{"sha256": snap.SHA256, "size": snap.Size, "filename": snap.Filename}, Result: result, Error: msg,
+	})
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "firmware update failed")
+		logger.ErrorCtx(ctx, fmt.Sprintf("[FW] update %s failed phase=%s error=%v", id, snap.Phase, err))
+		return
+	}
+	logger.InfoCtx(ctx, fmt.Sprintf("[FW] update %s done size=%d duration=%v", id, len(img), time.Since(start)))
+	if exclusive {
+		resumeLed(ctx)
+	}
+}
+
+// flashImage 進入 bootloader → erase → 分段寫入 → 回讀比對 → 跳回應用程式
+func flashImage(ctx context.Context, img []byte) error {
+	span := trace.SpanFromContext(ctx)
+
+	// Write Memory 長度須為 4 的倍數，不足補 0xFF（等同未寫入）
+	if pad := len(img) % 4; pad != 0 {
+		img = append(img, bytes.Repeat([]byte{0xFF}, 4-pad)...)
+	}
+
+	progress(PhaseEntering, 0, 0)
+	conn, err := fwTgt.Enter(ctx)
+	if err != nil {
+		return fmt.Errorf("open bootloader: %w", err)
+	}
+	defer conn.Close()
+	bl := newSTM32Boot(conn)
+
+	// bootloader 重開需要時間，GetID 成功才算就緒
+	var pid uint16
+	deadline := time.Now().Add(fwBootTimeout)
+	for {
+		if pid, err = bl.GetID(ctx); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("bootloader not responding: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	fwMu.Lock()
+	fwJob.ProductID = fmt.Sprintf("0x%04x", pid)
+	fwMu.Unlock()
+	span.AddEvent("firmware.bootloader_ready", trace.WithAttributes(attribute.Int("stm32.pid", int(pid))))
+
+	pages := make([]uint16, (len(img)+fwPageSize-1)/fwPageSize)
+	for i := range pages {
+		pages[i] = uint16(i)
+	}
+	progress(PhaseErasing, 0, len(pages))
+	if err := bl.ErasePages(ctx, pages, fwEraseTimeout); err != nil {
+		return err
+	}
+	progress(PhaseErasing, len(pages), len(pages))
+
+	for off := 0; off < len(img); off += blMaxChunk {
+		end := min(off+blMaxChunk, len(img))
+		if err := bl.WriteMemory(ctx, fwFlashBase+uint32(off), img[off:end]); err != nil {
+			return err
+		}
+		progress(PhaseWriting, end, len(img))
+	}
+
+	buf := make([]byte, blMaxChunk)
+	for off := 0; off < len(img); off += blMaxChunk {
+		end := min(off+blMaxChunk, len(img))
+		got := buf[:end-off]
+		if err := bl.ReadMemory(ctx, fwFlashBase+uint32(off), got); err != nil {
+			return err
+		}
+		if i := firstDiff(got, img[off:end]); i >= 0 {
+			return fmt.Errorf("%w at 0x%08x: want 0x%02x got 0x%02x",
+				ErrVerifyFailed, fwFlashBase+uint32(off+i), img[off+i], got[i])
+		}
+		progress(PhaseVerifying, end, len(img))
+	}
+
+	progress(PhaseStarting, 0, 0)
+	return bl.Go(ctx, fwFlashBase)
+}
+
+func firstDiff(a, b []byte) int {
+	for i := range a {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return -1
+}
+
+// probeAfterUpdate 等應用程式啟動後重新探測裝置
+func probeAfterUpdate(ctx context.Context) error {
+	progress(PhaseProbing, 0, 0)
+	deadline := time.Now().Add(fwBootTimeout)
+	for {
+		err := fwTgt.Probe(ctx)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("device did not come back after update: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// resumeLed 裝置重開後暫存器回到預設值，重新套用更新前的期望狀態
+func resumeLed(ctx context.Context) {
+	if i2cDev == nil {
+		return
+	}
+	cmdMu.Lock()
+	defer cmdMu.Unlock()
+
+	mu.Lock()
+	if desired == nil {
+		mu.Unlock()
+		return
+	}
+	st := *desired
+	err := applyLed(ctx, st, verifyWrites)
+	mu.Unlock()
+	recordLed(ctx, SourceFirmware, nil, st, err)
+	if err != nil {
+		logger.ErrorCtx(ctx, fmt.Sprintf("[FW] restore LED state %s failed error=%v", st, err))
+		return
+	}
+	if !st.native() {
+		startSequencer(st)
+	}
+	publishState(SourceFirmware, nil, st)
+}
@@ -0,0 +1,153 @@
+package i2cdevice
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// faultTarget 在 simTarget 之上竄改第一個 Write Memory 資料 frame
+type faultTarget struct {
+	simTarget
+	corrupt func(frame []byte) // nil 表示不竄改
+	sawBusy *atomic.Bool       // 更新期間 fwBusy 是否被設起
+}
+
+func (t faultTarget) Enter(ctx context.Context) (bootConn, error) {
+	conn, err := t.simTarget.Enter(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &faultConn{bootConn: conn, t: t}, nil
+}
+
+type faultConn struct {
+	bootConn
+	t    faultTarget
+	done bool
+}
+
+func (c *faultConn) Write(buf []byte) error {
+	if fwBusy.Load() {
+		c.t.sawBusy.Store(true)
+	}
+	// 資料 frame：N-1、資料、checksum；address frame 以 0x08 開頭，長度對不上
+	if !c.done && c.t.corrupt != nil && len(buf) > 3 && len(buf) == int(buf[0])+3 {
+		c.done = true
+		buf = append([]byte(nil), buf...)
+		c.t.corrupt(buf)
+	}
+	return c.bootConn.Write(buf)
+}
+
+// testImage 產生 vector table 合法的映像：SP 在 SRAM、reset vector 在 flash 內
+func testImage(n int) []byte {
+	img := make([]byte, n)
+	for i := range img {
+		img[i] = byte(i * 7)
+	}
+	binary.LittleEndian.PutUint32(img[0:4], 0x20002000)
+	binary.LittleEndian.PutUint32(img[4:8], fwFlashBase+0x101)
+	return img
+}
+
+func uploadFirmware(t *testing.T, img []byte) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("image", "app.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(img)
+	mw.Close()
+
+	r := gin.New()
+	r.POST("/devices/:name/firmware", startFirmwareUpdate)
+	req := httptest.NewRequest(http.MethodPost, "/devices/"+deviceName+"/firmware", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("upload status = %d body=%s", w.Code, w.Body)
+	}
+}
+
+func waitJob(t *testing.T) *FirmwareJob {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if j := currentJob(); j != nil && !j.running() {
+			return j
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("firmware update did not finish")
+	return nil
+}
+
+func TestFirmwareUpdateSim(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	img := testImage(3000)
+
+	tests := []struct {
+		name      string
+		corrupt   func(frame []byte)
+		wantPhase string
+		wantErr   string
+	}{
+		{name: "ok", wantPhase: PhaseDone},
+		{
+			// 資料被改但 checksum 沒跟著改：bootloader 回 NACK
+			name:      "checksum mismatch",
+			corrupt:   func(f []byte) { f[1] ^= 0x01 },
+			wantPhase: PhaseFailed,
+			wantErr:   ErrBootloaderNack.Error(),
+		},
+		{
+			// checksum 正確但寫進 flash 的內容不同：回讀比對失敗
+			name: "read-back mismatch",
+			corrupt: func(f []byte) {
+				f[1] ^= 0x01
+				f[len(f)-1] = xorSum(f[:len(f)-1])
+			},
+			wantPhase: PhaseFailed,
+			wantErr:   ErrVerifyFailed.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim := newSimBootloader(fwFlashBase, fwFlashSize, fwPageSize)
+			var sawBusy atomic.Bool
+			fwTgt = faultTarget{simTarget: simTarget{sim: sim}, corrupt: tt.corrupt, sawBusy: &sawBusy}
+			t.Cleanup(func() { fwTgt, fwJob = nil, nil })
+
+			uploadFirmware(t, img)
+			j := waitJob(t)
+
+			if j.Phase != tt.wantPhase || !strings.Contains(j.Error, tt.wantErr) {
+				t.Fatalf("job phase=%s error=%q, want %s containing %q", j.Phase, j.Error, tt.wantPhase, tt.wantErr)
+			}
+			if sawBusy.Load() {
+				t.Fatal("sim update marked the primary device busy")
+			}
+			if tt.wantPhase == PhaseDone {
+				if j.ProductID != "0x0440" {
+					t.Fatalf("product id = %s", j.ProductID)
+				}
+				if !bytes.Equal(sim.flash[:len(img)], img) {
+					t.Fatal("flash does not match the image")
+				}
+			}
+		})
+	}
+}
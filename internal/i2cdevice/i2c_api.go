@@ -1,15 +1,17 @@
 package i2cdevice
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/HarrisonZz/web_server_in_go/internal/handler"
 	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	"github.com/HarrisonZz/web_server_in_go/internal/scheduler"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/exp/io/i2c"
@@ -19,8 +21,12 @@ const (
 	stm32Addr = 0x15
 
 	//Registers
-	LedCtrl  = 0x01
-	LedQuery = 0x02
+	LedCtrl       = 0x01
+	LedQuery      = 0x02
+	LedBrightness = 0x03 // PWM duty 0-255
+	LedBlink      = 0x04 // 4 bytes，見 BlinkSpec.encode；寫入 LedCtrl 會停止閃爍
+	LedPattern    = 0x05 // 內建 pattern id，0 表示無
+	LedCaps       = 0x06 // 唯讀，韌體能力 bitmask
 
 	//value
 	LED_ON  = 0x01
@@ -30,22 +36,51 @@ const (
 var (
 	i2cDev *i2c.Device
 	mu     sync.Mutex
+
+	tracer = otel.Tracer("web-server-in-go/i2cdevice")
 )
 
-func InitI2C() {
+// InitI2C 開啟 LED 所在的裝置並註冊路由；defaultMap 是 I2C_REGISTER_MAP 不存在時使用的 register map（YAML）
+func InitI2C(defaultMap []byte) {
 
 	logger.Info("I2C API initializing")
 
+	// register map 不依賴 LED 是否存在，其他裝置仍可透過 /devices 存取；
+	// 感測器的預設值來自 register map，所以在它之後載入
+	ledReady := false
+	defer func() {
+		registerFirmwareRoutes()
+		if err := initRegisterMap(defaultMap); err != nil {
+			logger.Error(fmt.Sprintf("Skipping register API: %v", err))
+		} else {
+			registerRegisterRoutes()
+		}
+		if !ledReady {
+			return
+		}
+		if err := loadSensors(); err != nil {
+			logger.Error(fmt.Sprintf("Skipping sensor sampling: %v", err))
+		} else {
+			handler.RegisterRoute(http.MethodGet, "/devices/:name/sensors", listSensors)
+			handler.RegisterRoute(http.MethodGet, "/devices/:name/sensors/:sensor", querySensor)
+		}
+	}()
+
 	var err error
-	i2cDev, err = i2c.Open(&i2c.Devfs{Dev: "/dev/i2c-2"}, stm32Addr)
+	i2cDev, err = i2c.Open(&i2c.Devfs{Dev: defaultBus}, stm32Addr)
 	if err != nil {
 		logger.Error("I2C Bus Open Failed !")
 		return
 	}
 	if err := probeI2CDevice(i2cDev); err == nil {
 
+		probeCapabilities()
 		handler.RegisterRoute(http.MethodPost, "/led", ledHandler)
 		handler.RegisterRoute(http.MethodGet, "/led", ledHandler)
+		handler.RegisterRoute(http.MethodGet, "/led/events", ledEventsSSE)
+		handler.RegisterRoute(http.MethodGet, "/led/ws", ledEventsWS)
+		scheduler.RegisterExecutor("led", ledExecutor{})
+		ledReady = true
 
 	} else {
 		logger.Info("Skipping /led route registration (I2C device not found)")
@@ -63,6 +98,22 @@ func probeI2CDevice(dev *i2c.Device) error {
 	return nil
 }
 
+// probeCapabilities 讀取 LedCaps，讀不到或值不合理時視為只支援 on / off 的舊韌體
+func probeCapabilities() {
+	buf := make([]byte, 1)
+	if err := i2cDev.ReadReg(LedCaps, buf); err != nil {
+		logger.Warn(fmt.Sprintf("LED capabilities unavailable, assuming on/off only: %v", err))
+		return
+	}
+	if buf[0]&^capMask != 0 {
+		logger.Warn(fmt.Sprintf("LED capabilities register returned 0x%02x, assuming on/off only", buf[0]))
+		return
+	}
+	caps = buf[0]
+	logger.Info(fmt.Sprintf("LED capabilities pwm=%t blink=%t pattern=%t",
+		caps&CapPWM != 0, caps&CapBlink != 0, caps&CapPattern != 0))
+}
+
 func ledHandler(c *gin.Context) {
 
 	span := trace.SpanFromContext(c.Request.Context())
@@ -88,41 +139,57 @@ func ledHandler(c *gin.Context) {
 
 func handleLedQuery(c *gin.Context) {
 
+	// 先取 sequencer 狀態（cmdMu 必須在 mu 之前取得）
+	_, seqRunning := sequencerRunning()
+
 	mu.Lock()
 	defer mu.Unlock()
 
 	// 讀取 1 byte
 	buf := make([]byte, 1)
-	if err := i2cDev.ReadReg(LedQuery, buf); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("I2C read failed: %v", err)})
+	if err := readReg(c.Request.Context(), LedQuery, buf); err != nil {
+		logger.ErrorCtx(c.Request.Context(), fmt.Sprintf(
+			"[LED] ReadReg failed error=%v from=%s",
+			err,
+			c.ClientIP(),
+		))
+		replyTxError(c, err)
 		return
 	}
 
-	var state string
-	switch buf[0] {
-
-	case 0x00:
-
-		state = "Off"
-
-	case 0x01:
-
-		state = "On"
+	state, known := decodeLedState(buf[0])
+	resp := gin.H{"LED State get": state, "raw": fmt.Sprintf("0x%02x", buf[0]), "known": known}
 
+	if !known {
+		span := trace.SpanFromContext(c.Request.Context())
+		span.AddEvent("led.unknown_value", trace.WithAttributes(attribute.Int("led.raw", int(buf[0]))))
+		logger.WarnCtx(c.Request.Context(), fmt.Sprintf("[LED] unknown register value raw=0x%02x from=%s", buf[0], c.ClientIP()))
+	}
+	if desired != nil {
+		resp["desired"] = desired
+		if desired.Mode == ModeOn || desired.Mode == ModeOff {
+			// 讀到無法解讀的值時，不能當成與 off 一致
+			resp["in_sync"] = known && (desired.Mode == ModeOn) == (buf[0] == LED_ON)
+		}
+	}
+	resp["sequencer"] = seqRunning
+	resp["capabilities"] = gin.H{
+		"pwm":             caps&CapPWM != 0,
+		"blink":           caps&CapBlink != 0,
+		"patterns":        patternNames(),
+		"native_patterns": caps&CapPattern != 0,
 	}
 
-	c.JSON(http.StatusOK, gin.H{"LED State get": state})
+	c.JSON(http.StatusOK, resp)
 }
 
 func handleLedSet(c *gin.Context) {
 	span := trace.SpanFromContext(c.Request.Context())
 	start := time.Now()
-	var req struct {
-		State string `json:"state"`
-	}
+	var req LedCommand
 
 	if err := c.BindJSON(&req); err != nil {
-		logger.Warn(fmt.Sprintf(
+		logger.WarnCtx(c.Request.Context(), fmt.Sprintf(
 			"[LED] %s invalid JSON from=%s error=%v",
 			c.FullPath(),
 			c.ClientIP(),
@@ -133,56 +200,60 @@ func handleLedSet(c *gin.Context) {
 		return
 	}
 
-	state := strings.ToLower(req.State)
-	var data byte
-
-	switch state {
-	case "on":
-		data = LED_ON
-	case "off":
-		data = LED_OFF
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "state must be 'on' or 'off'"})
-
-		logger.Warn(fmt.Sprintf(
-			"[LED] %s invalid state='%s' from=%s",
+	st, err := req.Validate()
+	if err != nil {
+		status, code := http.StatusBadRequest, "invalid_command"
+		if errors.Is(err, ErrUnsupported) {
+			status, code = http.StatusUnprocessableEntity, "unsupported"
+		}
+		c.JSON(status, gin.H{"error": err.Error(), "code": code})
+
+		logger.WarnCtx(c.Request.Context(), fmt.Sprintf(
+			"[LED] %s invalid command state='%s' from=%s error=%v",
 			c.FullPath(),
-			state,
+			req.State,
 			c.ClientIP(),
+			err,
 		))
 		return
 	}
 
-	logger.Info(fmt.Sprintf(
+	logger.InfoCtx(c.Request.Context(), fmt.Sprintf(
 		"[LED] Request received state=%s from=%s",
-		state,
+		st,
 		c.ClientIP(),
 	))
 
-	mu.Lock()
-	defer mu.Unlock()
+	verify := verifyWrites
+	if req.Verify != nil {
+		verify = *req.Verify
+	}
+	span.SetAttributes(
+		attribute.Bool("led.verify", verify),
+		attribute.String("led.mode", st.Mode),
+	)
 
-	if err := i2cDev.WriteReg(LedCtrl, []byte{data}); err != nil {
+	if err := setLed(c.Request.Context(), st, verify, SourceAPI); err != nil {
 		span.AddEvent("i2c.write_error", trace.WithAttributes(
 			attribute.String("error", err.Error()),
 		))
-		logger.Error(fmt.Sprintf(
+		logger.ErrorCtx(c.Request.Context(), fmt.Sprintf(
 			"[LED] WriteReg failed state=%s error=%v from=%s",
-			state,
+			st,
 			err,
 			c.ClientIP(),
 		))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("I2C write failed: %v", err)})
+		replyLedError(c, err)
 		return
 	}
 	elapsed := time.Since(start)
 
-	logger.Info(fmt.Sprintf(
+	logger.InfoCtx(c.Request.Context(), fmt.Sprintf(
 		"[LED] State changed to %s via I2C duration=%v from=%s",
-		state,
+		st,
 		elapsed,
 		c.ClientIP(),
 	))
 
-	c.JSON(http.StatusOK, gin.H{"LED Status set": state})
+	c.JSON(http.StatusOK, gin.H{"LED Status set": st.Mode, "state": st, "native": st.native(), "verified": verify})
 }
@@ -0,0 +1,336 @@
+package i2cdevice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/audit"
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+)
+
+const (
+	ModeOff     = "off"
+	ModeOn      = "on"
+	ModeBlink   = "blink"
+	ModePattern = "pattern"
+)
+
+// 韌體能力（LedCaps 暫存器的 bit）
+const (
+	CapPWM     = 1 << 0 // 支援 LedBrightness
+	CapBlink   = 1 << 1 // 支援 LedBlink，由韌體自行閃爍
+	CapPattern = 1 << 2 // 支援 LedPattern 內建 pattern
+
+	capMask = CapPWM | CapBlink | CapPattern
+)
+
+const (
+	minBlinkHz = 0.1
+	maxBlinkHz = 20
+	// server-side sequencer 每一步都是一次 I2C 寫入，頻率太高會佔滿匯流排
+	maxSoftBlinkHz = 5
+	minSoftStep    = 50 * time.Millisecond
+)
+
+var (
+	// caps 在 InitI2C 時讀取，舊韌體沒有 LedCaps 時為 0（只支援 on / off）
+	caps byte
+
+	ErrInvalidCommand = errors.New("invalid led command")
+	ErrUnsupported    = errors.New("not supported by device firmware")
+)
+
+// LedState 是 LED 的完整期望狀態
+type LedState struct {
+	Mode       string     `json:"mode"`
+	Brightness uint8      `json:"brightness,omitempty"`
+	Blink      *BlinkSpec `json:"blink,omitempty"`
+	Pattern    string     `json:"pattern,omitempty"`
+}
+
+type BlinkSpec struct {
+	FrequencyHz float64 `json:"frequency_hz"`
+	DutyCycle   float64 `json:"duty_cycle"`
+}
+
+func (s LedState) String() string {
+	switch s.Mode {
+	case ModeOn:
+		return fmt.Sprintf("on(brightness=%d)", s.Brightness)
+	case ModeBlink:
+		return fmt.Sprintf("blink(%.2fHz duty=%.2f)", s.Blink.FrequencyHz, s.Blink.DutyCycle)
+	case ModePattern:
+		return fmt.Sprintf("pattern(%s)", s.Pattern)
+	}
+	return s.Mode
+}
+
+// native 表示韌體可以自行執行 blink / pattern，不需要 sequencer
+func (s LedState) native() bool {
+	switch s.Mode {
+	case ModeBlink:
+		return caps&CapBlink != 0
+	case ModePattern:
+		return caps&CapPattern != 0
+	}
+	return true
+}
+
+// onOff 回傳一個週期內亮 / 暗的時間
+func (b BlinkSpec) onOff() (on, off time.Duration) {
+	period := time.Duration(float64(time.Second) / b.FrequencyHz)
+	on = time.Duration(float64(period) * b.DutyCycle)
+	return on, period - on
+}
+
+// encode 為 LedBlink 的格式：period(ms, uint16 BE) + on time(ms, uint16 BE)
+func (b BlinkSpec) encode() []byte {
+	on, off := b.onOff()
+	period := uint16((on + off).Milliseconds())
+	onMs := uint16(on.Milliseconds())
+	return []byte{byte(period >> 8), byte(period), byte(onMs >> 8), byte(onMs)}
+}
+
+// step 是 sequencer 的一個動作：維持 level（0 為關）一段時間
+type step struct {
+	level byte
+	hold  time.Duration
+}
+
+type pattern struct {
+	id    byte // LedPattern 暫存器的值
+	steps []step
+}
+
+var patterns = map[string]pattern{
+	"heartbeat": {id: 0x01, steps: []step{
+		{255, 100 * time.Millisecond}, {0, 100 * time.Millisecond},
+		{255, 100 * time.Millisecond}, {0, 700 * time.Millisecond},
+	}},
+	"error": {id: 0x02, steps: []step{
+		{255, 150 * time.Millisecond}, {0, 150 * time.Millisecond},
+		{255, 150 * time.Millisecond}, {0, 150 * time.Millisecond},
+		{255, 150 * time.Millisecond}, {0, 1 * time.Second},
+	}},
+	"identify": {id: 0x03, steps: []step{
+		{255, 500 * time.Millisecond}, {0, 500 * time.Millisecond},
+	}},
+}
+
+func patternNames() []string {
+	names := make([]string, 0, len(patterns))
+	for n := range patterns {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LedCommand 是 POST /led 的 body，MQTT 等其他入口也共用同一份驗證
+type LedCommand struct {
+	State      string     `json:"state"`
+	Brightness *int       `json:"brightness"`
+	Blink      *BlinkSpec `json:"blink"`
+	Pattern    string     `json:"pattern"`
+	Verify     *bool      `json:"verify"`
+}
+
+// Validate 將指令轉成 LedState，並檢查韌體是否支援
+func (cmd LedCommand) Validate() (LedState, error) {
+	mode := strings.ToLower(strings.TrimSpace(cmd.State))
+	if mode == "" {
+		switch {
+		case cmd.Pattern != "":
+			mode = ModePattern
+		case cmd.Blink != nil:
+			mode = ModeBlink
+		}
+	}
+
+	st := LedState{Mode: mode}
+	switch mode {
+	case ModeOff:
+	case ModeOn:
+		st.Brightness = 255
+		if cmd.Brightness != nil {
+			if *cmd.Brightness < 1 || *cmd.Brightness > 255 {
+				return st, fmt.Errorf("%w: brightness must be 1-255", ErrInvalidCommand)
+			}
+			st.Brightness = uint8(*cmd.Brightness)
+		}
+		if st.Brightness != 255 && caps&CapPWM == 0 {
+			return st, fmt.Errorf("brightness: %w", ErrUnsupported)
+		}
+	case ModeBlink:
+		if cmd.Blink == nil {
+			return st, fmt.Errorf("%w: blink requires frequency_hz and duty_cycle", ErrInvalidCommand)
+		}
+		b := *cmd.Blink
+		if b.DutyCycle == 0 {
+			b.DutyCycle = 0.5
+		}
+		if math.IsNaN(b.FrequencyHz) || b.FrequencyHz < minBlinkHz || b.FrequencyHz > maxBlinkHz {
+			return st, fmt.Errorf("%w: frequency_hz must be %.1f-%.0f", ErrInvalidCommand, minBlinkHz, float64(maxBlinkHz))
+		}
+		if math.IsNaN(b.DutyCycle) || b.DutyCycle <= 0 || b.DutyCycle >= 1 {
+			return st, fmt.Errorf("%w: duty_cycle must be between 0 and 1", ErrInvalidCommand)
+		}
+		st.Blink = &b
+		if !st.native() {
+			on, off := b.onOff()
+			if b.FrequencyHz > maxSoftBlinkHz || on < minSoftStep || off < minSoftStep {
+				return st, fmt.Errorf("%w: firmware has no native blink, server-side blink is limited to %dHz with on/off >= %v",
+					ErrUnsupported, maxSoftBlinkHz, minSoftStep)
+			}
+		}
+	case ModePattern:
+		name := strings.ToLower(strings.TrimSpace(cmd.Pattern))
+		if _, ok := patterns[name]; !ok {
+			return st, fmt.Errorf("%w: pattern must be one of %s", ErrInvalidCommand, strings.Join(patternNames(), ", "))
+		}
+		st.Pattern = name
+	default:
+		return st, fmt.Errorf("%w: state must be one of off, on, blink, pattern", ErrInvalidCommand)
+	}
+	return st, nil
+}
+
+var (
+	// cmdMu 讓 LED 指令依序執行：停掉舊的 sequencer → 寫入 → 視需要啟動新的 sequencer
+	cmdMu sync.Mutex
+	seq   *sequencer
+)
+
+type sequencer struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	state  LedState
+}
+
+// setLed 是所有 LED 指令的入口，會取消進行中的 pattern；source 記錄在狀態事件中
+func setLed(ctx context.Context, st LedState, verify bool, source string) error {
+	_, err := swapLed(ctx, st, verify, source)
+	return err
+}
+
+// swapLed 同 setLed，另外回傳在同一段 cmdMu 內讀到的前一個狀態（尚未設定過時為關燈）
+func swapLed(ctx context.Context, st LedState, verify bool, source string) (LedState, error) {
+	cmdMu.Lock()
+	defer cmdMu.Unlock()
+
+	stopSequencer()
+
+	mu.Lock()
+	var prev *LedState
+	if desired != nil {
+		p := *desired
+		prev = &p
+	}
+	err := applyLed(ctx, st, verify)
+	mu.Unlock()
+	recordLed(ctx, source, prev, st, err)
+	if err != nil {
+		return LedState{}, err
+	}
+
+	if !st.native() {
+		startSequencer(st)
+	}
+	publishState(source, prev, st)
+	if prev == nil {
+		return LedState{Mode: ModeOff}, nil
+	}
+	return *prev, nil
+}
+
+// recordLed 將 LED 變更寫入稽核紀錄
+func recordLed(ctx context.Context, source string, prev *LedState, st LedState, err error) {
+	result, msg := audit.Result(err)
+	e := audit.Entry{Source: source, Device: deviceName, Operation: "led.set", New: st, Result: result, Error: msg}
+	if prev != nil {
+		e.Old = *prev
+	}
+	audit.Record(ctx, e)
+}
+
+// sequencerRunning 回傳目前是否由 server 端驅動 pattern
+func sequencerRunning() (LedState, bool) {
+	cmdMu.Lock()
+	defer cmdMu.Unlock()
+	if seq == nil {
+		return LedState{}, false
+	}
+	return seq.state, true
+}
+
+// stopSequencer 取消 sequencer 並等它結束，呼叫端須持有 cmdMu 且不可持有 mu
+func stopSequencer() {
+	if seq == nil {
+		return
+	}
+	seq.cancel()
+	<-seq.done
+	logger.Info(fmt.Sprintf("[LED] sequencer stopped state=%s", seq.state))
+	seq = nil
+}
+
+func startSequencer(st LedState) {
+	var steps []step
+	switch st.Mode {
+	case ModeBlink:
+		on, off := st.Blink.onOff()
+		steps = []step{{255, on}, {0, off}}
+	case ModePattern:
+		steps = patterns[st.Pattern].steps
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &sequencer{cancel: cancel, done: make(chan struct{}), state: st}
+	seq = s
+
+	logger.Info(fmt.Sprintf("[LED] sequencer started state=%s", st))
+	go s.run(ctx, steps)
+}
+
+func (s *sequencer) run(ctx context.Context, steps []step) {
+	defer close(s.done)
+
+	failures := 0
+	for {
+		for _, st := range steps {
+			data := byte(LED_OFF)
+			if st.level > 0 {
+				data = LED_ON
+			}
+
+			mu.Lock()
+			err := writeReg(ctx, LedCtrl, []byte{data})
+			mu.Unlock()
+
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				failures++
+				// 只記錄第一次與之後每 50 次，避免裝置離線時洗版
+				if failures == 1 || failures%50 == 0 {
+					logger.WarnCtx(ctx, fmt.Sprintf("[LED] sequencer write failed state=%s failures=%d error=%v", s.state, failures, err))
+				}
+			} else {
+				failures = 0
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(st.hold):
+			}
+		}
+	}
+}
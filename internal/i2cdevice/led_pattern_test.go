@@ -0,0 +1,71 @@
+package i2cdevice
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestLedCommandValidate(t *testing.T) {
+	ptr := func(v int) *int { return &v }
+	full := byte(capMask)
+
+	tests := []struct {
+		name    string
+		caps    byte
+		cmd     LedCommand
+		want    LedState
+		wantErr error
+	}{
+		{name: "off", cmd: LedCommand{State: "off"}, want: LedState{Mode: ModeOff}},
+		{name: "on defaults to full brightness", cmd: LedCommand{State: " ON "}, want: LedState{Mode: ModeOn, Brightness: 255}},
+		{name: "on with brightness", caps: full, cmd: LedCommand{State: "on", Brightness: ptr(10)}, want: LedState{Mode: ModeOn, Brightness: 10}},
+		{name: "full brightness without pwm", cmd: LedCommand{State: "on", Brightness: ptr(255)}, want: LedState{Mode: ModeOn, Brightness: 255}},
+		{name: "dim without pwm", cmd: LedCommand{State: "on", Brightness: ptr(10)}, wantErr: ErrUnsupported},
+		{name: "brightness zero", caps: full, cmd: LedCommand{State: "on", Brightness: ptr(0)}, wantErr: ErrInvalidCommand},
+		{name: "brightness too high", caps: full, cmd: LedCommand{State: "on", Brightness: ptr(256)}, wantErr: ErrInvalidCommand},
+		{
+			name: "blink inferred, duty defaults to half", caps: full,
+			cmd:  LedCommand{Blink: &BlinkSpec{FrequencyHz: 2}},
+			want: LedState{Mode: ModeBlink, Blink: &BlinkSpec{FrequencyHz: 2, DutyCycle: 0.5}},
+		},
+		{name: "blink without spec", cmd: LedCommand{State: "blink"}, wantErr: ErrInvalidCommand},
+		{name: "blink too slow", caps: full, cmd: LedCommand{Blink: &BlinkSpec{FrequencyHz: 0.01}}, wantErr: ErrInvalidCommand},
+		{name: "blink too fast", caps: full, cmd: LedCommand{Blink: &BlinkSpec{FrequencyHz: 50}}, wantErr: ErrInvalidCommand},
+		{name: "blink NaN", caps: full, cmd: LedCommand{Blink: &BlinkSpec{FrequencyHz: math.NaN()}}, wantErr: ErrInvalidCommand},
+		{name: "duty cycle 1", caps: full, cmd: LedCommand{Blink: &BlinkSpec{FrequencyHz: 1, DutyCycle: 1}}, wantErr: ErrInvalidCommand},
+		{
+			name: "soft blink within limits",
+			cmd:  LedCommand{Blink: &BlinkSpec{FrequencyHz: 2, DutyCycle: 0.5}},
+			want: LedState{Mode: ModeBlink, Blink: &BlinkSpec{FrequencyHz: 2, DutyCycle: 0.5}},
+		},
+		{name: "soft blink too fast", cmd: LedCommand{Blink: &BlinkSpec{FrequencyHz: 10}}, wantErr: ErrUnsupported},
+		{name: "soft blink step too short", cmd: LedCommand{Blink: &BlinkSpec{FrequencyHz: 5, DutyCycle: 0.1}}, wantErr: ErrUnsupported},
+		{name: "pattern inferred", cmd: LedCommand{Pattern: "Heartbeat"}, want: LedState{Mode: ModePattern, Pattern: "heartbeat"}},
+		{name: "unknown pattern", cmd: LedCommand{State: "pattern", Pattern: "disco"}, wantErr: ErrInvalidCommand},
+		{name: "empty command", cmd: LedCommand{}, wantErr: ErrInvalidCommand},
+		{name: "unknown state", cmd: LedCommand{State: "toggle"}, wantErr: ErrInvalidCommand},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := caps
+			caps = tt.caps
+			t.Cleanup(func() { caps = old })
+
+			got, err := tt.cmd.Validate()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("state = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
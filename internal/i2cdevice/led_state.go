@@ -0,0 +1,247 @@
+package i2cdevice
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// verifyWrites 為預設值，單一請求可用 "verify" 欄位覆寫
+	verifyWrites = envBool("I2C_VERIFY_WRITES", false)
+
+	// desired 是最後一次成功套用的狀態，nil 表示尚未有請求；由 mu 保護
+	desired *LedState
+
+	reconcileInterval = envDuration("I2C_RECONCILE_INTERVAL", 10*time.Second)
+)
+
+// VerifyError 表示寫入後回讀的值與預期不符
+type VerifyError struct {
+	Reg  byte
+	Want []byte
+	Got  []byte
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("verify failed reg=0x%02x want=% x got=% x", e.Reg, e.Want, e.Got)
+}
+
+// decodeLedState 將 LedQuery 的值轉成狀態字串，ok=false 表示韌體回傳未定義的值
+func decodeLedState(b byte) (state string, ok bool) {
+	switch b {
+	case LED_OFF:
+		return "Off", true
+	case LED_ON:
+		return "On", true
+	}
+	return "Unknown", false
+}
+
+// regWrite 是一次暫存器寫入，也是回讀驗證的依據
+type regWrite struct {
+	reg     byte
+	data    []byte
+	readReg byte // 驗證時要回讀的暫存器（LedCtrl 只能從 LedQuery 讀回）
+}
+
+// plan 將狀態展開為依序寫入的暫存器；server-side 的 blink / pattern 只需先關燈，之後交給 sequencer
+func (s LedState) plan() []regWrite {
+	switch s.Mode {
+	case ModeOff:
+		return []regWrite{{reg: LedCtrl, data: []byte{LED_OFF}, readReg: LedQuery}}
+	case ModeOn:
+		var out []regWrite
+		if caps&CapPWM != 0 {
+			out = append(out, regWrite{reg: LedBrightness, data: []byte{s.Brightness}, readReg: LedBrightness})
+		}
+		return append(out, regWrite{reg: LedCtrl, data: []byte{LED_ON}, readReg: LedQuery})
+	case ModeBlink:
+		if !s.native() {
+			return []regWrite{{reg: LedCtrl, data: []byte{LED_OFF}}}
+		}
+		return []regWrite{{reg: LedBlink, data: s.Blink.encode(), readReg: LedBlink}}
+	case ModePattern:
+		if !s.native() {
+			return []regWrite{{reg: LedCtrl, data: []byte{LED_OFF}}}
+		}
+		return []regWrite{{reg: LedPattern, data: []byte{patterns[s.Pattern].id}, readReg: LedPattern}}
+	}
+	return nil
+}
+
+// applyLed 寫入狀態對應的暫存器，verify 時逐一回讀確認裝置已套用；呼叫端須持有 mu
+func applyLed(ctx context.Context, st LedState, verify bool) error {
+	writes := st.plan()
+	for _, w := range writes {
+		if err := writeReg(ctx, w.reg, w.data); err != nil {
+			return err
+		}
+	}
+
+	// 寫入已送達就記錄期望值，即使 verify 失敗也讓 reconciler 繼續追
+	s := st
+	desired = &s
+
+	if !verify {
+		return nil
+	}
+	return verifyPlan(ctx, writes)
+}
+
+func verifyPlan(ctx context.Context, writes []regWrite) error {
+	return verifyPlanOn(ctx, primaryConn(), writes)
+}
+
+// verifyPlanOn 逐一回讀 writes 中可讀回的暫存器，與寫入值比對
+func verifyPlanOn(ctx context.Context, conn Conn, writes []regWrite) error {
+	for _, w := range writes {
+		if w.readReg == 0 {
+			continue
+		}
+		buf := make([]byte, len(w.data))
+		if err := readRegOn(ctx, conn, w.readReg, buf); err != nil {
+			return err
+		}
+		if !bytes.Equal(buf, w.data) {
+			return &VerifyError{Reg: w.readReg, Want: w.data, Got: buf}
+		}
+	}
+	return nil
+}
+
+// replyLedError 處理 applyLed 的錯誤，verify 失敗以 502 回報
+func replyLedError(c *gin.Context, err error) {
+	var vErr *VerifyError
+	if errors.As(err, &vErr) {
+		resp := gin.H{
+			"error":    vErr.Error(),
+			"code":     "verify_mismatch",
+			"expected": fmt.Sprintf("% x", vErr.Want),
+			"raw":      fmt.Sprintf("% x", vErr.Got),
+		}
+		if vErr.Reg == LedQuery && len(vErr.Got) == 1 {
+			resp["actual"], resp["known"] = decodeLedState(vErr.Got[0])
+		}
+		c.JSON(http.StatusBadGateway, resp)
+		return
+	}
+	replyTxError(c, err)
+}
+
+// StartReconciler 定期比對期望狀態與裝置實際狀態，裝置重置後重新套用最後一次的請求
+func StartReconciler(ctx context.Context) {
+	if i2cDev == nil || reconcileInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(reconcileInterval)
+		defer ticker.Stop()
+
+		logger.Info(fmt.Sprintf("[LED] reconciler started interval=%v", reconcileInterval))
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Info("[LED] reconciler stopped")
+				return
+			case <-ticker.C:
+				reconcileOnce(ctx)
+			}
+		}
+	}()
+}
+
+func reconcileOnce(ctx context.Context) {
+	ctx, span := tracer.Start(ctx, "led.reconcile")
+	defer span.End()
+
+	// 韌體更新期間裝置在 bootloader，更新完成後會重新套用
+	if fwBusy.Load() {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if desired == nil {
+		return
+	}
+	want := *desired
+
+	// server-side sequencer 自己會持續寫入，不需要比對
+	writes := want.plan()
+	if (want.Mode == ModeBlink || want.Mode == ModePattern) && !want.native() {
+		return
+	}
+
+	err := verifyPlan(ctx, writes)
+	if err == nil {
+		return
+	}
+
+	var vErr *VerifyError
+	if !errors.As(err, &vErr) {
+		span.AddEvent("i2c.read_error", trace.WithAttributes(attribute.String("error", err.Error())))
+		logger.WarnCtx(ctx, fmt.Sprintf("[LED] reconcile read failed error=%v", err))
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("led.desired", want.String()),
+		attribute.Int("led.drift_reg", int(vErr.Reg)),
+	)
+	logger.WarnCtx(ctx, fmt.Sprintf(
+		"[LED] drift detected desired=%s reg=0x%02x want=% x got=% x, re-applying",
+		want, vErr.Reg, vErr.Want, vErr.Got,
+	))
+
+	err = applyLed(ctx, want, true)
+	recordLed(ctx, SourceReconcile, nil, want, err)
+	if err != nil {
+		span.AddEvent("led.reconcile_failed", trace.WithAttributes(attribute.String("error", err.Error())))
+		logger.ErrorCtx(ctx, fmt.Sprintf("[LED] reconcile failed desired=%s error=%v", want, err))
+		return
+	}
+	logger.InfoCtx(ctx, fmt.Sprintf("[LED] reconciled to %s", want))
+	publishState(SourceReconcile, nil, want)
+}
+
+func envBool(key string, def bool) bool {
+	if v, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+// envUint 接受十進位或 0x 開頭的十六進位（位址類設定）
+func envUint(key string, def uint64) uint64 {
+	if v, err := strconv.ParseUint(os.Getenv(key), 0, 32); err == nil {
+		return v
+	}
+	return def
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,303 @@
+package i2cdevice
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	"github.com/HarrisonZz/web_server_in_go/internal/util"
+	"golang.org/x/exp/io/i2c"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultBus = "/dev/i2c-2"
+
+	AccessRO = "ro"
+	AccessWO = "wo"
+	AccessRW = "rw"
+)
+
+var (
+	ErrReadOnly        = errors.New("register is read-only")
+	ErrWriteOnly       = errors.New("register is write-only")
+	ErrManaged         = errors.New("register is managed by /led")
+	ErrInvalidValue    = errors.New("invalid register value")
+	ErrUnknownDevice   = errors.New("device not found")
+	ErrUnknownRegister = errors.New("register not found")
+)
+
+// RegisterMap 是 I2C_REGISTER_MAP 指定的 YAML 檔內容
+type RegisterMap struct {
+	Devices []DeviceSpec `yaml:"devices"`
+}
+
+type DeviceSpec struct {
+	Name        string         `yaml:"name" json:"name"`
+	Bus         string         `yaml:"bus" json:"bus"`
+	Address     int            `yaml:"address" json:"address"`
+	Description string         `yaml:"description" json:"description,omitempty"`
+	Registers   []RegisterSpec `yaml:"registers" json:"registers"`
+}
+
+// RegisterSpec 描述一個暫存器；數值 = raw * Scale + Offset，有 Enum 時以名稱表示
+type RegisterSpec struct {
+	Name        string           `yaml:"name" json:"name"`
+	Address     byte             `yaml:"address" json:"address"`
+	Width       int              `yaml:"width" json:"width"` // 1、2、4 bytes，big-endian
+	Access      string           `yaml:"access" json:"access"`
+	Signed      bool             `yaml:"signed" json:"signed,omitempty"`
+	Scale       float64          `yaml:"scale" json:"scale,omitempty"`
+	Offset      float64          `yaml:"offset" json:"offset,omitempty"`
+	Unit        string           `yaml:"unit" json:"unit,omitempty"`
+	Min         *float64         `yaml:"min" json:"min,omitempty"`
+	Max         *float64         `yaml:"max" json:"max,omitempty"`
+	Enum        map[string]int64 `yaml:"enum" json:"enum,omitempty"`
+	Description string           `yaml:"description" json:"description,omitempty"`
+}
+
+// managedRegs 由 LED 控制流程與韌體更新負責寫入，直接寫會被 reconciler 蓋回去或讓裝置重開
+var managedRegs = map[byte]bool{LedCtrl: true, LedBrightness: true, LedBlink: true, LedPattern: true, BootloaderEnter: true}
+
+// regDevice 是載入後的裝置，mu 為所在匯流排的 lock
+type regDevice struct {
+	spec    DeviceSpec
+	conn    Conn
+	mu      *sync.Mutex
+	regs    map[string]*RegisterSpec
+	primary bool
+}
+
+var (
+	regDevices = map[string]*regDevice{}
+	busLocks   = map[string]*sync.Mutex{}
+)
+
+// normalize 補上預設值並檢查欄位
+func (r *RegisterSpec) normalize() error {
+	if r.Name == "" {
+		return errors.New("register name is required")
+	}
+	if r.Width == 0 {
+		r.Width = 1
+	}
+	if r.Width != 1 && r.Width != 2 && r.Width != 4 {
+		return fmt.Errorf("register %s: width must be 1, 2 or 4", r.Name)
+	}
+	if r.Access == "" {
+		r.Access = AccessRW
+	}
+	switch r.Access {
+	case AccessRO, AccessWO, AccessRW:
+	default:
+		return fmt.Errorf("register %s: access must be ro, wo or rw", r.Name)
+	}
+	if r.Scale == 0 {
+		r.Scale = 1
+	}
+	return nil
+}
+
+func (r *RegisterSpec) readable() bool { return r.Access != AccessWO }
+func (r *RegisterSpec) writable() bool { return r.Access != AccessRO }
+
+// rawRange 回傳此寬度 / 正負號可表示的 raw 範圍
+func (r *RegisterSpec) rawRange() (int64, int64) {
+	bits := uint(8 * r.Width)
+	if r.Signed {
+		return -(1 << (bits - 1)), 1<<(bits-1) - 1
+	}
+	return 0, 1<<bits - 1
+}
+
+func (r *RegisterSpec) decodeRaw(b []byte) int64 {
+	var u uint64
+	for _, v := range b {
+		u = u<<8 | uint64(v)
+	}
+	if r.Signed {
+		shift := 64 - 8*uint(len(b))
+		return int64(u<<shift) >> shift
+	}
+	return int64(u)
+}
+
+func (r *RegisterSpec) encodeRaw(raw int64) []byte {
+	b := make([]byte, r.Width)
+	for i := r.Width - 1; i >= 0; i-- {
+		b[i] = byte(raw)
+		raw >>= 8
+	}
+	return b
+}
+
+// Value 將 raw 轉成對外的值：enum 名稱或換算後的數值
+func (r *RegisterSpec) Value(raw int64) any {
+	if len(r.Enum) > 0 {
+		for name, v := range r.Enum {
+			if v == raw {
+				return name
+			}
+		}
+		return nil
+	}
+	return float64(raw)*r.Scale + r.Offset
+}
+
+// Raw 將 API 傳入的值（enum 名稱或數值）轉回 raw，並檢查範圍
+func (r *RegisterSpec) Raw(value any) (int64, error) {
+	var raw int64
+	switch v := value.(type) {
+	case string:
+		n, ok := r.Enum[strings.ToLower(v)]
+		if !ok {
+			return 0, fmt.Errorf("%w: %q is not one of %s", ErrInvalidValue, v, strings.Join(r.enumNames(), ", "))
+		}
+		raw = n
+	case float64:
+		if len(r.Enum) > 0 {
+			return 0, fmt.Errorf("%w: use one of %s", ErrInvalidValue, strings.Join(r.enumNames(), ", "))
+		}
+		if r.Min != nil && v < *r.Min || r.Max != nil && v > *r.Max {
+			return 0, fmt.Errorf("%w: %v is outside the allowed range", ErrInvalidValue, v)
+		}
+		raw = int64(math.Round((v - r.Offset) / r.Scale))
+	default:
+		return 0, fmt.Errorf("%w: value must be a number or an enum name", ErrInvalidValue)
+	}
+
+	lo, hi := r.rawRange()
+	if raw < lo || raw > hi {
+		return 0, fmt.Errorf("%w: raw value %d does not fit in %d byte(s)", ErrInvalidValue, raw, r.Width)
+	}
+	return raw, nil
+}
+
+func (r *RegisterSpec) enumNames() []string {
+	names := make([]string, 0, len(r.Enum))
+	for n := range r.Enum {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadRegisterMap 讀取 YAML，檔案不存在時改用內建的 def（隨程式一起發佈的 config/registers.yaml）
+func loadRegisterMap(path string, def []byte) (RegisterMap, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Info(fmt.Sprintf("Register map %s not found, using built-in map", path))
+		m, err := parseRegisterMap(def, "built-in register map")
+		if err != nil {
+			return RegisterMap{}, err
+		}
+		// 內建檔案的 primary 裝置名稱跟著 I2C_DEVICE_NAME
+		for i := range m.Devices {
+			if d := &m.Devices[i]; d.Address == stm32Addr && (d.Bus == "" || d.Bus == defaultBus) {
+				d.Name = deviceName
+			}
+		}
+		return m, nil
+	}
+	if err != nil {
+		return RegisterMap{}, err
+	}
+	return parseRegisterMap(b, path)
+}
+
+func parseRegisterMap(b []byte, src string) (RegisterMap, error) {
+	var m RegisterMap
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return RegisterMap{}, fmt.Errorf("parse %s: %w", src, err)
+	}
+	return m, nil
+}
+
+// initRegisterMap 載入 register map 並開啟其中的裝置；與 LED 相同位址的裝置共用 i2cDev 與 mu
+func initRegisterMap(def []byte) error {
+	m, err := loadRegisterMap(util.Getenv("I2C_REGISTER_MAP", "config/registers.yaml"), def)
+	if err != nil {
+		return err
+	}
+
+	for _, spec := range m.Devices {
+		if spec.Name == "" {
+			return errors.New("device name is required")
+		}
+		if _, dup := regDevices[spec.Name]; dup {
+			return fmt.Errorf("duplicate device %s", spec.Name)
+		}
+		if spec.Bus == "" {
+			spec.Bus = defaultBus
+		}
+
+		d := &regDevice{spec: spec, regs: map[string]*RegisterSpec{}}
+		for i := range spec.Registers {
+			r := &spec.Registers[i]
+			if err := r.normalize(); err != nil {
+				return fmt.Errorf("device %s: %w", spec.Name, err)
+			}
+			if _, dup := d.regs[r.Name]; dup {
+				return fmt.Errorf("device %s: duplicate register %s", spec.Name, r.Name)
+			}
+			d.regs[r.Name] = r
+		}
+
+		if spec.Bus == defaultBus && spec.Address == stm32Addr {
+			d.conn, d.mu, d.primary = primaryConn(), &mu, true
+		} else {
+			d.mu = busLock(spec.Bus)
+			dev, err := i2c.Open(&i2c.Devfs{Dev: spec.Bus}, spec.Address)
+			if err != nil {
+				// 仍然列出裝置，存取時回報 device_unavailable
+				logger.Error(fmt.Sprintf("I2C device %s (bus=%s addr=0x%02x) open failed: %v", spec.Name, spec.Bus, spec.Address, err))
+			} else {
+				d.conn = dev
+			}
+		}
+
+		regDevices[spec.Name] = d
+		logger.Info(fmt.Sprintf("Register map loaded device=%s registers=%d", spec.Name, len(d.regs)))
+	}
+	return nil
+}
+
+// primaryDevice 回傳與 LED 共用連線的裝置
+func primaryDevice() (*regDevice, bool) {
+	for _, d := range regDevices {
+		if d.primary {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// busLock 同一條匯流排上的裝置共用一把 lock，預設匯流排即為 mu
+func busLock(bus string) *sync.Mutex {
+	if bus == defaultBus {
+		return &mu
+	}
+	if l, ok := busLocks[bus]; ok {
+		return l
+	}
+	l := &sync.Mutex{}
+	busLocks[bus] = l
+	return l
+}
+
+func lookupRegister(device, reg string) (*regDevice, *RegisterSpec, error) {
+	d, ok := regDevices[device]
+	if !ok {
+		return nil, nil, ErrUnknownDevice
+	}
+	r, ok := d.regs[reg]
+	if !ok {
+		return d, nil, ErrUnknownRegister
+	}
+	return d, r, nil
+}
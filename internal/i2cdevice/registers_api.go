@@ -0,0 +1,231 @@
+package i2cdevice
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/audit"
+	"github.com/HarrisonZz/web_server_in_go/internal/handler"
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RegisterValue 是 GET / PUT /devices/:name/registers/:reg 的回應
+type RegisterValue struct {
+	Device   string `json:"device"`
+	Register string `json:"register"`
+	Address  string `json:"address"`
+	Raw      int64  `json:"raw"`
+	Value    any    `json:"value"`
+	Unit     string `json:"unit,omitempty"`
+	Known    bool   `json:"known"` // enum 暫存器讀到未定義的值時為 false
+}
+
+func newRegisterValue(d *regDevice, r *RegisterSpec, raw int64) RegisterValue {
+	v := r.Value(raw)
+	return RegisterValue{
+		Device:   d.spec.Name,
+		Register: r.Name,
+		Address:  fmt.Sprintf("0x%02x", r.Address),
+		Raw:      raw,
+		Value:    v,
+		Unit:     r.Unit,
+		Known:    v != nil,
+	}
+}
+
+func registerRegisterRoutes() {
+	handler.RegisterRoute(http.MethodGet, "/devices", listDevices)
+	handler.RegisterRoute(http.MethodGet, "/devices/:name/registers", listRegisters)
+	handler.RegisterRoute(http.MethodGet, "/devices/:name/registers/:reg", readRegister)
+	handler.RegisterRoute(http.MethodPut, "/devices/:name/registers/:reg", writeRegister)
+	handler.RegisterRoute(http.MethodPost, "/devices/:name/batch", runDeviceBatch)
+}
+
+func listDevices(c *gin.Context) {
+	out := make([]gin.H, 0, len(regDevices))
+	for _, d := range regDevices {
+		out = append(out, gin.H{
+			"name":      d.spec.Name,
+			"bus":       d.spec.Bus,
+			"address":   fmt.Sprintf("0x%02x", d.spec.Address),
+			"available": d.conn != nil,
+			"registers": len(d.regs),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i]["name"].(string) < out[j]["name"].(string) })
+	c.JSON(http.StatusOK, gin.H{"devices": out})
+}
+
+func listRegisters(c *gin.Context) {
+	d, ok := regDevices[c.Param("name")]
+	if !ok {
+		replyRegisterError(c, ErrUnknownDevice)
+		return
+	}
+	regs := make([]*RegisterSpec, 0, len(d.regs))
+	for _, r := range d.regs {
+		regs = append(regs, r)
+	}
+	sort.Slice(regs, func(i, j int) bool { return regs[i].Address < regs[j].Address })
+	c.JSON(http.StatusOK, gin.H{"device": d.spec.Name, "registers": regs})
+}
+
+func readRegister(c *gin.Context) {
+	span := trace.SpanFromContext(c.Request.Context())
+	d, r, err := lookupRegister(c.Param("name"), c.Param("reg"))
+	if err != nil {
+		replyRegisterError(c, err)
+		return
+	}
+	span.SetAttributes(attribute.String("device.name", d.spec.Name), attribute.String("register.name", r.Name))
+
+	if !r.readable() {
+		replyRegisterError(c, ErrWriteOnly)
+		return
+	}
+
+	buf := make([]byte, r.Width)
+	d.mu.Lock()
+	err = readRegOn(c.Request.Context(), d.conn, r.Address, buf)
+	d.mu.Unlock()
+	if err != nil {
+		logger.ErrorCtx(c.Request.Context(), fmt.Sprintf("[REG] read %s/%s failed error=%v from=%s", d.spec.Name, r.Name, err, c.ClientIP()))
+		replyTxError(c, err)
+		return
+	}
+
+	val := newRegisterValue(d, r, r.decodeRaw(buf))
+	if !val.Known {
+		span.AddEvent("register.unknown_value", trace.WithAttributes(attribute.Int64("register.raw", val.Raw)))
+	}
+	c.JSON(http.StatusOK, val)
+}
+
+// writeRegisterRequest 以 value（數值或 enum 名稱）或 raw 指定寫入值
+type writeRegisterRequest struct {
+	Value  any    `json:"value"`
+	Raw    *int64 `json:"raw"`
+	Verify *bool  `json:"verify"`
+}
+
+func writeRegister(c *gin.Context) {
+	span := trace.SpanFromContext(c.Request.Context())
+	start := time.Now()
+
+	d, r, err := lookupRegister(c.Param("name"), c.Param("reg"))
+	if err != nil {
+		replyRegisterError(c, err)
+		return
+	}
+	span.SetAttributes(attribute.String("device.name", d.spec.Name), attribute.String("register.name", r.Name))
+
+	var req writeRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json", "code": "invalid_json"})
+		return
+	}
+
+	raw, err := r.checkWrite(d, req.Value, req.Raw)
+	if err != nil {
+		logger.WarnCtx(c.Request.Context(), fmt.Sprintf("[REG] write %s/%s rejected error=%v from=%s", d.spec.Name, r.Name, err, c.ClientIP()))
+		replyRegisterError(c, err)
+		return
+	}
+
+	verify := verifyWrites && r.readable()
+	if req.Verify != nil {
+		verify = *req.Verify && r.readable()
+	}
+
+	data := r.encodeRaw(raw)
+	d.mu.Lock()
+	// 可讀的暫存器先讀出舊值供稽核紀錄，讀不到不影響寫入
+	var old *RegisterValue
+	if r.readable() {
+		buf := make([]byte, r.Width)
+		if readRegOn(c.Request.Context(), d.conn, r.Address, buf) == nil {
+			v := newRegisterValue(d, r, r.decodeRaw(buf))
+			old = &v
+		}
+	}
+	err = writeRegOn(c.Request.Context(), d.conn, r.Address, data)
+	if err == nil && verify {
+		err = verifyPlanOn(c.Request.Context(), d.conn, []regWrite{{reg: r.Address, data: data, readReg: r.Address}})
+	}
+	d.mu.Unlock()
+
+	result, msg := audit.Result(err)
+	entry := audit.Entry{
+		Source: SourceAPI, Device: d.spec.Name, Operation: "register.write", Target: r.Name,
+		New: newRegisterValue(d, r, raw), Result: result, Error: msg,
+	}
+	if old != nil {
+		entry.Old = *old
+	}
+	audit.Record(c.Request.Context(), entry)
+
+	if err != nil {
+		logger.ErrorCtx(c.Request.Context(), fmt.Sprintf("[REG] write %s/%s raw=%d failed error=%v from=%s", d.spec.Name, r.Name, raw, err, c.ClientIP()))
+		replyLedError(c, err)
+		return
+	}
+
+	logger.InfoCtx(c.Request.Context(), fmt.Sprintf(
+		"[REG] %s/%s set raw=%d duration=%v from=%s",
+		d.spec.Name, r.Name, raw, time.Since(start), c.ClientIP(),
+	))
+	resp := newRegisterValue(d, r, raw)
+	c.JSON(http.StatusOK, gin.H{"register": resp, "verified": verify})
+}
+
+// checkWrite 檢查存取權限並將請求值轉成 raw
+func (r *RegisterSpec) checkWrite(d *regDevice, value any, rawVal *int64) (int64, error) {
+	if !r.writable() {
+		return 0, ErrReadOnly
+	}
+	if d.primary && managedRegs[r.Address] {
+		return 0, ErrManaged
+	}
+	switch {
+	case rawVal != nil && value != nil:
+		return 0, fmt.Errorf("%w: specify either value or raw", ErrInvalidValue)
+	case rawVal != nil:
+		lo, hi := r.rawRange()
+		if *rawVal < lo || *rawVal > hi {
+			return 0, fmt.Errorf("%w: raw value %d does not fit in %d byte(s)", ErrInvalidValue, *rawVal, r.Width)
+		}
+		return *rawVal, nil
+	case value == nil:
+		return 0, fmt.Errorf("%w: value or raw is required", ErrInvalidValue)
+	}
+	return r.Raw(value)
+}
+
+func replyRegisterError(c *gin.Context, err error) {
+	status, code := registerErrorStatus(err)
+	c.JSON(status, gin.H{"error": err.Error(), "code": code})
+}
+
+// registerErrorStatus 將 register 相關錯誤對應到 HTTP 狀態碼與錯誤代碼
+func registerErrorStatus(err error) (int, string) {
+	status, code := http.StatusInternalServerError, "internal_error"
+	switch {
+	case errors.Is(err, ErrUnknownDevice), errors.Is(err, ErrUnknownRegister):
+		status, code = http.StatusNotFound, "not_found"
+	case errors.Is(err, ErrReadOnly):
+		status, code = http.StatusForbidden, "read_only"
+	case errors.Is(err, ErrWriteOnly):
+		status, code = http.StatusForbidden, "write_only"
+	case errors.Is(err, ErrManaged):
+		status, code = http.StatusConflict, "managed_register"
+	case errors.Is(err, ErrInvalidValue):
+		status, code = http.StatusBadRequest, "invalid_value"
+	}
+	return status, code
+}
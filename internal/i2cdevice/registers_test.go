@@ -0,0 +1,167 @@
+package i2cdevice
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// withShippedRegisterMap 以 config/registers.yaml 當作內建 map 載入，primary 裝置改用 conn
+func withShippedRegisterMap(t *testing.T, conn Conn) *regDevice {
+	t.Helper()
+	def, err := os.ReadFile("../../config/registers.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("I2C_REGISTER_MAP", filepath.Join(t.TempDir(), "missing.yaml"))
+
+	old := regDevices
+	regDevices = map[string]*regDevice{}
+	t.Cleanup(func() { regDevices = old })
+	if err := initRegisterMap(def); err != nil {
+		t.Fatal(err)
+	}
+	d, ok := primaryDevice()
+	if !ok {
+		t.Fatal("no primary device in the shipped register map")
+	}
+	d.conn = conn
+	return d
+}
+
+func TestDefaultSensorsFromRegisterMap(t *testing.T) {
+	withShippedRegisterMap(t, nil)
+	want := []SensorConfig{
+		{Name: "temperature", Reg: 0x10, Width: 2, Signed: true, Scale: 0.01, Unit: "Cel"},
+		{Name: "voltage", Reg: 0x12, Width: 2, Scale: 0.001, Unit: "V"},
+	}
+	if got := defaultSensors(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("defaultSensors = %+v, want %+v", got, want)
+	}
+}
+
+func TestRegisterAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	conn := &fakeRegs{mem: map[byte]byte{}}
+	d := withShippedRegisterMap(t, conn)
+
+	r := gin.New()
+	r.GET("/devices/:name/registers/:reg", readRegister)
+	r.PUT("/devices/:name/registers/:reg", writeRegister)
+
+	tests := []struct {
+		name       string
+		method     string
+		reg        string
+		body       string
+		mem        map[byte]byte
+		wantStatus int
+		wantCode   string
+		wantValue  any
+		wantKnown  bool
+	}{
+		{name: "write read-only", method: http.MethodPut, reg: "led_caps", body: `{"raw":1}`, wantStatus: http.StatusForbidden, wantCode: "read_only"},
+		{name: "read write-only", method: http.MethodGet, reg: "led_ctrl", wantStatus: http.StatusForbidden, wantCode: "write_only"},
+		{name: "write managed", method: http.MethodPut, reg: "led_brightness", body: `{"raw":10}`, wantStatus: http.StatusConflict, wantCode: "managed_register"},
+		{name: "write managed enum", method: http.MethodPut, reg: "led_ctrl", body: `{"value":"on"}`, wantStatus: http.StatusConflict, wantCode: "managed_register"},
+		{name: "unknown register", method: http.MethodGet, reg: "nope", wantStatus: http.StatusNotFound, wantCode: "not_found"},
+		{name: "enum decode", method: http.MethodGet, reg: "led_query", mem: map[byte]byte{0x02: 1}, wantStatus: http.StatusOK, wantValue: "on", wantKnown: true},
+		{name: "enum unknown value", method: http.MethodGet, reg: "led_query", mem: map[byte]byte{0x02: 7}, wantStatus: http.StatusOK, wantValue: nil, wantKnown: false},
+		{name: "scaled signed value", method: http.MethodGet, reg: "temperature", mem: map[byte]byte{0x10: 0xff, 0x11: 0x38}, wantStatus: http.StatusOK, wantValue: -2.0, wantKnown: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn.mem = map[byte]byte{}
+			for k, v := range tt.mem {
+				conn.mem[k] = v
+			}
+			req := httptest.NewRequest(tt.method, "/devices/"+d.spec.Name+"/registers/"+tt.reg, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body)
+			}
+			var resp map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantCode != "" {
+				if resp["code"] != tt.wantCode {
+					t.Fatalf("code = %v, want %s", resp["code"], tt.wantCode)
+				}
+				return
+			}
+			if resp["known"] != tt.wantKnown || resp["value"] != tt.wantValue {
+				t.Fatalf("value = %v known = %v, want %v %v", resp["value"], resp["known"], tt.wantValue, tt.wantKnown)
+			}
+		})
+	}
+}
+
+func TestCheckWriteRange(t *testing.T) {
+	raw := func(v int64) *int64 { return &v }
+	spec := func(r RegisterSpec) *RegisterSpec {
+		if err := r.normalize(); err != nil {
+			t.Fatal(err)
+		}
+		return &r
+	}
+	u8 := spec(RegisterSpec{Name: "u8"})
+	s16 := spec(RegisterSpec{Name: "s16", Width: 2, Signed: true})
+	u16 := spec(RegisterSpec{Name: "u16", Width: 2})
+	min, max := 0.0, 5.0
+	volt := spec(RegisterSpec{Name: "volt", Width: 2, Scale: 0.001, Min: &min, Max: &max})
+	mode := spec(RegisterSpec{Name: "mode", Enum: map[string]int64{"idle": 0, "run": 1}})
+	d := &regDevice{}
+
+	tests := []struct {
+		name    string
+		reg     *RegisterSpec
+		value   any
+		raw     *int64
+		want    int64
+		wantErr bool
+	}{
+		{name: "u8 max", reg: u8, raw: raw(255), want: 255},
+		{name: "u8 overflow", reg: u8, raw: raw(256), wantErr: true},
+		{name: "u8 negative", reg: u8, raw: raw(-1), wantErr: true},
+		{name: "s16 min", reg: s16, raw: raw(-32768), want: -32768},
+		{name: "s16 overflow", reg: s16, raw: raw(32768), wantErr: true},
+		{name: "u16 max", reg: u16, raw: raw(65535), want: 65535},
+		{name: "u8 value overflow", reg: u8, value: 300.0, wantErr: true},
+		{name: "scaled value", reg: volt, value: 3.3, want: 3300},
+		{name: "scaled value above max", reg: volt, value: 5.1, wantErr: true},
+		{name: "enum name", reg: mode, value: "RUN", want: 1},
+		{name: "unknown enum name", reg: mode, value: "stop", wantErr: true},
+		{name: "number for enum", reg: mode, value: 1.0, wantErr: true},
+		{name: "value and raw", reg: u8, value: 1.0, raw: raw(1), wantErr: true},
+		{name: "neither", reg: u8, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.reg.checkWrite(d, tt.value, tt.raw)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidValue) {
+					t.Fatalf("err = %v, want ErrInvalidValue", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("raw = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
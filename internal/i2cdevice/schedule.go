@@ -0,0 +1,65 @@
+package i2cdevice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// ledExecutor 讓 scheduler 以與 POST /led 相同的格式控制 LED
+type ledExecutor struct{}
+
+func (ledExecutor) Validate(raw json.RawMessage) error {
+	_, _, err := decodeCommand(raw)
+	return err
+}
+
+// Execute 透過 swapLed 執行，與 API 共用 cmdMu / mu；回傳的前一個狀態與寫入在同一段 cmdMu 內取得
+func (ledExecutor) Execute(ctx context.Context, raw json.RawMessage) (json.RawMessage, error) {
+	st, verify, err := decodeCommand(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	prev, err := swapLed(ctx, st, verify, SourceScheduler)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(prev.command())
+}
+
+func decodeCommand(raw json.RawMessage) (LedState, bool, error) {
+	var cmd LedCommand
+	if err := json.Unmarshal(raw, &cmd); err != nil {
+		return LedState{}, false, fmt.Errorf("%w: %v", ErrInvalidCommand, err)
+	}
+	st, err := cmd.Validate()
+	if err != nil {
+		return st, false, err
+	}
+	verify := verifyWrites
+	if cmd.Verify != nil {
+		verify = *cmd.Verify
+	}
+	return st, verify, nil
+}
+
+// currentState 回傳最後一次套用的狀態，尚未設定過時視為關燈
+func currentState() LedState {
+	mu.Lock()
+	defer mu.Unlock()
+	if desired == nil {
+		return LedState{Mode: ModeOff}
+	}
+	return *desired
+}
+
+// command 將狀態轉回可重新送出的指令
+func (s LedState) command() LedCommand {
+	cmd := LedCommand{State: s.Mode, Blink: s.Blink, Pattern: s.Pattern}
+	if s.Mode == ModeOn {
+		b := int(s.Brightness)
+		cmd.Brightness = &b
+	}
+	return cmd
+}
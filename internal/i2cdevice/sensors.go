@@ -0,0 +1,359 @@
+package i2cdevice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	"github.com/HarrisonZz/web_server_in_go/internal/util"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// SensorConfig 描述一個要定期取樣的暫存器；值 = raw * Scale + Offset
+type SensorConfig struct {
+	Name   string  `json:"name"`
+	Reg    byte    `json:"reg"`
+	Width  int     `json:"width"` // 1、2、4 bytes，big-endian
+	Signed bool    `json:"signed"`
+	Scale  float64 `json:"scale"`
+	Offset float64 `json:"offset"`
+	Unit   string  `json:"unit"` // UCUM，例如 Cel、V
+}
+
+// defaultSensors 取 register map 中 primary 裝置可讀且有 unit 的暫存器（例如溫度、電壓），可用 I2C_SENSORS 覆寫
+func defaultSensors() []SensorConfig {
+	d, ok := primaryDevice()
+	if !ok {
+		return nil
+	}
+	var out []SensorConfig
+	for _, r := range d.spec.Registers {
+		if !r.readable() || r.Unit == "" || len(r.Enum) > 0 {
+			continue
+		}
+		out = append(out, SensorConfig{
+			Name: r.Name, Reg: r.Address, Width: r.Width, Signed: r.Signed,
+			Scale: r.Scale, Offset: r.Offset, Unit: r.Unit,
+		})
+	}
+	return out
+}
+
+var (
+	deviceName     = util.Getenv("I2C_DEVICE_NAME", "stm32")
+	sampleInterval = envDuration("I2C_SAMPLE_INTERVAL", 5*time.Second)
+	sampleHistory  = envInt("I2C_SAMPLE_HISTORY", 720)
+
+	sensors   []*sensor
+	sensorIdx = map[string]*sensor{}
+
+	meter = otel.Meter("web-server-in-go/i2cdevice")
+)
+
+// Reading 是一筆取樣
+type Reading struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+	Raw   int64     `json:"raw"`
+}
+
+type sensor struct {
+	cfg SensorConfig
+
+	mu    sync.RWMutex
+	buf   []Reading // ring buffer
+	start int
+	size  int
+	errs  int64
+}
+
+func (s *sensor) add(r Reading) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.buf)
+	s.buf[(s.start+s.size)%n] = r
+	if s.size < n {
+		s.size++
+	} else {
+		s.start = (s.start + 1) % n
+	}
+}
+
+func (s *sensor) latest() (Reading, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.size == 0 {
+		return Reading{}, false
+	}
+	return s.buf[(s.start+s.size-1)%len(s.buf)], true
+}
+
+// since 回傳 t 之後（含）的取樣，依時間排序
+func (s *sensor) since(t time.Time) []Reading {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := len(s.buf)
+	// 取樣依時間遞增，二分搜尋第一筆 >= t
+	i := sort.Search(s.size, func(i int) bool {
+		return !s.buf[(s.start+i)%n].Time.Before(t)
+	})
+	out := make([]Reading, 0, s.size-i)
+	for ; i < s.size; i++ {
+		out = append(out, s.buf[(s.start+i)%n])
+	}
+	return out
+}
+
+func (c SensorConfig) validate() error {
+	switch {
+	case c.Name == "":
+		return errors.New("sensor name is required")
+	case c.Width != 1 && c.Width != 2 && c.Width != 4:
+		return fmt.Errorf("sensor %s: width must be 1, 2 or 4", c.Name)
+	}
+	return nil
+}
+
+// decode 將 big-endian bytes 轉成 raw 整數與換算後的值
+func (c SensorConfig) decode(b []byte) (int64, float64) {
+	var u uint64
+	for _, v := range b {
+		u = u<<8 | uint64(v)
+	}
+	raw := int64(u)
+	if c.Signed {
+		shift := 64 - 8*uint(len(b))
+		raw = int64(u<<shift) >> shift
+	}
+	scale := c.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	return raw, float64(raw)*scale + c.Offset
+}
+
+// loadSensors 讀取 I2C_SENSORS（JSON 陣列）或使用 register map 的預設值，並註冊 OTel gauge
+func loadSensors() error {
+	cfgs := defaultSensors()
+	if v := os.Getenv("I2C_SENSORS"); v != "" {
+		cfgs = nil
+		if err := json.Unmarshal([]byte(v), &cfgs); err != nil {
+			return fmt.Errorf("parse I2C_SENSORS: %w", err)
+		}
+	}
+
+	history := sampleHistory
+	if history <= 0 {
+		history = 1
+	}
+	for _, cfg := range cfgs {
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+		if _, dup := sensorIdx[cfg.Name]; dup {
+			return fmt.Errorf("duplicate sensor %s", cfg.Name)
+		}
+		s := &sensor{cfg: cfg, buf: make([]Reading, history)}
+		sensors = append(sensors, s)
+		sensorIdx[cfg.Name] = s
+	}
+	return registerSensorMetrics()
+}
+
+func registerSensorMetrics() error {
+	attrs := metric.WithAttributes(attribute.String("device.name", deviceName))
+
+	var observables []metric.Observable
+	gauges := map[*sensor]metric.Float64ObservableGauge{}
+	for _, s := range sensors {
+		g, err := meter.Float64ObservableGauge(
+			"device.sensor."+s.cfg.Name,
+			metric.WithDescription(fmt.Sprintf("Latest %s reading from register 0x%02x", s.cfg.Name, s.cfg.Reg)),
+			metric.WithUnit(s.cfg.Unit),
+		)
+		if err != nil {
+			return err
+		}
+		gauges[s] = g
+		observables = append(observables, g)
+	}
+
+	errCounter, err := meter.Int64ObservableCounter(
+		"device.sensor.read_errors",
+		metric.WithDescription("Failed sensor reads since start"),
+	)
+	if err != nil {
+		return err
+	}
+	observables = append(observables, errCounter)
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for _, s := range sensors {
+			if r, ok := s.latest(); ok {
+				o.ObserveFloat64(gauges[s], r.Value, attrs)
+			}
+			s.mu.RLock()
+			errs := s.errs
+			s.mu.RUnlock()
+			o.ObserveInt64(errCounter, errs, metric.WithAttributes(
+				attribute.String("device.name", deviceName),
+				attribute.String("sensor", s.cfg.Name),
+			))
+		}
+		return nil
+	}, observables...)
+	return err
+}
+
+// StartSampler 依 I2C_SAMPLE_INTERVAL 取樣所有感測器
+func StartSampler(ctx context.Context) {
+	if i2cDev == nil || len(sensors) == 0 || sampleInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(sampleInterval)
+		defer ticker.Stop()
+
+		logger.Info(fmt.Sprintf("[SENSOR] sampler started sensors=%d interval=%v", len(sensors), sampleInterval))
+		sampleAll(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Info("[SENSOR] sampler stopped")
+				return
+			case <-ticker.C:
+				sampleAll(ctx)
+			}
+		}
+	}()
+}
+
+func sampleAll(ctx context.Context) {
+	if fwBusy.Load() {
+		return
+	}
+	for _, s := range sensors {
+		buf := make([]byte, s.cfg.Width)
+
+		// 每個感測器各自取得 mu，避免整輪取樣期間擋住 LED 指令
+		mu.Lock()
+		err := readReg(ctx, s.cfg.Reg, buf)
+		mu.Unlock()
+
+		if err != nil {
+			s.mu.Lock()
+			s.errs++
+			errs := s.errs
+			s.mu.Unlock()
+			if errs == 1 || errs%100 == 0 {
+				logger.WarnCtx(ctx, fmt.Sprintf("[SENSOR] read %s failed errors=%d error=%v", s.cfg.Name, errs, err))
+			}
+			continue
+		}
+
+		raw, v := s.cfg.decode(buf)
+		s.add(Reading{Time: time.Now().UTC(), Value: v, Raw: raw})
+	}
+}
+
+// Bucket 是降採樣後的一個區間
+type Bucket struct {
+	Time  time.Time `json:"time"`
+	Avg   float64   `json:"avg"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Count int       `json:"count"`
+}
+
+// downsample 以 step 對齊切分區間，空的區間不輸出
+func downsample(rs []Reading, step time.Duration) []Bucket {
+	var out []Bucket
+	var cur *Bucket
+	var sum float64
+	for _, r := range rs {
+		t := r.Time.Truncate(step)
+		if cur == nil || !cur.Time.Equal(t) {
+			if cur != nil {
+				cur.Avg = sum / float64(cur.Count)
+				out = append(out, *cur)
+			}
+			cur = &Bucket{Time: t, Min: math.Inf(1), Max: math.Inf(-1)}
+			sum = 0
+		}
+		cur.Count++
+		sum += r.Value
+		cur.Min = math.Min(cur.Min, r.Value)
+		cur.Max = math.Max(cur.Max, r.Value)
+	}
+	if cur != nil {
+		cur.Avg = sum / float64(cur.Count)
+		out = append(out, *cur)
+	}
+	return out
+}
+
+func listSensors(c *gin.Context) {
+	if c.Param("name") != deviceName {
+		c.JSON(http.StatusNotFound, gin.H{"error": "device not found", "code": "not_found"})
+		return
+	}
+
+	out := make([]gin.H, 0, len(sensors))
+	for _, s := range sensors {
+		item := gin.H{"name": s.cfg.Name, "unit": s.cfg.Unit, "reg": fmt.Sprintf("0x%02x", s.cfg.Reg)}
+		if r, ok := s.latest(); ok {
+			item["latest"] = r
+		}
+		out = append(out, item)
+	}
+	c.JSON(http.StatusOK, gin.H{"device": deviceName, "interval": sampleInterval.String(), "sensors": out})
+}
+
+func querySensor(c *gin.Context) {
+	if c.Param("name") != deviceName {
+		c.JSON(http.StatusNotFound, gin.H{"error": "device not found", "code": "not_found"})
+		return
+	}
+	s, ok := sensorIdx[c.Param("sensor")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "sensor not found", "code": "not_found"})
+		return
+	}
+
+	since, err := util.ParseSince(c.Query("since"), time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_query"})
+		return
+	}
+
+	var step time.Duration
+	if v := c.Query("step"); v != "" {
+		step, err = time.ParseDuration(v)
+		if err != nil || step <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "step must be a positive duration like 1m", "code": "invalid_query"})
+			return
+		}
+	}
+
+	resp := gin.H{"device": deviceName, "sensor": s.cfg.Name, "unit": s.cfg.Unit}
+	rs := s.since(since)
+	if step > 0 {
+		resp["step"] = step.String()
+		resp["points"] = downsample(rs, step)
+	} else {
+		resp["readings"] = rs
+	}
+	c.JSON(http.StatusOK, resp)
+}
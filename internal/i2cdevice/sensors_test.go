@@ -0,0 +1,98 @@
+package i2cdevice
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDownsample(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(sec int, v float64) Reading {
+		return Reading{Time: base.Add(time.Duration(sec) * time.Second), Value: v}
+	}
+
+	tests := []struct {
+		name string
+		rs   []Reading
+		step time.Duration
+		want []Bucket
+	}{
+		{name: "empty", rs: nil, step: time.Minute, want: nil},
+		{
+			name: "single reading",
+			rs:   []Reading{at(5, 1.5)},
+			step: time.Minute,
+			want: []Bucket{{Time: base, Avg: 1.5, Min: 1.5, Max: 1.5, Count: 1}},
+		},
+		{
+			// 區間對齊 step 的整數倍，而不是第一筆取樣的時間
+			name: "buckets align to step",
+			rs:   []Reading{at(25, 1), at(35, 3), at(45, 2), at(61, 10)},
+			step: 30 * time.Second,
+			want: []Bucket{
+				{Time: base, Avg: 1, Min: 1, Max: 1, Count: 1},
+				{Time: base.Add(30 * time.Second), Avg: 2.5, Min: 2, Max: 3, Count: 2},
+				{Time: base.Add(60 * time.Second), Avg: 10, Min: 10, Max: 10, Count: 1},
+			},
+		},
+		{
+			name: "empty buckets are skipped",
+			rs:   []Reading{at(0, -1), at(10, 1), at(300, 4)},
+			step: time.Minute,
+			want: []Bucket{
+				{Time: base, Avg: 0, Min: -1, Max: 1, Count: 2},
+				{Time: base.Add(5 * time.Minute), Avg: 4, Min: 4, Max: 4, Count: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := downsample(tt.rs, tt.step); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("downsample = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSensorSince(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	values := func(rs []Reading) []float64 {
+		out := []float64{}
+		for _, r := range rs {
+			out = append(out, r.Value)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name  string
+		cap   int
+		adds  int // 依序加入 value 0..adds-1，時間間隔 1 秒
+		since time.Time
+		want  []float64
+	}{
+		{name: "empty", cap: 4, adds: 0, since: time.Time{}, want: []float64{}},
+		{name: "not full", cap: 4, adds: 3, since: time.Time{}, want: []float64{0, 1, 2}},
+		{name: "not full since", cap: 4, adds: 3, since: base.Add(time.Second), want: []float64{1, 2}},
+		{name: "wrapped keeps newest", cap: 4, adds: 6, since: time.Time{}, want: []float64{2, 3, 4, 5}},
+		{name: "wrapped since inclusive", cap: 4, adds: 6, since: base.Add(4 * time.Second), want: []float64{4, 5}},
+		{name: "wrapped since before oldest", cap: 4, adds: 6, since: base.Add(time.Second), want: []float64{2, 3, 4, 5}},
+		{name: "wrapped since after newest", cap: 4, adds: 9, since: base.Add(time.Hour), want: []float64{}},
+		{name: "wrapped several times", cap: 3, adds: 10, since: base.Add(8 * time.Second), want: []float64{8, 9}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &sensor{buf: make([]Reading, tt.cap)}
+			for i := 0; i < tt.adds; i++ {
+				s.add(Reading{Time: base.Add(time.Duration(i) * time.Second), Value: float64(i)})
+			}
+			if got := values(s.since(tt.since)); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("since = %v, want %v", got, tt.want)
+			}
+			if r, ok := s.latest(); ok != (tt.adds > 0) || (ok && r.Value != float64(tt.adds-1)) {
+				t.Fatalf("latest = %+v, %v", r, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package i2cdevice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrorClass 描述一次 I2C 失敗是否值得重試
+type ErrorClass int
+
+const (
+	ClassTransient   ErrorClass = iota // NACK、仲裁失敗、EIO 等，重試通常會成功
+	ClassPermanent                     // 參數錯誤、驅動不支援等，重試沒有意義
+	ClassTimeout                       // 超過 transaction deadline
+	ClassCanceled                      // client 中斷請求
+	ClassUnavailable                   // 裝置未開啟或已移除
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ClassTransient:
+		return "transient"
+	case ClassPermanent:
+		return "permanent"
+	case ClassTimeout:
+		return "timeout"
+	case ClassCanceled:
+		return "canceled"
+	case ClassUnavailable:
+		return "unavailable"
+	}
+	return "unknown"
+}
+
+// RetryPolicy 控制單一 transaction 的重試與時間上限
+type RetryPolicy struct {
+	MaxAttempts int           // 含第一次嘗試
+	BaseDelay   time.Duration // 第一次重試前的等待，之後指數成長
+	MaxDelay    time.Duration // 單次等待上限
+	Timeout     time.Duration // 整個 transaction（含重試）的上限，會再受 request context 限制
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   5 * time.Millisecond,
+	MaxDelay:    100 * time.Millisecond,
+	Timeout:     2 * time.Second,
+}
+
+var (
+	txPolicy = DefaultRetryPolicy
+
+	ErrDeviceUnavailable = errors.New("i2c device unavailable")
+)
+
+// statusClientClosedRequest 沿用 nginx 的 499，表示 client 已經斷線
+const statusClientClosedRequest = 499
+
+// TxError 是 transaction 層回傳的錯誤，帶有分類與重試次數
+type TxError struct {
+	Op       string
+	Reg      byte
+	Attempts int
+	Class    ErrorClass
+	Err      error
+}
+
+func (e *TxError) Error() string {
+	return fmt.Sprintf("i2c %s reg=0x%02x failed after %d attempt(s) (%s): %v",
+		e.Op, e.Reg, e.Attempts, e.Class, e.Err)
+}
+
+func (e *TxError) Unwrap() error { return e.Err }
+
+// Code 回傳給 API client 的結構化錯誤代碼
+func (e *TxError) Code() string {
+	switch e.Class {
+	case ClassTransient:
+		return "i2c_bus_error"
+	case ClassPermanent:
+		return "i2c_device_error"
+	case ClassTimeout:
+		return "i2c_timeout"
+	case ClassCanceled:
+		return "request_canceled"
+	case ClassUnavailable:
+		return "device_unavailable"
+	}
+	return "i2c_error"
+}
+
+// HTTPStatus 將錯誤分類對應到 HTTP 狀態碼
+func (e *TxError) HTTPStatus() int {
+	switch e.Class {
+	case ClassTransient, ClassUnavailable:
+		return http.StatusServiceUnavailable
+	case ClassPermanent:
+		return http.StatusBadGateway
+	case ClassTimeout:
+		return http.StatusGatewayTimeout
+	case ClassCanceled:
+		return statusClientClosedRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// Classify 依 errno 判斷錯誤是否為暫時性（參考 kernel Documentation/i2c/fault-codes）
+func Classify(err error) ErrorClass {
+	switch {
+	case err == nil:
+		return ClassPermanent
+	case errors.Is(err, ErrDeviceUnavailable):
+		return ClassUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return ClassTimeout
+	case errors.Is(err, context.Canceled):
+		return ClassCanceled
+	}
+
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return ClassPermanent
+	}
+
+	switch errno {
+	case syscall.EAGAIN, // 仲裁失敗
+		syscall.EIO,       // 一般匯流排錯誤
+		syscall.ENXIO,     // 位址階段沒有 ACK
+		syscall.EREMOTEIO, // 資料階段 NACK
+		syscall.ETIMEDOUT, // adapter 逾時（例如 clock stretching 過久）
+		syscall.EBUSY,     // 匯流排被佔用
+		syscall.EPROTO:    // 協定錯誤，多半是雜訊
+		return ClassTransient
+	case syscall.ENODEV, syscall.ESHUTDOWN, syscall.EBADF:
+		return ClassUnavailable
+	}
+	return ClassPermanent
+}
+
+// Conn 是單一 I2C slave 的暫存器存取介面，*i2c.Device 即為實作
+type Conn interface {
+	ReadReg(reg byte, buf []byte) error
+	WriteReg(reg byte, buf []byte) error
+}
+
+// primaryConn 回傳 LED 所在的 STM32；未開啟時回傳 nil（避免 typed nil）
+func primaryConn() Conn {
+	if i2cDev == nil {
+		return nil
+	}
+	return i2cDev
+}
+
+// readReg / writeReg 存取 primary 裝置，會依 txPolicy 重試，呼叫端須先持有 mu
+func readReg(ctx context.Context, reg byte, buf []byte) error {
+	return readRegOn(ctx, primaryConn(), reg, buf)
+}
+
+func writeReg(ctx context.Context, reg byte, data []byte) error {
+	return writeRegOn(ctx, primaryConn(), reg, data)
+}
+
+// readRegOn / writeRegOn 存取任一裝置，呼叫端須先持有該裝置所在匯流排的 lock
+func readRegOn(ctx context.Context, conn Conn, reg byte, buf []byte) error {
+	return transact(ctx, conn, "read", reg, func() error {
+		return conn.ReadReg(reg, buf)
+	})
+}
+
+func writeRegOn(ctx context.Context, conn Conn, reg byte, data []byte) error {
+	return transact(ctx, conn, "write", reg, func() error {
+		return conn.WriteReg(reg, data)
+	})
+}
+
+func transact(ctx context.Context, conn Conn, op string, reg byte, fn func() error) error {
+	if conn == nil {
+		return &TxError{Op: op, Reg: reg, Class: ClassUnavailable, Err: ErrDeviceUnavailable}
+	}
+	if fwBusy.Load() && conn == primaryConn() {
+		return &TxError{Op: op, Reg: reg, Class: ClassUnavailable, Err: ErrFirmwareUpdating}
+	}
+	err := doTransact(ctx, op, reg, fn)
+	// 可用狀態與事件目前只追蹤 primary 裝置
+	if conn == primaryConn() {
+		updateAvailability(err)
+	}
+	return err
+}
+
+func doTransact(ctx context.Context, op string, reg byte, fn func() error) error {
+	span := trace.SpanFromContext(ctx)
+
+	ctx, cancel := context.WithTimeout(ctx, txPolicy.Timeout)
+	defer cancel()
+
+	var err error
+	attempt := 0
+	for attempt < txPolicy.MaxAttempts {
+		if cerr := ctx.Err(); cerr != nil {
+			return &TxError{Op: op, Reg: reg, Attempts: attempt, Class: Classify(cerr), Err: lastErr(err, cerr)}
+		}
+
+		attempt++
+		err = fn()
+		if err == nil {
+			if attempt > 1 {
+				span.SetAttributes(attribute.Int("i2c.attempts", attempt))
+			}
+			return nil
+		}
+
+		class := Classify(err)
+		if class != ClassTransient {
+			return &TxError{Op: op, Reg: reg, Attempts: attempt, Class: class, Err: err}
+		}
+		if attempt >= txPolicy.MaxAttempts {
+			break
+		}
+
+		delay := backoff(attempt)
+		span.AddEvent("i2c.retry", trace.WithAttributes(
+			attribute.String("i2c.op", op),
+			attribute.Int("i2c.reg", int(reg)),
+			attribute.Int("i2c.attempt", attempt),
+			attribute.String("error", err.Error()),
+		))
+		logger.WarnCtx(ctx, fmt.Sprintf(
+			"[I2C] %s reg=0x%02x attempt=%d transient error=%v retry_in=%v",
+			op, reg, attempt, err, delay,
+		))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+
+	return &TxError{Op: op, Reg: reg, Attempts: attempt, Class: ClassTransient, Err: err}
+}
+
+// backoff 指數成長並加上最多一半的 jitter，避免多個請求同時重試
+func backoff(attempt int) time.Duration {
+	d := txPolicy.BaseDelay << (attempt - 1)
+	if d <= 0 || d > txPolicy.MaxDelay {
+		d = txPolicy.MaxDelay
+	}
+	if half := int64(d / 2); half > 0 {
+		d = d/2 + time.Duration(rand.Int63n(half+1))
+	}
+	return d
+}
+
+// lastErr 在 deadline 到期時保留最後一次的匯流排錯誤，方便除錯
+func lastErr(busErr, ctxErr error) error {
+	if busErr == nil {
+		return ctxErr
+	}
+	return fmt.Errorf("%w (last bus error: %v)", ctxErr, busErr)
+}
+
+// replyTxError 依錯誤分類輸出對應的狀態碼與錯誤代碼
+func replyTxError(c *gin.Context, err error) {
+	var txErr *TxError
+	if !errors.As(err, &txErr) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "i2c_error"})
+		return
+	}
+
+	span := trace.SpanFromContext(c.Request.Context())
+	span.SetAttributes(
+		attribute.String("i2c.error_class", txErr.Class.String()),
+		attribute.Int("i2c.attempts", txErr.Attempts),
+	)
+
+	status := txErr.HTTPStatus()
+	if status == http.StatusServiceUnavailable {
+		c.Header("Retry-After", "1")
+	}
+	c.JSON(status, gin.H{
+		"error":    txErr.Error(),
+		"code":     txErr.Code(),
+		"class":    txErr.Class.String(),
+		"attempts": txErr.Attempts,
+	})
+}
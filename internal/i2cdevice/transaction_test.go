@@ -0,0 +1,125 @@
+package i2cdevice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"nil", nil, ClassPermanent},
+		{"arbitration lost", syscall.EAGAIN, ClassTransient},
+		{"bus error", syscall.EIO, ClassTransient},
+		{"address nack", syscall.ENXIO, ClassTransient},
+		{"data nack", syscall.EREMOTEIO, ClassTransient},
+		{"adapter timeout", syscall.ETIMEDOUT, ClassTransient},
+		{"bus busy", syscall.EBUSY, ClassTransient},
+		{"protocol error", syscall.EPROTO, ClassTransient},
+		{"wrapped errno", &os.PathError{Op: "write", Path: "/dev/i2c-1", Err: syscall.EIO}, ClassTransient},
+		{"invalid argument", syscall.EINVAL, ClassPermanent},
+		{"not supported", syscall.EOPNOTSUPP, ClassPermanent},
+		{"not an errno", errors.New("boom"), ClassPermanent},
+		{"device removed", syscall.ENODEV, ClassUnavailable},
+		{"adapter shut down", syscall.ESHUTDOWN, ClassUnavailable},
+		{"closed fd", syscall.EBADF, ClassUnavailable},
+		{"not opened", ErrDeviceUnavailable, ClassUnavailable},
+		{"firmware update", ErrFirmwareUpdating, ClassUnavailable},
+		{"deadline", context.DeadlineExceeded, ClassTimeout},
+		{"wrapped deadline", fmt.Errorf("tx: %w", context.DeadlineExceeded), ClassTimeout},
+		{"canceled", context.Canceled, ClassCanceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Fatalf("Classify(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDoTransactRetries(t *testing.T) {
+	old := txPolicy
+	txPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond, Timeout: time.Second}
+	t.Cleanup(func() { txPolicy = old })
+
+	tests := []struct {
+		name         string
+		errs         []error // 依序回傳，用完之後回 nil
+		wantAttempts int
+		wantClass    ErrorClass // wantErr 為 false 時忽略
+		wantErr      bool
+		wantStatus   int
+		wantCode     string
+	}{
+		{name: "first try", wantAttempts: 1},
+		{name: "transient then ok", errs: []error{syscall.EIO, syscall.EAGAIN}, wantAttempts: 3},
+		{
+			name: "transient exhausted", errs: []error{syscall.EIO, syscall.EIO, syscall.EIO},
+			wantAttempts: 3, wantErr: true, wantClass: ClassTransient,
+			wantStatus: http.StatusServiceUnavailable, wantCode: "i2c_bus_error",
+		},
+		{
+			name: "permanent not retried", errs: []error{syscall.EINVAL},
+			wantAttempts: 1, wantErr: true, wantClass: ClassPermanent,
+			wantStatus: http.StatusBadGateway, wantCode: "i2c_device_error",
+		},
+		{
+			name: "unavailable not retried", errs: []error{syscall.ENODEV},
+			wantAttempts: 1, wantErr: true, wantClass: ClassUnavailable,
+			wantStatus: http.StatusServiceUnavailable, wantCode: "device_unavailable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := doTransact(context.Background(), "read", 0x01, func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+			if calls != tt.wantAttempts {
+				t.Fatalf("called %d times, want %d", calls, tt.wantAttempts)
+			}
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var txErr *TxError
+			if !errors.As(err, &txErr) {
+				t.Fatalf("err = %v, want *TxError", err)
+			}
+			if txErr.Class != tt.wantClass || txErr.Attempts != tt.wantAttempts ||
+				txErr.HTTPStatus() != tt.wantStatus || txErr.Code() != tt.wantCode {
+				t.Fatalf("got class=%s attempts=%d status=%d code=%s", txErr.Class, txErr.Attempts, txErr.HTTPStatus(), txErr.Code())
+			}
+		})
+	}
+}
+
+func TestDoTransactCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := doTransact(ctx, "write", 0x02, func() error { return nil })
+
+	var txErr *TxError
+	if !errors.As(err, &txErr) || txErr.Class != ClassCanceled || txErr.Attempts != 0 {
+		t.Fatalf("err = %v, want canceled before the first attempt", err)
+	}
+	if txErr.HTTPStatus() != statusClientClosedRequest {
+		t.Fatalf("status = %d", txErr.HTTPStatus())
+	}
+}
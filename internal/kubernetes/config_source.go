@@ -0,0 +1,176 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+// ConfigSource 指定要監看的 ConfigMap 與 Secret，兩者的 key 合併後一起套用，Secret 優先
+type ConfigSource struct {
+	Namespace string // 空字串時使用 pod 所在 namespace
+	ConfigMap string
+	Secret    string
+	// SecretKeys 決定 Secret 中哪些 key 是設定；其餘 key 略過並送出 Warning event。nil 時全部採用
+	SecretKeys func(key string) bool
+}
+
+// ApplyFunc 驗證並套用合併後的設定；回傳錯誤時呼叫端必須維持原本的設定
+type ApplyFunc func(data map[string]string) error
+
+// ConfigSourceFromEnv 讀取 CONFIG_NAMESPACE、CONFIG_MAP_NAME、CONFIG_SECRET_NAME
+func ConfigSourceFromEnv() ConfigSource {
+	return ConfigSource{
+		Namespace: os.Getenv("CONFIG_NAMESPACE"),
+		ConfigMap: os.Getenv("CONFIG_MAP_NAME"),
+		Secret:    os.Getenv("CONFIG_SECRET_NAME"),
+	}
+}
+
+// Enabled 回報是否有指定任何來源
+func (s ConfigSource) Enabled() bool { return s.ConfigMap != "" || s.Secret != "" }
+
+type configWatcher struct {
+	src    ConfigSource
+	apply  ApplyFunc
+	synced atomic.Bool
+
+	mu       sync.Mutex
+	cm       *v1.ConfigMap
+	secret   *v1.Secret
+	lastGood map[string]string
+	ignored  []string // 上次略過的 Secret key，改變時才再警告
+}
+
+// WatchConfig 以 informer 直接監看 API，不必等 kubelet 同步 volume。
+// 每次 ConfigMap / Secret 改變都以完整內容呼叫 apply；apply 失敗時保留上一份有效的設定，
+// 並在 ConfigMap（或 Secret）上送出 ConfigRejected Warning event
+func WatchConfig(ctx context.Context, src ConfigSource, apply ApplyFunc) error {
+	if clientSet == nil {
+		return ErrNoClient
+	}
+	if src.Namespace == "" {
+		_, src.Namespace, _ = podIdentity()
+	}
+	if src.Namespace == "" {
+		return ErrNoPodIdentity
+	}
+
+	w := &configWatcher{src: src, apply: apply}
+	var syncs []toolscache.InformerSynced
+	if src.ConfigMap != "" {
+		inf := w.factory(src.ConfigMap).Core().V1().ConfigMaps().Informer()
+		if _, err := inf.AddEventHandler(w.handler(func(obj any) {
+			cm, _ := obj.(*v1.ConfigMap)
+			w.cm = cm
+		})); err != nil {
+			return err
+		}
+		go inf.Run(ctx.Done())
+		syncs = append(syncs, inf.HasSynced)
+	}
+	if src.Secret != "" {
+		inf := w.factory(src.Secret).Core().V1().Secrets().Informer()
+		if _, err := inf.AddEventHandler(w.handler(func(obj any) {
+			s, _ := obj.(*v1.Secret)
+			w.secret = s
+		})); err != nil {
+			return err
+		}
+		go inf.Run(ctx.Done())
+		syncs = append(syncs, inf.HasSynced)
+	}
+
+	go func() {
+		if !toolscache.WaitForCacheSync(ctx.Done(), syncs...) {
+			return
+		}
+		w.synced.Store(true)
+		w.reload()
+	}()
+	logger.Info(fmt.Sprintf("[K8S] watching config namespace=%s configmap=%q secret=%q", src.Namespace, src.ConfigMap, src.Secret))
+	return nil
+}
+
+func (w *configWatcher) factory(name string) informers.SharedInformerFactory {
+	return informers.NewSharedInformerFactoryWithOptions(clientSet, 0,
+		informers.WithNamespace(w.src.Namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}),
+	)
+}
+
+// handler 以 set 記下最新物件（刪除時為 nil）再重新套用；cache 同步前只記錄，等同步後套用一次
+func (w *configWatcher) handler(set func(obj any)) toolscache.ResourceEventHandlerFuncs {
+	update := func(obj any) {
+		w.mu.Lock()
+		set(obj)
+		w.mu.Unlock()
+		if w.synced.Load() {
+			w.reload()
+		}
+	}
+	return toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    update,
+		UpdateFunc: func(_, obj any) { update(obj) },
+		DeleteFunc: func(any) { update(nil) },
+	}
+}
+
+func (w *configWatcher) reload() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data := map[string]string{}
+	var obj runtime.Object
+	if w.cm != nil {
+		maps.Copy(data, w.cm.Data)
+		obj = w.cm
+	}
+	var ignored []string
+	if w.secret != nil {
+		for k, v := range w.secret.Data {
+			if w.src.SecretKeys != nil && !w.src.SecretKeys(k) {
+				ignored = append(ignored, k)
+				continue
+			}
+			data[k] = string(v)
+		}
+		if obj == nil {
+			obj = w.secret
+		}
+	}
+	slices.Sort(ignored)
+	if len(ignored) > 0 && !slices.Equal(ignored, w.ignored) {
+		logger.Warn(fmt.Sprintf("[K8S] ignoring unknown keys in secret %s: %v", w.src.Secret, ignored))
+		eventfOn(w.secret, EventWarning, ReasonConfigIgnoredKeys, "Ignoring unknown keys in Secret %s: %v", w.src.Secret, ignored)
+	}
+	w.ignored = ignored
+	if w.lastGood != nil && maps.Equal(data, w.lastGood) {
+		return
+	}
+
+	// Secret 的值不寫進 log 與 event，只列出 key
+	keys := slices.Sorted(maps.Keys(data))
+	if err := w.apply(data); err != nil {
+		logger.Error(fmt.Sprintf("[K8S] config rejected, keeping previous configuration: %v", err))
+		eventfOn(obj, EventWarning, ReasonConfigRejected, "Invalid configuration, keeping previous configuration: %v", err)
+		return
+	}
+	w.lastGood = data
+	logger.Info(fmt.Sprintf("[K8S] config reloaded keys=%v", keys))
+	eventfOn(obj, EventNormal, ReasonConfigReloaded, "Configuration reloaded (keys: %v)", keys)
+}
@@ -0,0 +1,92 @@
+package kubernetes
+
+import (
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/config"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestConfigReloadMixedKeys(t *testing.T) {
+	tests := []struct {
+		name        string
+		cm          map[string]string
+		secret      map[string]string
+		wantData    map[string]string // nil 表示整份被拒絕
+		wantErr     string
+		wantIgnored []string
+	}{
+		{
+			name:        "unknown secret keys are ignored",
+			cm:          map[string]string{config.KeyLogLevel: "warn"},
+			secret:      map[string]string{config.KeyRateLimit: "5", "tls.crt": "cert", "password": "s3cr3t"},
+			wantData:    map[string]string{config.KeyLogLevel: "warn", config.KeyRateLimit: "5"},
+			wantIgnored: []string{"password", "tls.crt"},
+		},
+		{
+			name:        "secret with only unknown keys",
+			secret:      map[string]string{"api-token": "x"},
+			wantData:    map[string]string{},
+			wantIgnored: []string{"api-token"},
+		},
+		{
+			name:     "secret overrides configmap",
+			cm:       map[string]string{config.KeyLogLevel: "warn"},
+			secret:   map[string]string{config.KeyLogLevel: "debug"},
+			wantData: map[string]string{config.KeyLogLevel: "debug"},
+		},
+		{
+			// ConfigMap 只放設定，打錯字的 key 仍整份拒絕
+			name:        "unknown configmap key is rejected",
+			cm:          map[string]string{config.KeyLogLevel: "warn", "log_lvl": "debug"},
+			secret:      map[string]string{"tls.crt": "cert"},
+			wantErr:     "log_lvl: unknown key",
+			wantIgnored: []string{"tls.crt"},
+		},
+		{
+			name:        "invalid known secret key is rejected",
+			secret:      map[string]string{config.KeyRateBurst: "0", "tls.crt": "cert"},
+			wantErr:     "rate_limit_burst",
+			wantIgnored: []string{"tls.crt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var applied map[string]string
+			var applyErr error
+			w := &configWatcher{
+				src: ConfigSource{ConfigMap: "web", Secret: "web", SecretKeys: config.IsKey},
+				apply: func(data map[string]string) error {
+					_, applyErr = config.Parse(config.Defaults(), data)
+					if applyErr == nil {
+						applied = data
+					}
+					return applyErr
+				},
+			}
+			if tt.cm != nil {
+				w.cm = &v1.ConfigMap{Data: tt.cm}
+			}
+			secret := &v1.Secret{Data: map[string][]byte{}}
+			for k, v := range tt.secret {
+				secret.Data[k] = []byte(v)
+			}
+			w.secret = secret
+
+			w.reload()
+
+			if tt.wantErr != "" {
+				if applyErr == nil || !strings.Contains(applyErr.Error(), tt.wantErr) || w.lastGood != nil {
+					t.Fatalf("err = %v lastGood = %v, want %q", applyErr, w.lastGood, tt.wantErr)
+				}
+			} else if !maps.Equal(applied, tt.wantData) || !maps.Equal(w.lastGood, tt.wantData) {
+				t.Fatalf("applied = %v, want %v", applied, tt.wantData)
+			}
+			if strings.Join(w.ignored, ",") != strings.Join(tt.wantIgnored, ",") {
+				t.Fatalf("ignored = %v, want %v", w.ignored, tt.wantIgnored)
+			}
+		})
+	}
+}
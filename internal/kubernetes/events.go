@@ -0,0 +1,127 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/tools/reference"
+)
+
+// Kubernetes Event 的 reason，kubectl describe 會顯示在 Events 區塊
+const (
+	ReasonDeviceUnavailable = "DeviceUnavailable"
+	ReasonDeviceAvailable   = "DeviceAvailable"
+	ReasonCacheDegraded     = "CacheDegraded"
+	ReasonCacheRecovered    = "CacheRecovered"
+	ReasonConfigReloaded    = "ConfigReloaded"
+	ReasonConfigRejected    = "ConfigRejected"
+	ReasonConfigIgnoredKeys = "ConfigIgnoredKeys"
+	ReasonLeaderFallback    = "LeaderElectionFallback"
+)
+
+// Event 類型，與 core/v1 相同
+const (
+	EventNormal  = v1.EventTypeNormal
+	EventWarning = v1.EventTypeWarning
+)
+
+const eventComponent = "web-server-in-go"
+
+type eventSink struct {
+	recorder record.EventRecorder
+	ref      *v1.ObjectReference
+}
+
+// sink 在 StartEvents 之後才設定，Eventf 可能同時在其他 goroutine 被呼叫
+var sink atomic.Pointer[eventSink]
+
+// StartEvents 建立 event recorder，event 掛在目前的 Pod 上；
+// 查不到 Pod（例如沒有 RBAC）時改掛在 Node 上。需在 Start 之後呼叫。
+//
+// 相同的 event 由 client-go 的 correlator 合併成一筆並累加 count，
+// 同一個物件的 event 以 token bucket 限流（K8S_EVENT_BURST、K8S_EVENT_QPS）
+func StartEvents(ctx context.Context) error {
+	if clientSet == nil {
+		return ErrNoClient
+	}
+	ref, ns, err := eventTarget(ctx)
+	if err != nil {
+		return err
+	}
+
+	burst, _ := strconv.Atoi(os.Getenv("K8S_EVENT_BURST"))
+	qps, _ := strconv.ParseFloat(os.Getenv("K8S_EVENT_QPS"), 32)
+	b := record.NewBroadcaster(record.WithContext(ctx), record.WithCorrelatorOptions(record.CorrelatorOptions{
+		BurstSize: burst, // 0 時使用 client-go 預設值（25）
+		QPS:       float32(qps),
+	}))
+	b.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientSet.CoreV1().Events(ns)})
+
+	node, _ := Snapshot()
+	sink.Store(&eventSink{
+		recorder: b.NewRecorder(scheme.Scheme, v1.EventSource{Component: eventComponent, Host: node.Name}),
+		ref:      ref,
+	})
+
+	go func() {
+		<-ctx.Done()
+		b.Shutdown()
+	}()
+	logger.Info(fmt.Sprintf("[K8S] event recorder started object=%s/%s", ref.Kind, ref.Name))
+	return nil
+}
+
+// eventTarget 需要 UID，kubectl describe 以 involvedObject.uid 比對 event
+func eventTarget(ctx context.Context) (*v1.ObjectReference, string, error) {
+	if name, ns, ok := podIdentity(); ok {
+		gctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		p, err := clientSet.CoreV1().Pods(ns).Get(gctx, name, metav1.GetOptions{})
+		cancel()
+		if err == nil {
+			ref, err := reference.GetReference(scheme.Scheme, p)
+			return ref, ns, err
+		}
+		logger.Warn(fmt.Sprintf("[K8S] pod %s/%s not readable, attaching events to node: %v", ns, name, err))
+	}
+
+	node, ok := Snapshot()
+	if !ok {
+		return nil, "", ErrNoPodIdentity
+	}
+	// 與 kubelet 相同：node event 的 UID 是 node 名稱，namespace 為 default
+	return &v1.ObjectReference{Kind: "Node", Name: node.Name, UID: types.UID(node.Name)}, metav1.NamespaceDefault, nil
+}
+
+// Eventf 送出一筆 Kubernetes Event；recorder 尚未啟動（例如叢集外）時不做事
+func Eventf(eventtype, reason, format string, args ...any) {
+	s := sink.Load()
+	if s == nil {
+		return
+	}
+	s.recorder.Eventf(s.ref, eventtype, reason, format, args...)
+}
+
+// eventfOn 把 event 掛在指定物件上（例如 ConfigMap）；obj 為 nil 時掛在預設物件上
+func eventfOn(obj runtime.Object, eventtype, reason, format string, args ...any) {
+	s := sink.Load()
+	if s == nil {
+		return
+	}
+	if obj == nil {
+		s.recorder.Eventf(s.ref, eventtype, reason, format, args...)
+		return
+	}
+	s.recorder.Eventf(obj, eventtype, reason, format, args...)
+}
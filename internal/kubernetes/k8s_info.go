@@ -2,14 +2,22 @@ package kubernetes
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/HarrisonZz/web_server_in_go/internal/logger"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
 )
 
 // ─── NODE 資訊取得 ───────────────────────────────────────────────────
@@ -23,56 +31,252 @@ type Node struct {
 	Arch       string            `json:"arch"`
 	Kernel     string            `json:"kernel"`
 	OSImage    string            `json:"os_image"`
+	Source     string            `json:"source"` // 資訊來源，見 Source* 常數
+
+	// 以下只有 API 來源才有
+	Conditions    []NodeCondition `json:"conditions,omitempty"`
+	Taints        []Taint         `json:"taints,omitempty"`
+	Unschedulable bool            `json:"unschedulable"` // 已被 cordon
 }
 
+// ChangeFunc 在 node 資訊改變時呼叫，old 在第一次取得時為 nil
+type ChangeFunc func(old, cur *Node)
+
+// informer 每次 resync 的間隔；node 本身的變動由 watch 即時推送
+const nodeResync = 10 * time.Minute
+
+var (
+	ErrNoCluster  = errors.New("not running in a kubernetes cluster")
+	ErrNoNodeName = errors.New("NODE_NAME is not set")
+)
+
 var (
-	clientSet *kubernetes.Clientset
-	NodeInfo  *Node
+	clientSet kubernetes.Interface
+
+	nodeMu    sync.RWMutex
+	current   *Node
+	fallback  *Node // 靜態來源合併的結果，補 informer 沒有的欄位
+	pod       *PodInfo
+	listeners []ChangeFunc
+
+	ready     = make(chan struct{})
+	readyOnce sync.Once
 )
 
-func init() {
-	clientSet = newClient()
-	node_name := os.Getenv("NODE_NAME")
+// Start 依 cfg.Sources 的順序取得 node 資訊：API 來源以 informer 持續更新，
+// 靜態來源（downward、host）只讀一次；排在後面的靜態來源用來補缺少的欄位
+// 第一個能建立 client 的 API 來源會保留給 pod、peers、events 使用，即使 informer 啟動失敗
+func Start(ctx context.Context, cfg Config) error {
+	if len(cfg.Sources) == 0 {
+		cfg.Sources = DefaultSources
+	}
+	if p, ok := downwardPod(cfg.PodInfoDir); ok {
+		nodeMu.Lock()
+		pod = p
+		nodeMu.Unlock()
+	}
+
+	var errs []error
+	for i, src := range cfg.Sources {
+		rest := cfg.Sources[i+1:]
+		switch src {
+		case SourceInCluster, SourceKubeconfig:
+			cs, mc, err := newClients(src, cfg)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", src, err))
+				continue
+			}
+			// pod、peers、events 等只需要 client，不受 node informer 是否成功影響
+			if clientSet == nil {
+				clientSet, metricsClient = cs, mc
+			}
+			err = startInformer(ctx, src, cs, mergeStatic(rest, cfg))
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", src, err))
+		case SourceDownward, SourceHost:
+			n, err := staticNode(src, cfg)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", src, err))
+				continue
+			}
+			n.fill(mergeStatic(rest, cfg))
+			setNode(n)
+			logger.Info(fmt.Sprintf("[K8S] node info from %s node=%s", src, n.Name))
+			return nil
+		default:
+			errs = append(errs, fmt.Errorf("unknown source %q", src))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// mergeStatic 依序合併可用的靜態來源，前面的優先
+func mergeStatic(sources []string, cfg Config) *Node {
+	var out *Node
+	for _, src := range sources {
+		if src != SourceDownward && src != SourceHost {
+			continue
+		}
+		n, err := staticNode(src, cfg)
+		if err != nil {
+			continue
+		}
+		if out == nil {
+			out = n
+			continue
+		}
+		out.fill(n)
+	}
+	return out
+}
+
+// startInformer 先以 Get 確認 API server 可用且有權限，再以 informer 監看 NODE_NAME 指定的 node
+func startInformer(ctx context.Context, source string, cs kubernetes.Interface, fb *Node) error {
+	nodeName := os.Getenv("NODE_NAME")
+	if nodeName == "" {
+		return ErrNoNodeName
+	}
 
-	info, err := getNodeInfo(clientSet, node_name)
+	gctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	node, err := cs.CoreV1().Nodes().Get(gctx, nodeName, metav1.GetOptions{})
+	cancel()
 	if err != nil {
-		logger.Error(fmt.Sprintf("Failed to preload NodeInfo: %v", err))
+		return err
+	}
+
+	nodeMu.Lock()
+	fallback = fb
+	nodeMu.Unlock()
+	updateNode(source, node)
+
+	factory := informers.NewSharedInformerFactoryWithOptions(cs, nodeResync,
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.FieldSelector = fields.OneTermEqualSelector("metadata.name", nodeName).String()
+		}),
+	)
+	inf := factory.Core().V1().Nodes().Informer()
+	_, err = inf.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj any) { updateNode(source, obj) },
+		UpdateFunc: func(_, obj any) { updateNode(source, obj) },
+		DeleteFunc: func(any) {
+			// 保留最後一份 snapshot，node 被刪除時 pod 通常也即將被驅逐
+			logger.Warn(fmt.Sprintf("[K8S] node %s deleted, keeping last known info", nodeName))
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	factory.Start(ctx.Done())
+	logger.Info(fmt.Sprintf("[K8S] node informer started source=%s node=%s", source, nodeName))
+	return nil
+}
+
+func updateNode(source string, obj any) {
+	n, ok := obj.(*v1.Node)
+	if !ok {
+		return
+	}
+	info := toNode(n)
+	info.Source = source
+	nodeMu.RLock()
+	info.fill(fallback)
+	nodeMu.RUnlock()
+	setNode(info)
+}
+
+// setNode 更新 snapshot；內容沒變（例如只有 heartbeat）時不通知
+func setNode(info *Node) {
+	nodeMu.Lock()
+	old := current
+	changed := old == nil || !reflect.DeepEqual(old, info)
+	if changed {
+		current = info
+	}
+	fns := listeners
+	nodeMu.Unlock()
+
+	readyOnce.Do(func() {
+		close(ready)
+		logger.Info(fmt.Sprintf("NodeInfo initialized: %s (%s)", info.Name, info.InternalIP))
+	})
+	if !changed || old == nil {
 		return
 	}
 
-	NodeInfo = info
-	logger.Info(fmt.Sprintf("NodeInfo initialized: %s (%s)", NodeInfo.Name, NodeInfo.InternalIP))
+	logger.Info(fmt.Sprintf("[K8S] node %s changed", info.Name))
+	for _, fn := range fns {
+		fn(old.clone(), info.clone())
+	}
 }
 
-func newClient() *kubernetes.Clientset {
+// OnChange 註冊 node 資訊改變時的 callback（例如清除快取）
+func OnChange(fn ChangeFunc) {
+	nodeMu.Lock()
+	defer nodeMu.Unlock()
+	listeners = append(listeners, fn)
+}
 
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		return nil
+// Snapshot 回傳目前 node 資訊的副本；尚未取得時 ok 為 false
+func Snapshot() (Node, bool) {
+	nodeMu.RLock()
+	defer nodeMu.RUnlock()
+	if current == nil {
+		return Node{}, false
 	}
-	clientSet, err := kubernetes.NewForConfig(config)
+	return *current.clone(), true
+}
 
-	return clientSet
+// Pod 回傳 Downward API 提供的 pod 資訊
+func Pod() (PodInfo, bool) {
+	nodeMu.RLock()
+	defer nodeMu.RUnlock()
+	if pod == nil {
+		return PodInfo{}, false
+	}
+	p := *pod
+	p.Labels = maps.Clone(pod.Labels)
+	return p, true
 }
 
-func getNodeInfo(clientset *kubernetes.Clientset, nodeName string) (*Node, error) {
-	node, err := clientset.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
-	if err != nil {
-		return nil, err
+// Ready 在第一次取得 node 資訊後關閉
+func Ready() <-chan struct{} { return ready }
+
+func IsReady() bool {
+	select {
+	case <-ready:
+		return true
+	default:
+		return false
 	}
+}
 
-	info := &Node{
+func (n *Node) clone() *Node {
+	c := *n
+	c.Labels = maps.Clone(n.Labels)
+	c.Conditions = slices.Clone(n.Conditions)
+	c.Taints = slices.Clone(n.Taints)
+	return &c
+}
+
+func toNode(node *v1.Node) *Node {
+	return &Node{
 		Name:       node.Name,
 		InternalIP: getNodeIP(node, v1.NodeInternalIP),
-		Labels:     node.Labels,
+		Labels:     maps.Clone(node.Labels), // informer cache 的物件不可修改
 		CPU:        node.Status.Allocatable.Cpu().String(),
 		Memory:     node.Status.Allocatable.Memory().String(),
 		OS:         node.Status.NodeInfo.OperatingSystem,
 		Arch:       node.Status.NodeInfo.Architecture,
 		Kernel:     node.Status.NodeInfo.KernelVersion,
 		OSImage:    node.Status.NodeInfo.OSImage,
+
+		Conditions:    toConditions(node.Status.Conditions),
+		Taints:        toTaints(node.Spec.Taints),
+		Unschedulable: node.Spec.Unschedulable,
 	}
-	return info, nil
 }
 
 func getNodeIP(node *v1.Node, ipType v1.NodeAddressType) string {
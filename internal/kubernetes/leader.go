@@ -0,0 +1,298 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// leader election 的實作方式，見 LeaderConfig.Backend
+const (
+	LeaderBackendAuto  = "auto"  // 有 API server 用 Lease，否則用檔案鎖
+	LeaderBackendLease = "lease" // coordination.k8s.io Lease
+	LeaderBackendFile  = "file"  // 本機 flock，只能協調同一台機器上的 process
+	LeaderBackendOff   = "off"   // 不選舉，永遠是 leader（單一副本）
+)
+
+// LeaderConfig 決定 leader election 的參數
+type LeaderConfig struct {
+	Backend       string
+	LeaseName     string
+	Namespace     string // 空字串時使用 pod 所在 namespace
+	Identity      string // 空字串時使用 pod 名稱或 hostname_pid
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+	LockFile      string
+}
+
+// LeaderStatus 是 GET /leader 的內容
+type LeaderStatus struct {
+	Backend  string     `json:"backend"`
+	Lock     string     `json:"lock"` // namespace/lease 或鎖檔路徑
+	Identity string     `json:"identity"`
+	Holder   string     `json:"holder,omitempty"` // 目前的 leader，未知時為空
+	IsLeader bool       `json:"is_leader"`
+	Since    *time.Time `json:"since,omitempty"` // 本 process 取得 leadership 的時間
+}
+
+// LeaderFunc 在取得 leadership 時呼叫；ctx 在失去 leadership 或關機時取消
+type LeaderFunc func(ctx context.Context)
+
+var (
+	leaderMu     sync.RWMutex
+	leaderState  = LeaderStatus{Backend: LeaderBackendOff}
+	leaderCancel context.CancelFunc
+	startedFns   []LeaderFunc
+	stoppedFns   []func()
+)
+
+// LeaderConfigFromEnv 讀取 LEADER_ELECTION、LEADER_ELECTION_LEASE、LEADER_ELECTION_NAMESPACE、
+// LEADER_LEASE_DURATION、LEADER_RENEW_DEADLINE、LEADER_RETRY_PERIOD 與 LEADER_LOCK_FILE
+func LeaderConfigFromEnv() LeaderConfig {
+	cfg := LeaderConfig{
+		Backend:       strings.ToLower(os.Getenv("LEADER_ELECTION")),
+		LeaseName:     os.Getenv("LEADER_ELECTION_LEASE"),
+		Namespace:     os.Getenv("LEADER_ELECTION_NAMESPACE"),
+		LeaseDuration: envDuration("LEADER_LEASE_DURATION", 15*time.Second),
+		RenewDeadline: envDuration("LEADER_RENEW_DEADLINE", 10*time.Second),
+		RetryPeriod:   envDuration("LEADER_RETRY_PERIOD", 2*time.Second),
+		LockFile:      os.Getenv("LEADER_LOCK_FILE"),
+	}
+	if cfg.Backend == "" {
+		cfg.Backend = LeaderBackendAuto
+	}
+	if cfg.LeaseName == "" {
+		cfg.LeaseName = "web-server-in-go"
+	}
+	if cfg.LockFile == "" {
+		cfg.LockFile = filepath.Join(os.TempDir(), cfg.LeaseName) + ".leader.lock"
+	}
+	return cfg
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+// OnStartedLeading 註冊取得 leadership 時要執行的工作，需在 StartLeaderElection 前呼叫；
+// 每次取得 leadership 都會在新的 goroutine 中以新的 ctx 呼叫
+func OnStartedLeading(fn LeaderFunc) {
+	leaderMu.Lock()
+	defer leaderMu.Unlock()
+	startedFns = append(startedFns, fn)
+}
+
+// OnStoppedLeading 註冊失去 leadership 時的 callback，此時 LeaderFunc 的 ctx 已取消
+func OnStoppedLeading(fn func()) {
+	leaderMu.Lock()
+	defer leaderMu.Unlock()
+	stoppedFns = append(stoppedFns, fn)
+}
+
+// IsLeader 回報本 process 目前是否為 leader
+func IsLeader() bool {
+	leaderMu.RLock()
+	defer leaderMu.RUnlock()
+	return leaderState.IsLeader
+}
+
+// Leader 回傳目前 leader election 的狀態
+func Leader() LeaderStatus {
+	leaderMu.RLock()
+	s := leaderState
+	leaderMu.RUnlock()
+
+	if s.Backend == LeaderBackendFile && !s.IsLeader {
+		s.Holder = readTrim(s.Lock)
+	}
+	return s
+}
+
+// StartLeaderElection 在背景參與選舉，ctx 結束時釋放 lock；
+// auto 模式下需先呼叫 Start，才能判斷是否有 API server 可用
+func StartLeaderElection(ctx context.Context, cfg LeaderConfig) error {
+	if cfg.Identity == "" {
+		cfg.Identity = leaderIdentity()
+	}
+	backend := cfg.Backend
+	if backend == LeaderBackendAuto {
+		backend = LeaderBackendFile
+		if clientSet != nil {
+			backend = LeaderBackendLease
+		}
+	}
+
+	switch backend {
+	case LeaderBackendOff:
+		setLeaderState(LeaderBackendOff, "", cfg.Identity)
+		becomeLeader(ctx)
+		return nil
+	case LeaderBackendLease:
+		return startLeaseElection(ctx, cfg)
+	case LeaderBackendFile:
+		return startFileElection(ctx, cfg)
+	}
+	return fmt.Errorf("unknown leader election backend %q", cfg.Backend)
+}
+
+// leaderIdentity 在叢集內使用 pod 名稱；叢集外同一台機器可能有多個 process，加上 pid 區分
+func leaderIdentity() string {
+	if p, ok := Pod(); ok && p.Name != "" {
+		return p.Name
+	}
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s_%d", host, os.Getpid())
+}
+
+func setLeaderState(backend, lock, identity string) {
+	leaderMu.Lock()
+	defer leaderMu.Unlock()
+	leaderState = LeaderStatus{Backend: backend, Lock: lock, Identity: identity}
+}
+
+// becomeLeader 建立 leader ctx 並啟動所有 LeaderFunc
+func becomeLeader(parent context.Context) {
+	ctx, cancel := context.WithCancel(parent)
+	now := time.Now()
+
+	leaderMu.Lock()
+	leaderCancel = cancel
+	leaderState.IsLeader = true
+	leaderState.Holder = leaderState.Identity
+	leaderState.Since = &now
+	fns := startedFns
+	id := leaderState.Identity
+	leaderMu.Unlock()
+
+	logger.Info(fmt.Sprintf("[LEADER] %s became leader", id))
+	for _, fn := range fns {
+		go fn(ctx)
+	}
+}
+
+// loseLeader 取消 leader ctx 並通知；本來就不是 leader 時不做事
+func loseLeader() {
+	leaderMu.Lock()
+	if !leaderState.IsLeader {
+		leaderMu.Unlock()
+		return
+	}
+	leaderCancel()
+	leaderCancel = nil
+	leaderState.IsLeader = false
+	leaderState.Since = nil
+	if leaderState.Holder == leaderState.Identity {
+		leaderState.Holder = ""
+	}
+	fns := stoppedFns
+	id := leaderState.Identity
+	leaderMu.Unlock()
+
+	logger.Warn(fmt.Sprintf("[LEADER] %s lost leadership", id))
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+func startLeaseElection(ctx context.Context, cfg LeaderConfig) error {
+	if clientSet == nil {
+		return ErrNoClient
+	}
+	ns := cfg.Namespace
+	if ns == "" {
+		_, ns, _ = podIdentity()
+	}
+	if ns == "" {
+		ns = metav1.NamespaceDefault
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Name: cfg.LeaseName, Namespace: ns},
+		Client:     clientSet.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: cfg.Identity},
+	}
+	lec := leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   cfg.LeaseDuration,
+		RenewDeadline:   cfg.RenewDeadline,
+		RetryPeriod:     cfg.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            cfg.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: becomeLeader,
+			OnStoppedLeading: loseLeader,
+			OnNewLeader: func(id string) {
+				leaderMu.Lock()
+				leaderState.Holder = id
+				leaderMu.Unlock()
+				logger.Info(fmt.Sprintf("[LEADER] current leader is %s", id))
+			},
+		},
+	}
+	// 先驗證設定，避免在背景 goroutine 中 panic
+	if _, err := leaderelection.NewLeaderElector(lec); err != nil {
+		return err
+	}
+
+	setLeaderState(LeaderBackendLease, ns+"/"+cfg.LeaseName, cfg.Identity)
+	go func() {
+		// 失去 lease 後 Run 會返回，重新參選直到關機
+		for ctx.Err() == nil {
+			le, _ := leaderelection.NewLeaderElector(lec)
+			le.Run(ctx)
+		}
+	}()
+	logger.Info(fmt.Sprintf("[LEADER] lease election started lease=%s/%s identity=%s", ns, cfg.LeaseName, cfg.Identity))
+	return nil
+}
+
+// startFileElection 以 flock 搶鎖檔；取得後把 identity 寫進檔案，讓其他 process 知道誰是 leader。
+// process 結束時 kernel 會自動釋放 flock，所以不需要 lease 過期機制
+func startFileElection(ctx context.Context, cfg LeaderConfig) error {
+	f, err := os.OpenFile(cfg.LockFile, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("open leader lock: %w", err)
+	}
+	setLeaderState(LeaderBackendFile, cfg.LockFile, cfg.Identity)
+
+	go func() {
+		defer f.Close()
+		ticker := time.NewTicker(cfg.RetryPeriod)
+		defer ticker.Stop()
+		for {
+			if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err == nil {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+
+		if err := f.Truncate(0); err == nil {
+			_, _ = f.WriteAt([]byte(cfg.Identity+"\n"), 0)
+		}
+		becomeLeader(ctx)
+		<-ctx.Done()
+		loseLeader()
+		_ = f.Truncate(0)
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	}()
+	logger.Info(fmt.Sprintf("[LEADER] file lock election started lock=%s identity=%s", cfg.LockFile, cfg.Identity))
+	return nil
+}
@@ -0,0 +1,160 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// metrics-server 約每 15 秒收集一次，更頻繁地查詢沒有意義
+const usageTTL = 15 * time.Second
+
+var ErrNoMetrics = errors.New("metrics.k8s.io API not available")
+
+// healthConditions 是 /healthz 關心的 node condition；其餘（例如 cloud provider 自訂的）忽略
+var healthConditions = []v1.NodeConditionType{
+	v1.NodeReady,
+	v1.NodeMemoryPressure,
+	v1.NodeDiskPressure,
+	v1.NodePIDPressure,
+	v1.NodeNetworkUnavailable,
+}
+
+// NodeCondition 不含 lastHeartbeatTime，避免每次 heartbeat 都被當成 node 改變
+type NodeCondition struct {
+	Type           string    `json:"type"`
+	Status         string    `json:"status"` // True | False | Unknown
+	Reason         string    `json:"reason,omitempty"`
+	Message        string    `json:"message,omitempty"`
+	LastTransition time.Time `json:"last_transition"`
+}
+
+type Taint struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Effect string `json:"effect"`
+}
+
+// NodeUsage 是 metrics.k8s.io 回報的即時用量，百分比以 allocatable 為分母
+type NodeUsage struct {
+	CPU           string    `json:"cpu"`
+	Memory        string    `json:"memory"`
+	CPUPercent    float64   `json:"cpu_percent,omitempty"`
+	MemoryPercent float64   `json:"memory_percent,omitempty"`
+	Window        string    `json:"window"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+var (
+	metricsClient *metricsclient.Clientset
+
+	usageMu  sync.Mutex
+	usage    *NodeUsage
+	usageErr error
+	usageAt  time.Time
+)
+
+func toConditions(in []v1.NodeCondition) []NodeCondition {
+	var out []NodeCondition
+	for _, t := range healthConditions {
+		for _, c := range in {
+			if c.Type != t {
+				continue
+			}
+			out = append(out, NodeCondition{
+				Type:           string(c.Type),
+				Status:         string(c.Status),
+				Reason:         c.Reason,
+				Message:        c.Message,
+				LastTransition: c.LastTransitionTime.Time,
+			})
+		}
+	}
+	return out
+}
+
+func toTaints(in []v1.Taint) []Taint {
+	var out []Taint
+	for _, t := range in {
+		out = append(out, Taint{Key: t.Key, Value: t.Value, Effect: string(t.Effect)})
+	}
+	return out
+}
+
+// Degraded 回傳 node 不健康的原因：Ready 不是 True，或任何 pressure / NetworkUnavailable 為 True。
+// cordon 與 taint 只是排程上的限制，不算 degraded；沒有 condition 的來源（downward、host）永遠是健康的
+func (n Node) Degraded() []string {
+	var reasons []string
+	for _, c := range n.Conditions {
+		bad := c.Status == string(v1.ConditionTrue)
+		if c.Type == string(v1.NodeReady) {
+			bad = c.Status != string(v1.ConditionTrue)
+		}
+		if bad {
+			reasons = append(reasons, fmt.Sprintf("%s=%s", c.Type, c.Status))
+		}
+	}
+	return reasons
+}
+
+// Usage 回傳目前 node 的即時用量，結果（包含錯誤）快取 usageTTL；
+// 沒有 metrics-server 時回傳 ErrNoMetrics 或 API 的 NotFound
+func Usage(ctx context.Context) (*NodeUsage, error) {
+	if metricsClient == nil {
+		return nil, ErrNoMetrics
+	}
+	node, ok := Snapshot()
+	if !ok {
+		return nil, ErrNoMetrics
+	}
+
+	usageMu.Lock()
+	defer usageMu.Unlock()
+	if time.Since(usageAt) < usageTTL {
+		return usage, usageErr
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	m, err := metricsClient.MetricsV1beta1().NodeMetricses().Get(ctx, node.Name, metav1.GetOptions{})
+	usageAt = time.Now()
+	if err != nil {
+		usage, usageErr = nil, err
+		return nil, err
+	}
+
+	cpu, mem := m.Usage.Cpu(), m.Usage.Memory()
+	u := &NodeUsage{
+		CPU:           cpu.String(),
+		Memory:        mem.String(),
+		CPUPercent:    percent(cpu.MilliValue(), node.CPU, true),
+		MemoryPercent: percent(mem.Value(), node.Memory, false),
+		Window:        m.Window.Duration.String(),
+		Timestamp:     m.Timestamp.Time,
+	}
+	usage, usageErr = u, nil
+	return u, nil
+}
+
+// percent 以 allocatable（quantity 字串）為分母，無法解析時回傳 0
+func percent(used int64, allocatable string, milli bool) float64 {
+	q, err := resource.ParseQuantity(allocatable)
+	if err != nil {
+		return 0
+	}
+	total := q.Value()
+	if milli {
+		total = q.MilliValue()
+	}
+	if total <= 0 {
+		return 0
+	}
+	return float64(used*10000/total) / 100
+}
@@ -0,0 +1,147 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var ErrNoPeerService = errors.New("PEER_SERVICE is not set")
+
+// Peer 是同一個 Service 後面的一個 endpoint
+type Peer struct {
+	Pod   string `json:"pod,omitempty"`
+	IP    string `json:"ip"`
+	Port  int32  `json:"port"`
+	Node  string `json:"node,omitempty"`
+	Ready bool   `json:"ready"`
+	Self  bool   `json:"self"`
+}
+
+// PeerList 是 Peers 的結果；SliceErr 不為 nil 表示 EndpointSlice 查詢失敗，Peers 改由 Endpoints 取得，可能不完整
+type PeerList struct {
+	Peers    []Peer
+	SliceErr error
+}
+
+// Peers 以 EndpointSlice 找出 PEER_SERVICE 的所有 endpoint（含未 ready），
+// EndpointSlice 查詢失敗（叢集不支援、RBAC 沒有權限）時改用 Endpoints，失敗原因放在 SliceErr
+func Peers(ctx context.Context) (PeerList, error) {
+	if clientSet == nil {
+		return PeerList{}, ErrNoClient
+	}
+	svc := os.Getenv("PEER_SERVICE")
+	if svc == "" {
+		return PeerList{}, ErrNoPeerService
+	}
+	self, ns, ok := podIdentity()
+	if !ok {
+		return PeerList{}, ErrNoPodIdentity
+	}
+
+	list, err := clientSet.DiscoveryV1().EndpointSlices(ns).List(ctx, metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + svc,
+	})
+	if err != nil {
+		if apierrors.IsForbidden(err) {
+			logger.WarnCtx(ctx, fmt.Sprintf("[K8S] not allowed to list endpointslices in %s, falling back to endpoints: %v", ns, err))
+		} else {
+			logger.ErrorCtx(ctx, fmt.Sprintf("[K8S] list endpointslices service=%s/%s failed, falling back to endpoints: %v", ns, svc, err))
+		}
+		peers, lerr := legacyPeers(ctx, ns, svc, self)
+		if lerr != nil {
+			return PeerList{SliceErr: err}, errors.Join(err, lerr)
+		}
+		return PeerList{Peers: peers, SliceErr: err}, nil
+	}
+
+	seen := map[string]bool{}
+	var out []Peer
+	for _, s := range list.Items {
+		if s.AddressType == discoveryv1.AddressTypeFQDN {
+			continue
+		}
+		var port int32
+		for _, p := range s.Ports {
+			if p.Port != nil && (port == 0 || p.Name != nil && *p.Name == "http") {
+				port = *p.Port
+			}
+		}
+		port = peerPort(port)
+
+		for _, ep := range s.Endpoints {
+			// 同一個 pod 可能同時出現在 IPv4 / IPv6 的 slice
+			if len(ep.Addresses) == 0 || seen[ep.Addresses[0]] {
+				continue
+			}
+			seen[ep.Addresses[0]] = true
+
+			p := Peer{IP: ep.Addresses[0], Port: port, Ready: ep.Conditions.Ready == nil || *ep.Conditions.Ready}
+			if ep.NodeName != nil {
+				p.Node = *ep.NodeName
+			}
+			if ep.TargetRef != nil {
+				p.Pod = ep.TargetRef.Name
+			}
+			p.Self = p.Pod != "" && p.Pod == self
+			out = append(out, p)
+		}
+	}
+	return PeerList{Peers: out}, nil
+}
+
+func legacyPeers(ctx context.Context, ns, svc, self string) ([]Peer, error) {
+	//lint:ignore SA1019 只在 EndpointSlice 不可用時使用
+	eps, err := clientSet.CoreV1().Endpoints(ns).Get(ctx, svc, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Peer
+	for _, sub := range eps.Subsets {
+		var port int32
+		for _, p := range sub.Ports {
+			if port == 0 || p.Name == "http" {
+				port = p.Port
+			}
+		}
+		port = peerPort(port)
+
+		add := func(a v1.EndpointAddress, ready bool) {
+			p := Peer{IP: a.IP, Port: port, Ready: ready}
+			if a.NodeName != nil {
+				p.Node = *a.NodeName
+			}
+			if a.TargetRef != nil {
+				p.Pod = a.TargetRef.Name
+			}
+			p.Self = p.Pod != "" && p.Pod == self
+			out = append(out, p)
+		}
+		for _, a := range sub.Addresses {
+			add(a, true)
+		}
+		for _, a := range sub.NotReadyAddresses {
+			add(a, false)
+		}
+	}
+	return out, nil
+}
+
+// peerPort 依序使用 PEER_PORT、Service 的 port、PORT
+func peerPort(fromService int32) int32 {
+	for _, v := range []string{os.Getenv("PEER_PORT"), strconv.Itoa(int(fromService)), os.Getenv("PORT")} {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return int32(n)
+		}
+	}
+	return 8080
+}
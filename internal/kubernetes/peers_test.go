@@ -0,0 +1,97 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// fakeAPIServer 拒絕 EndpointSlice 的 list（沒有 RBAC），Endpoints 回傳兩個 pod
+func fakeAPIServer(t *testing.T, endpointsStatus int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.Contains(r.URL.Path, "/endpointslices"):
+			st := apierrors.NewForbidden(schema.GroupResource{Group: "discovery.k8s.io", Resource: "endpointslices"}, "", nil).Status()
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(st)
+		case strings.Contains(r.URL.Path, "/endpoints/web") && endpointsStatus == http.StatusOK:
+			json.NewEncoder(w).Encode(v1.Endpoints{
+				TypeMeta: metav1.TypeMeta{Kind: "Endpoints", APIVersion: "v1"},
+				Subsets: []v1.EndpointSubset{{
+					Addresses: []v1.EndpointAddress{
+						{IP: "10.0.0.1", TargetRef: &v1.ObjectReference{Name: "web-0"}},
+						{IP: "10.0.0.2", TargetRef: &v1.ObjectReference{Name: "web-1"}},
+					},
+					Ports: []v1.EndpointPort{{Name: "http", Port: 8080}},
+				}},
+			})
+		default:
+			st := apierrors.NewNotFound(schema.GroupResource{Resource: "endpoints"}, "web").Status()
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(st)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func withFakeCluster(t *testing.T, srv *httptest.Server) {
+	t.Helper()
+	cs, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeMu.Lock()
+	oldCS, oldPod := clientSet, pod
+	clientSet, pod = cs, &PodInfo{Name: "web-0", Namespace: "default"}
+	nodeMu.Unlock()
+	t.Cleanup(func() {
+		nodeMu.Lock()
+		clientSet, pod = oldCS, oldPod
+		nodeMu.Unlock()
+	})
+	t.Setenv("PEER_SERVICE", "web")
+}
+
+func TestPeersReportsEndpointSliceError(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoints int
+		wantPeers int
+		wantErr   bool
+	}{
+		{"falls back to endpoints", http.StatusOK, 2, false},
+		{"both fail", http.StatusNotFound, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withFakeCluster(t, fakeAPIServer(t, tt.endpoints))
+
+			list, err := Peers(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %t", err, tt.wantErr)
+			}
+			if !apierrors.IsForbidden(list.SliceErr) {
+				t.Fatalf("SliceErr = %v, want Forbidden", list.SliceErr)
+			}
+			if len(list.Peers) != tt.wantPeers {
+				t.Fatalf("got %d peers, want %d", len(list.Peers), tt.wantPeers)
+			}
+			if tt.wantPeers > 0 && !list.Peers[0].Self {
+				t.Fatalf("peer %+v should be self", list.Peers[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const serviceAccountNamespace = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+var (
+	ErrNoClient      = errors.New("kubernetes API not available")
+	ErrNoPodIdentity = errors.New("pod name / namespace unknown (set POD_NAME and POD_NAMESPACE via the Downward API)")
+)
+
+// Owner 是 ownerReferences 中的 controller，由近到遠（ReplicaSet → Deployment）
+type Owner struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+type ContainerStatus struct {
+	Name         string     `json:"name"`
+	Image        string     `json:"image"`
+	ImageID      string     `json:"image_id,omitempty"`
+	Digest       string     `json:"digest,omitempty"`
+	Ready        bool       `json:"ready"`
+	Started      bool       `json:"started"`
+	RestartCount int32      `json:"restart_count"`
+	State        string     `json:"state"` // running | waiting | terminated
+	Reason       string     `json:"reason,omitempty"`
+	Since        *time.Time `json:"since,omitempty"`
+	LastReason   string     `json:"last_termination_reason,omitempty"`
+	Init         bool       `json:"init,omitempty"`
+}
+
+// PodDetails 是 GET /pod 的內容；Source 為 downward 時只有 Downward API 提供的欄位
+type PodDetails struct {
+	Name         string            `json:"name"`
+	Namespace    string            `json:"namespace"`
+	Node         string            `json:"node,omitempty"`
+	IP           string            `json:"ip,omitempty"`
+	Phase        string            `json:"phase,omitempty"`
+	QOSClass     string            `json:"qos_class,omitempty"`
+	StartTime    *time.Time        `json:"start_time,omitempty"`
+	Owners       []Owner           `json:"owners,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	RestartCount int32             `json:"restart_count"`
+	Containers   []ContainerStatus `json:"containers,omitempty"`
+	Source       string            `json:"source"`
+}
+
+// podIdentity 依序使用 Downward API、ServiceAccount namespace 檔與 hostname（預設等於 pod 名稱）
+func podIdentity() (string, string, bool) {
+	p, _ := Pod()
+	name, ns := p.Name, p.Namespace
+	if ns == "" {
+		ns = readTrim(serviceAccountNamespace)
+	}
+	if name == "" && ns != "" {
+		name, _ = os.Hostname()
+	}
+	return name, ns, name != "" && ns != ""
+}
+
+// Workload 是 telemetry resource 使用的身分資訊
+type Workload struct {
+	Namespace string
+	Pod       string
+	PodUID    string
+	Node      string
+	Container string // CONTAINER_NAME，Downward API 沒有提供，需在 manifest 中設定
+}
+
+// WorkloadFromEnv 只讀 Downward API 與 ServiceAccount 檔案、不呼叫 API，可在 Start 之前使用；
+// 叢集外時各欄位為空
+func WorkloadFromEnv(cfg Config) Workload {
+	w := Workload{Node: os.Getenv("NODE_NAME"), Container: os.Getenv("CONTAINER_NAME")}
+	if p, ok := downwardPod(cfg.PodInfoDir); ok {
+		w.Pod, w.Namespace, w.PodUID = p.Name, p.Namespace, p.UID
+	}
+	if w.Namespace == "" {
+		w.Namespace = readTrim(serviceAccountNamespace)
+	}
+	if w.Pod == "" && w.Namespace != "" {
+		w.Pod, _ = os.Hostname()
+	}
+	return w
+}
+
+// PodCacheKey 回傳目前 pod 在快取中的 key
+func PodCacheKey() string {
+	name, ns, _ := podIdentity()
+	return "k8s:pod:" + ns + "/" + name
+}
+
+// GetPod 透過 API 取得目前 pod 的狀態；沒有 API 可用時退回 Downward API 的資訊
+func GetPod(ctx context.Context) (*PodDetails, error) {
+	name, ns, ok := podIdentity()
+	if clientSet == nil {
+		if p, found := Pod(); found {
+			return &PodDetails{Name: p.Name, Namespace: p.Namespace, IP: p.IP, Labels: p.Labels, Source: SourceDownward}, nil
+		}
+		return nil, ErrNoClient
+	}
+	if !ok {
+		return nil, ErrNoPodIdentity
+	}
+
+	pod, err := clientSet.CoreV1().Pods(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	d := &PodDetails{
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+		Node:      pod.Spec.NodeName,
+		IP:        pod.Status.PodIP,
+		Phase:     string(pod.Status.Phase),
+		QOSClass:  string(pod.Status.QOSClass),
+		Labels:    pod.Labels,
+		Owners:    owners(ctx, pod),
+		Source:    "api",
+	}
+	if pod.Status.StartTime != nil {
+		t := pod.Status.StartTime.Time
+		d.StartTime = &t
+	}
+	for _, cs := range pod.Status.InitContainerStatuses {
+		c := containerStatus(cs)
+		c.Init = true
+		d.Containers = append(d.Containers, c)
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		d.Containers = append(d.Containers, containerStatus(cs))
+		d.RestartCount += cs.RestartCount
+	}
+	return d, nil
+}
+
+// owners 沿著 controller ownerReference 往上找；ReplicaSet 讀不到（例如沒有 RBAC）時停在 ReplicaSet
+func owners(ctx context.Context, pod *v1.Pod) []Owner {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return nil
+	}
+	out := []Owner{{Kind: ref.Kind, Name: ref.Name}}
+	if ref.Kind != "ReplicaSet" {
+		return out
+	}
+	rs, err := clientSet.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return out
+	}
+	if up := metav1.GetControllerOf(rs); up != nil {
+		out = append(out, Owner{Kind: up.Kind, Name: up.Name})
+	}
+	return out
+}
+
+func containerStatus(cs v1.ContainerStatus) ContainerStatus {
+	c := ContainerStatus{
+		Name:         cs.Name,
+		Image:        cs.Image,
+		ImageID:      cs.ImageID,
+		Ready:        cs.Ready,
+		RestartCount: cs.RestartCount,
+	}
+	// imageID 例如 docker.io/library/nginx@sha256:…
+	if _, digest, ok := strings.Cut(cs.ImageID, "@"); ok {
+		c.Digest = digest
+	}
+	if cs.Started != nil {
+		c.Started = *cs.Started
+	}
+
+	switch s := cs.State; {
+	case s.Running != nil:
+		c.State = "running"
+		t := s.Running.StartedAt.Time
+		c.Since = &t
+	case s.Waiting != nil:
+		c.State, c.Reason = "waiting", s.Waiting.Reason
+	case s.Terminated != nil:
+		c.State, c.Reason = "terminated", s.Terminated.Reason
+		t := s.Terminated.FinishedAt.Time
+		c.Since = &t
+	}
+	if t := cs.LastTerminationState.Terminated; t != nil {
+		c.LastReason = t.Reason
+	}
+	return c
+}
@@ -0,0 +1,88 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// fakePodServer 拒絕 node 的 Get（沒有 node RBAC），只回傳 default/web-0 這個 pod
+func fakePodServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/v1/namespaces/default/pods/web-0" {
+			json.NewEncoder(w).Encode(v1.Pod{
+				TypeMeta:   metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"},
+				ObjectMeta: metav1.ObjectMeta{Name: "web-0", Namespace: "default"},
+				Spec:       v1.PodSpec{NodeName: "node-a"},
+				Status:     v1.PodStatus{PodIP: "10.0.0.1", Phase: v1.PodRunning},
+			})
+			return
+		}
+		st := apierrors.NewForbidden(schema.GroupResource{Resource: "nodes"}, "node-a", nil).Status()
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(st)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func writeKubeconfig(t *testing.T, server string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	kc := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: fake
+  cluster:
+    server: %s
+contexts:
+- name: fake
+  context:
+    cluster: fake
+current-context: fake
+`, server)
+	if err := os.WriteFile(path, []byte(kc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGetPodWithoutNodeInformer(t *testing.T) {
+	srv := fakePodServer(t)
+	t.Setenv("NODE_NAME", "node-a")
+
+	nodeMu.Lock()
+	oldCS, oldMC, oldPod := clientSet, metricsClient, pod
+	clientSet, metricsClient, pod = nil, nil, &PodInfo{Name: "web-0", Namespace: "default"}
+	nodeMu.Unlock()
+	t.Cleanup(func() {
+		nodeMu.Lock()
+		clientSet, metricsClient, pod = oldCS, oldMC, oldPod
+		nodeMu.Unlock()
+	})
+
+	cfg := Config{Sources: []string{SourceKubeconfig}, Kubeconfig: writeKubeconfig(t, srv.URL), PodInfoDir: t.TempDir()}
+	if err := Start(context.Background(), cfg); err == nil {
+		t.Fatal("expected the node informer to fail")
+	}
+
+	d, err := GetPod(context.Background())
+	if err != nil {
+		t.Fatalf("GetPod: %v", err)
+	}
+	if d.Source != "api" || d.Node != "node-a" || d.IP != "10.0.0.1" || d.Phase != "Running" {
+		t.Fatalf("unexpected pod details: %+v", d)
+	}
+}
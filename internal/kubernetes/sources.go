@@ -0,0 +1,266 @@
+package kubernetes
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// node 資訊來源，依 Config.Sources 的順序嘗試
+const (
+	SourceInCluster  = "incluster"  // ServiceAccount + informer
+	SourceKubeconfig = "kubeconfig" // KUBECONFIG / --kubeconfig / ~/.kube/config + informer
+	SourceDownward   = "downward"   // Downward API 環境變數與檔案
+	SourceHost       = "host"       // /proc、uname、/etc/os-release
+)
+
+// DefaultSources 先找 API server，找不到才退回本機資訊
+var DefaultSources = []string{SourceInCluster, SourceKubeconfig, SourceDownward, SourceHost}
+
+// Config 決定 node 資訊的來源
+type Config struct {
+	Sources    []string
+	Kubeconfig string // 空字串時使用 KUBECONFIG 或 ~/.kube/config
+	PodInfoDir string // Downward API volume 掛載目錄
+}
+
+// ConfigFromEnv 讀取 NODE_INFO_SOURCES（逗號分隔）與 PODINFO_DIR
+func ConfigFromEnv() Config {
+	cfg := Config{Sources: DefaultSources, PodInfoDir: "/etc/podinfo"}
+	if v := os.Getenv("NODE_INFO_SOURCES"); v != "" {
+		cfg.Sources = nil
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				cfg.Sources = append(cfg.Sources, strings.ToLower(s))
+			}
+		}
+	}
+	if v := os.Getenv("PODINFO_DIR"); v != "" {
+		cfg.PodInfoDir = v
+	}
+	return cfg
+}
+
+// PodInfo 是 Downward API 提供的 pod 資訊
+type PodInfo struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	UID       string            `json:"uid,omitempty"`
+	IP        string            `json:"ip"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+func restConfig(source string, cfg Config) (*rest.Config, error) {
+	switch source {
+	case SourceInCluster:
+		return rest.InClusterConfig()
+	case SourceKubeconfig:
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		rules.ExplicitPath = cfg.Kubeconfig
+		return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	}
+	return nil, fmt.Errorf("unknown source %q", source)
+}
+
+// newClients 建立 core 與 metrics.k8s.io 的 client，兩者共用同一份連線設定
+func newClients(source string, cfg Config) (*kubernetes.Clientset, *metricsclient.Clientset, error) {
+	config, err := restConfig(source, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	cs, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	mc, err := metricsclient.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cs, mc, nil
+}
+
+// staticNode 從不需要 API server 的來源取得 node 資訊
+func staticNode(source string, cfg Config) (*Node, error) {
+	switch source {
+	case SourceDownward:
+		return downwardNode()
+	case SourceHost:
+		return hostNode()
+	}
+	return nil, fmt.Errorf("unknown source %q", source)
+}
+
+// downwardNode 使用 spec.nodeName 與 status.hostIP（NODE_NAME、HOST_IP）
+func downwardNode() (*Node, error) {
+	name := os.Getenv("NODE_NAME")
+	if name == "" {
+		return nil, ErrNoNodeName
+	}
+	return &Node{Name: name, InternalIP: os.Getenv("HOST_IP"), Source: SourceDownward}, nil
+}
+
+// downwardPod 讀取 POD_NAME、POD_NAMESPACE、POD_UID、POD_IP 與 volume 中的 labels 檔
+func downwardPod(dir string) (*PodInfo, bool) {
+	p := &PodInfo{
+		Name:      os.Getenv("POD_NAME"),
+		Namespace: os.Getenv("POD_NAMESPACE"),
+		UID:       os.Getenv("POD_UID"),
+		IP:        os.Getenv("POD_IP"),
+	}
+	if p.Name == "" {
+		p.Name = readTrim(filepath.Join(dir, "name"))
+	}
+	if p.Namespace == "" {
+		p.Namespace = readTrim(filepath.Join(dir, "namespace"))
+	}
+	if p.UID == "" {
+		p.UID = readTrim(filepath.Join(dir, "uid"))
+	}
+	if labels, err := readLabels(filepath.Join(dir, "labels")); err == nil {
+		p.Labels = labels
+	}
+	if p.Name == "" && p.IP == "" && p.Labels == nil {
+		return nil, false
+	}
+	return p, true
+}
+
+// readLabels 解析 Downward API 的 labels 檔：每行 key="value"
+func readLabels(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	labels := map[string]string{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		k, v, ok := strings.Cut(sc.Text(), "=")
+		if !ok {
+			continue
+		}
+		if uq, err := strconv.Unquote(v); err == nil {
+			v = uq
+		}
+		labels[k] = v
+	}
+	return labels, sc.Err()
+}
+
+// hostNode 以本機資訊代替 node；CPU / Memory 格式與 Kubernetes quantity 相同
+func hostNode() (*Node, error) {
+	name, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	n := &Node{
+		Name:       name,
+		InternalIP: hostIP(),
+		CPU:        strconv.Itoa(runtime.NumCPU()),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		Kernel:     readTrim("/proc/sys/kernel/osrelease"),
+		OSImage:    osImage("/etc/os-release"),
+		Source:     SourceHost,
+	}
+	if kb, err := memTotalKiB("/proc/meminfo"); err == nil {
+		n.Memory = fmt.Sprintf("%dKi", kb)
+	}
+	return n, nil
+}
+
+// hostIP 回傳第一個非 loopback 的 IPv4 位址
+func hostIP() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+	for _, a := range addrs {
+		if ipn, ok := a.(*net.IPNet); ok && !ipn.IP.IsLoopback() && ipn.IP.To4() != nil {
+			return ipn.IP.String()
+		}
+	}
+	return ""
+}
+
+func memTotalKiB(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// MemTotal:       16314328 kB
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			return strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	return 0, errors.New("MemTotal not found")
+}
+
+// osImage 取 /etc/os-release 的 PRETTY_NAME，與 kubelet 回報的 osImage 相同
+func osImage(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "PRETTY_NAME="); ok {
+			if uq, err := strconv.Unquote(v); err == nil {
+				return uq
+			}
+			return v
+		}
+	}
+	return ""
+}
+
+func readTrim(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// fill 以 o 補上 n 缺少的欄位，n 已有的值優先
+func (n *Node) fill(o *Node) {
+	if o == nil {
+		return
+	}
+	for _, f := range []struct{ dst, src *string }{
+		{&n.Name, &o.Name},
+		{&n.InternalIP, &o.InternalIP},
+		{&n.CPU, &o.CPU},
+		{&n.Memory, &o.Memory},
+		{&n.OS, &o.OS},
+		{&n.Arch, &o.Arch},
+		{&n.Kernel, &o.Kernel},
+		{&n.OSImage, &o.OSImage},
+	} {
+		if *f.dst == "" {
+			*f.dst = *f.src
+		}
+	}
+	if n.Labels == nil && o.Labels != nil {
+		n.Labels = o.Labels
+	}
+}
@@ -1,23 +1,43 @@
 package logger
 
 import (
+	"context"
 	"encoding/json"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 var Logger *log.Logger
 
+// 各 level 的順序，低於 minLevel 的 log 不寫出；零值為 info
+var (
+	levels   = map[string]int32{"debug": -1, "info": 0, "warm": 1, "warn": 1, "error": 2}
+	minLevel atomic.Int32
+)
+
+// SetLevel 設定最低輸出的 level（debug | info | warn | error），未知的 level 忽略
+func SetLevel(level string) {
+	if l, ok := levels[level]; ok {
+		minLevel.Store(l)
+	}
+}
+
 type LogEntry struct {
 	Timestamp string `json:"@timestamp"`
 	Level     string `json:"level"`
 	Message   string `json:"message"`
 	Host      string `json:"path,omitempty"`
+	TraceID   string `json:"trace_id,omitempty"` // 與 Tempo 的 trace 對應
+	SpanID    string `json:"span_id,omitempty"`
 }
 
-// Init 初始化 logger
+// Init 初始化 logger 的檔案輸出；未呼叫時只會送到 OTel LoggerProvider（若有設定）
 func Init(logPath string) error {
 	// 確保目錄存在
 	dir := filepath.Dir(logPath)
@@ -36,17 +56,37 @@ func Init(logPath string) error {
 	return nil
 }
 
+// SetOutput 以 w 取代檔案輸出，格式相同；用於沒有其他 log 輸出時改寫 stderr
+func SetOutput(w io.Writer) {
+	Logger = log.New(w, "", 0)
+}
+
 func input(msg string, level string) {
+	inputCtx(context.Background(), msg, level)
+}
+
+// inputCtx 在 ctx 帶有 span 時加上 trace_id / span_id
+func inputCtx(ctx context.Context, msg string, level string) {
+
+	if levels[level] < minLevel.Load() {
+		return
+	}
+	now := time.Now()
+	emit(ctx, now, msg, level)
 
 	if Logger != nil {
 
 		host, _ := os.Hostname()
 		entry := LogEntry{
-			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Timestamp: now.UTC().Format(time.RFC3339),
 			Level:     level,
 			Message:   msg,
 			Host:      host,
 		}
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			entry.TraceID = sc.TraceID().String()
+			entry.SpanID = sc.SpanID().String()
+		}
 		jsonData, err := json.Marshal(entry)
 		if err != nil {
 			Logger.Printf(`{"level":"error","message":"failed to marshal log: %s"}`, err)
@@ -57,6 +97,13 @@ func input(msg string, level string) {
 
 }
 
+// Debug 寫入 debug log，預設不輸出
+func Debug(msg string) {
+
+	input(msg, "debug")
+
+}
+
 // Info 寫入 info log
 func Info(msg string) {
 
@@ -76,3 +123,23 @@ func Warn(msg string) {
 	input(msg, "warm")
 
 }
+
+// DebugCtx 寫入 debug log，並帶上 ctx 中 span 的 trace_id / span_id
+func DebugCtx(ctx context.Context, msg string) {
+	inputCtx(ctx, msg, "debug")
+}
+
+// InfoCtx 寫入 info log，並帶上 ctx 中 span 的 trace_id / span_id
+func InfoCtx(ctx context.Context, msg string) {
+	inputCtx(ctx, msg, "info")
+}
+
+// WarnCtx 寫入 warn log，並帶上 ctx 中 span 的 trace_id / span_id
+func WarnCtx(ctx context.Context, msg string) {
+	inputCtx(ctx, msg, "warm")
+}
+
+// ErrorCtx 寫入 error log，並帶上 ctx 中 span 的 trace_id / span_id
+func ErrorCtx(ctx context.Context, msg string) {
+	inputCtx(ctx, msg, "error")
+}
@@ -0,0 +1,34 @@
+package logger
+
+import (
+	"context"
+	"time"
+
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/global"
+)
+
+// otelLogger 在 telemetry 設定 global LoggerProvider 之前是 noop，Enabled 回傳 false
+var otelLogger = global.Logger("web-server-in-go/logger")
+
+var severities = map[string]otellog.Severity{
+	"debug": otellog.SeverityDebug,
+	"info":  otellog.SeverityInfo,
+	"warm":  otellog.SeverityWarn,
+	"error": otellog.SeverityError,
+}
+
+// emit 把 log 送給 OTel LoggerProvider；trace context 由 SDK 從 ctx 取得，resource 由 provider 帶上
+func emit(ctx context.Context, ts time.Time, msg string, level string) {
+	sev := severities[level]
+	if !otelLogger.Enabled(ctx, otellog.EnabledParameters{Severity: sev}) {
+		return
+	}
+
+	var r otellog.Record
+	r.SetTimestamp(ts)
+	r.SetSeverity(sev)
+	r.SetSeverityText(sev.String())
+	r.SetBody(otellog.StringValue(msg))
+	otelLogger.Emit(ctx, r)
+}
@@ -0,0 +1,292 @@
+package mqttbridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/events"
+	"github.com/HarrisonZz/web_server_in_go/internal/i2cdevice"
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	payloadOnline  = "online"
+	payloadOffline = "offline"
+
+	commandTimeout = 5 * time.Second
+	commandQueue   = 16 // 等待執行的指令上限，超過時直接回覆 busy
+)
+
+var tracer = otel.Tracer("web-server-in-go/mqttbridge")
+
+// Device 是 bridge 需要的裝置操作，*i2cdevice.Bridge 即為實作
+type Device interface {
+	Events() *events.Hub
+	State() (i2cdevice.LedState, bool)
+	Command(ctx context.Context, payload []byte, source string) i2cdevice.CommandResult
+}
+
+// Config 描述 broker 連線與 topic 設定
+type Config struct {
+	Broker       string // 例如 tcp://mosquitto:1883；"embedded" 時在程序內啟動 broker
+	EmbeddedAddr string // 內建 broker 監聽位址，非 loopback 時必須設定 Username / Password
+	ClientID     string
+	Username     string
+	Password     string
+	TopicPrefix  string
+	QoS          byte
+}
+
+// ConfigFromEnv 讀取 MQTT_* 環境變數，MQTT_BROKER 為空表示不啟用
+func ConfigFromEnv() Config {
+	host, _ := os.Hostname()
+	node := os.Getenv("NODE_NAME")
+	if node == "" {
+		node = host
+	}
+
+	qos, err := strconv.Atoi(os.Getenv("MQTT_QOS"))
+	if err != nil || qos < 0 || qos > 2 {
+		qos = 1
+	}
+
+	return Config{
+		Broker:       os.Getenv("MQTT_BROKER"),
+		EmbeddedAddr: getenv("MQTT_EMBEDDED_ADDR", "127.0.0.1:1883"),
+		ClientID:     getenv("MQTT_CLIENT_ID", "web-server-in-go-"+host),
+		Username:     os.Getenv("MQTT_USERNAME"),
+		Password:     os.Getenv("MQTT_PASSWORD"),
+		TopicPrefix:  getenv("MQTT_TOPIC_PREFIX", "web-server-in-go/"+node),
+		QoS:          byte(qos),
+	}
+}
+
+// topics 依 prefix 產生
+//
+//	<prefix>/status             retained online / offline（offline 由 Last Will 發出）
+//	<prefix>/led/state          retained 目前的 LED 狀態
+//	<prefix>/led/availability   retained I2C 裝置是否可用
+//	<prefix>/led/set            訂閱，payload 與 POST /led 相同
+//	<prefix>/led/result         指令執行結果
+type topics struct {
+	status, state, availability, set, result string
+}
+
+func newTopics(prefix string) topics {
+	return topics{
+		status:       prefix + "/status",
+		state:        prefix + "/led/state",
+		availability: prefix + "/led/availability",
+		set:          prefix + "/led/set",
+		result:       prefix + "/led/result",
+	}
+}
+
+type statePayload struct {
+	State     i2cdevice.LedState `json:"state"`
+	Available bool               `json:"available"`
+	Source    string             `json:"source,omitempty"`
+	Time      time.Time          `json:"time"`
+}
+
+// Bridge 將裝置狀態同步到 MQTT，並把 command topic 的訊息轉給裝置
+type Bridge struct {
+	cfg      Config
+	dev      Device
+	topics   topics
+	client   mqtt.Client
+	commands chan command
+}
+
+// command 是從 set topic 收到、等待 worker 執行的指令
+type command struct {
+	topic   string
+	payload []byte
+}
+
+// Start 連線到 broker 並開始同步，ctx 結束時發布 offline 後斷線；
+// 連線失敗不會回傳錯誤，而是在背景以 backoff 重試
+func Start(ctx context.Context, cfg Config, dev Device) (*Bridge, error) {
+	if cfg.Broker == "embedded" {
+		addr, err := startEmbedded(ctx, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("start embedded broker: %w", err)
+		}
+		cfg.Broker = "tcp://" + addr
+	}
+
+	b := &Bridge{cfg: cfg, dev: dev, topics: newTopics(cfg.TopicPrefix), commands: make(chan command, commandQueue)}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetCleanSession(true).
+		SetKeepAlive(30*time.Second).
+		SetWill(b.topics.status, payloadOffline, cfg.QoS, true).
+		// 第一次連線與斷線重連都在背景重試，重連間隔由 paho 指數成長到上限
+		SetConnectRetry(true).
+		SetConnectRetryInterval(2*time.Second).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(time.Minute).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			logger.Warn(fmt.Sprintf("[MQTT] connection lost: %v", err))
+		}).
+		SetReconnectingHandler(func(_ mqtt.Client, _ *mqtt.ClientOptions) {
+			logger.Info(fmt.Sprintf("[MQTT] reconnecting to %s", cfg.Broker))
+		})
+
+	b.client = mqtt.NewClient(opts)
+	b.client.Connect()
+	logger.Info(fmt.Sprintf("[MQTT] bridge started broker=%s prefix=%s", cfg.Broker, cfg.TopicPrefix))
+
+	go b.forward(ctx)
+	go b.worker(ctx)
+	return b, nil
+}
+
+// onConnect 每次（重）連線後重新訂閱並發布目前狀態，clean session 不會保留訂閱
+func (b *Bridge) onConnect(c mqtt.Client) {
+	logger.Info(fmt.Sprintf("[MQTT] connected to %s", b.cfg.Broker))
+
+	c.Publish(b.topics.status, b.cfg.QoS, true, payloadOnline)
+	st, up := b.dev.State()
+	b.publishState(st, up, "")
+	b.publishAvailability(up)
+
+	token := c.Subscribe(b.topics.set, b.cfg.QoS, b.onCommand)
+	go func() {
+		if token.WaitTimeout(10*time.Second) && token.Error() != nil {
+			logger.Error(fmt.Sprintf("[MQTT] subscribe %s failed: %v", b.topics.set, token.Error()))
+		}
+	}()
+}
+
+// onCommand 在 paho 的訊息處理 goroutine 中執行，只把指令放進佇列；
+// I2C 寫入（含重試 backoff）在 worker 中進行，不會卡住 PUBACK 與其他訊息
+func (b *Bridge) onCommand(_ mqtt.Client, msg mqtt.Message) {
+	cmd := command{topic: msg.Topic(), payload: msg.Payload()}
+	select {
+	case b.commands <- cmd:
+	default:
+		logger.Warn(fmt.Sprintf("[MQTT] command queue full, dropping payload=%q", cmd.payload))
+		b.publishResult(i2cdevice.CommandResult{Error: "command queue full", Code: "busy"})
+	}
+}
+
+// worker 依收到的順序逐一執行指令，直到 ctx 結束
+func (b *Bridge) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case cmd := <-b.commands:
+			b.execute(ctx, cmd)
+		}
+	}
+}
+
+func (b *Bridge) execute(ctx context.Context, cmd command) {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+	ctx, span := tracer.Start(ctx, "mqtt.command")
+	defer span.End()
+	span.SetAttributes(attribute.String("mqtt.topic", cmd.topic))
+
+	res := b.dev.Command(ctx, cmd.payload, i2cdevice.SourceMQTT)
+	span.SetAttributes(attribute.Bool("led.ok", res.OK))
+	if res.OK {
+		logger.InfoCtx(ctx, fmt.Sprintf("[MQTT] command applied state=%s", res.State))
+	} else {
+		logger.WarnCtx(ctx, fmt.Sprintf("[MQTT] command rejected code=%s error=%s payload=%q", res.Code, res.Error, cmd.payload))
+	}
+	b.publishResult(res)
+}
+
+func (b *Bridge) publishResult(res i2cdevice.CommandResult) {
+	if payload, err := json.Marshal(res); err == nil {
+		b.client.Publish(b.topics.result, b.cfg.QoS, false, payload)
+	}
+}
+
+// forward 將裝置事件轉成 retained 訊息；被 hub 踢除時重新訂閱並補發目前狀態
+func (b *Bridge) forward(ctx context.Context) {
+	for {
+		sub, _ := b.dev.Events().Subscribe(0)
+		if !b.drain(ctx, sub) {
+			b.dev.Events().Unsubscribe(sub)
+			b.shutdown()
+			return
+		}
+		logger.Warn("[MQTT] event subscription dropped, resyncing state")
+		st, up := b.dev.State()
+		b.publishState(st, up, "")
+	}
+}
+
+// drain 回傳 false 表示 ctx 結束
+func (b *Bridge) drain(ctx context.Context, sub *events.Subscriber) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case ev, ok := <-sub.C:
+			if !ok {
+				return true
+			}
+			b.handleEvent(ev)
+		}
+	}
+}
+
+func (b *Bridge) handleEvent(ev events.Event) {
+	st, up := b.dev.State()
+	switch ev.Type {
+	case i2cdevice.EventState:
+		b.publishState(st, up, ev.Source)
+	case i2cdevice.EventAvailability:
+		b.publishAvailability(up)
+		b.publishState(st, up, ev.Source)
+	}
+}
+
+func (b *Bridge) publishState(st i2cdevice.LedState, up bool, source string) {
+	payload, err := json.Marshal(statePayload{State: st, Available: up, Source: source, Time: time.Now().UTC()})
+	if err != nil {
+		return
+	}
+	b.client.Publish(b.topics.state, b.cfg.QoS, true, payload)
+}
+
+func (b *Bridge) publishAvailability(up bool) {
+	payload := payloadOffline
+	if up {
+		payload = payloadOnline
+	}
+	b.client.Publish(b.topics.availability, b.cfg.QoS, true, payload)
+}
+
+// shutdown 正常關閉時主動發布 offline，Last Will 只在異常斷線時由 broker 發出
+func (b *Bridge) shutdown() {
+	if b.client.IsConnected() {
+		b.client.Publish(b.topics.status, b.cfg.QoS, true, payloadOffline).WaitTimeout(time.Second)
+	}
+	b.client.Disconnect(250)
+	logger.Info("[MQTT] bridge stopped")
+}
+
+func getenv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
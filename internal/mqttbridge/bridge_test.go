@@ -0,0 +1,162 @@
+package mqttbridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/events"
+	"github.com/HarrisonZz/web_server_in_go/internal/i2cdevice"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// fakeDevice 模擬需要一段時間的 I2C 寫入，成功後發出 state 事件
+type fakeDevice struct {
+	hub   *events.Hub
+	delay time.Duration
+
+	mu    sync.Mutex
+	state i2cdevice.LedState
+}
+
+func (d *fakeDevice) Events() *events.Hub { return d.hub }
+
+func (d *fakeDevice) State() (i2cdevice.LedState, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.state, true
+}
+
+func (d *fakeDevice) Command(_ context.Context, payload []byte, source string) i2cdevice.CommandResult {
+	var st i2cdevice.LedState
+	if err := json.Unmarshal(payload, &st); err != nil || st.Mode == "" {
+		return i2cdevice.CommandResult{Error: "invalid command", Code: "invalid_command"}
+	}
+	time.Sleep(d.delay)
+	d.mu.Lock()
+	d.state = st
+	d.mu.Unlock()
+	d.hub.Publish(i2cdevice.EventState, source, st)
+	return i2cdevice.CommandResult{OK: true, State: &st}
+}
+
+func connect(t *testing.T, broker, id string) mqtt.Client {
+	t.Helper()
+	c := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(broker).SetClientID(id))
+	if tok := c.Connect(); !tok.WaitTimeout(5*time.Second) || tok.Error() != nil {
+		t.Fatalf("connect %s: %v", broker, tok.Error())
+	}
+	t.Cleanup(func() { c.Disconnect(100) })
+	return c
+}
+
+func TestBridgeCommandUpdatesState(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dev := &fakeDevice{hub: events.NewHub(16, 8), delay: 200 * time.Millisecond, state: i2cdevice.LedState{Mode: "off"}}
+	b, err := Start(ctx, Config{
+		Broker:       "embedded",
+		EmbeddedAddr: "127.0.0.1:0",
+		ClientID:     "bridge-test",
+		TopicPrefix:  "test/dev",
+		QoS:          1,
+	}, dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := connect(t, b.cfg.Broker, "test-client")
+	states := make(chan statePayload, 16)
+	results := make(chan i2cdevice.CommandResult, 16)
+	subscribe := func(topic string, fn func([]byte)) {
+		tok := c.Subscribe(topic, 1, func(_ mqtt.Client, m mqtt.Message) { fn(m.Payload()) })
+		if !tok.WaitTimeout(5*time.Second) || tok.Error() != nil {
+			t.Fatalf("subscribe %s: %v", topic, tok.Error())
+		}
+	}
+	subscribe(b.topics.state, func(p []byte) {
+		var sp statePayload
+		if json.Unmarshal(p, &sp) == nil {
+			states <- sp
+		}
+	})
+	subscribe(b.topics.result, func(p []byte) {
+		var r i2cdevice.CommandResult
+		if json.Unmarshal(p, &r) == nil {
+			results <- r
+		}
+	})
+
+	// 等 bridge 連上並訂閱 set topic（連上後會發布目前狀態）
+	waitState(t, states, "off")
+
+	// 連續送出兩個指令：callback 只放進佇列，兩個都要依序執行
+	for _, p := range []string{`{"mode":"blink"}`, `{"mode":"on"}`} {
+		if tok := c.Publish(b.topics.set, 1, false, p); !tok.WaitTimeout(time.Second) || tok.Error() != nil {
+			t.Fatalf("publish: %v", tok.Error())
+		}
+	}
+	waitState(t, states, "on")
+
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-results:
+			if !r.OK {
+				t.Fatalf("result %d not ok: %+v", i, r)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for result %d", i)
+		}
+	}
+}
+
+func waitState(t *testing.T, states <-chan statePayload, mode string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case sp := <-states:
+			if sp.State.Mode == mode {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for state %q", mode)
+		}
+	}
+}
+
+func TestEmbeddedRequiresAuthOffLoopback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := startEmbedded(ctx, Config{EmbeddedAddr: "0.0.0.0:0", TopicPrefix: "test/dev"})
+	if !errors.Is(err, ErrEmbeddedAuthRequired) {
+		t.Fatalf("err = %v, want ErrEmbeddedAuthRequired", err)
+	}
+}
+
+func TestEmbeddedAuthACL(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	addr, err := startEmbedded(ctx, Config{EmbeddedAddr: "127.0.0.1:0", Username: "dev", Password: "secret", TopicPrefix: "test/dev"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anon := mqtt.NewClient(mqtt.NewClientOptions().AddBroker("tcp://" + addr).SetClientID("anon"))
+	if tok := anon.Connect(); tok.WaitTimeout(5*time.Second) && tok.Error() == nil {
+		anon.Disconnect(100)
+		t.Fatal("anonymous client connected to a secured broker")
+	}
+
+	c := mqtt.NewClient(mqtt.NewClientOptions().AddBroker("tcp://" + addr).SetClientID("dev").SetUsername("dev").SetPassword("secret"))
+	if tok := c.Connect(); !tok.WaitTimeout(5*time.Second) || tok.Error() != nil {
+		t.Fatalf("connect with credentials: %v", tok.Error())
+	}
+	c.Disconnect(100)
+}
@@ -0,0 +1,80 @@
+package mqttbridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+)
+
+// ErrEmbeddedAuthRequired 表示內建 broker 要對外監聽，但沒有設定帳號密碼
+var ErrEmbeddedAuthRequired = errors.New("embedded broker on a non-loopback address requires MQTT_USERNAME and MQTT_PASSWORD")
+
+// startEmbedded 在程序內啟動 MQTT broker，供本機開發與測試使用；回傳實際監聽的位址，
+// EmbeddedAddr 可用 "127.0.0.1:0" 取得隨機埠。
+// 有設定 Username / Password 時只接受該帳號，且只能存取 TopicPrefix 下的 topic；
+// 沒有帳號時不驗證身分，因此只允許 loopback
+func startEmbedded(ctx context.Context, cfg Config) (string, error) {
+	// 先自行 listen 以取得實際埠號，再交給 broker
+	ln, err := net.Listen("tcp", cfg.EmbeddedAddr)
+	if err != nil {
+		return "", err
+	}
+	bound := ln.Addr().(*net.TCPAddr)
+	ln.Close()
+
+	secured := cfg.Username != "" && cfg.Password != ""
+	if !bound.IP.IsLoopback() && !secured {
+		return "", ErrEmbeddedAuthRequired
+	}
+
+	server := mochi.New(&mochi.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})),
+	})
+	if secured {
+		ledger := &auth.Ledger{
+			Users: auth.Users{cfg.Username: {
+				Username: auth.RString(cfg.Username),
+				Password: auth.RString(cfg.Password),
+				ACL:      auth.Filters{auth.RString(cfg.TopicPrefix + "/#"): auth.ReadWrite},
+			}},
+			// 其他 topic 一律拒絕
+			ACL: auth.ACLRules{{Filters: auth.Filters{"#": auth.Deny}}},
+		}
+		err = server.AddHook(new(auth.Hook), &auth.Options{Ledger: ledger})
+	} else {
+		err = server.AddHook(new(auth.AllowHook), nil)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	listenAddr := fmt.Sprintf("%s:%d", bound.IP.String(), bound.Port)
+	if bound.IP.IsUnspecified() {
+		listenAddr = fmt.Sprintf(":%d", bound.Port)
+	}
+	if err := server.AddListener(listeners.NewTCP(listeners.Config{ID: "embedded", Address: listenAddr})); err != nil {
+		return "", err
+	}
+
+	go func() {
+		if err := server.Serve(); err != nil {
+			logger.Error(fmt.Sprintf("[MQTT] embedded broker stopped: %v", err))
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	logger.Info(fmt.Sprintf("[MQTT] embedded broker listening on %s auth=%t", listenAddr, secured))
+	return fmt.Sprintf("127.0.0.1:%d", bound.Port), nil
+}
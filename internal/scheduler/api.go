@@ -0,0 +1,172 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/audit"
+	"github.com/HarrisonZz/web_server_in_go/internal/handler"
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// scheduleRequest 是 POST / PUT /schedules 的 body
+//
+//	{"target":"led","command":{"state":"on"},"duration":"30s"}          立即開燈 30 秒後還原
+//	{"target":"led","command":{"state":"off"},"cron":"0 22 * * *"}      每天 22:00 關燈
+//	{"target":"led","command":{"state":"on"},"delay":"10m"}             10 分鐘後開燈
+type scheduleRequest struct {
+	Name     string          `json:"name"`
+	Target   string          `json:"target"`
+	Command  json.RawMessage `json:"command"`
+	Cron     string          `json:"cron"`
+	At       *time.Time      `json:"at"`
+	Delay    Duration        `json:"delay"`
+	Duration Duration        `json:"duration"`
+	Enabled  *bool           `json:"enabled"`
+}
+
+func (r scheduleRequest) toSchedule(now time.Time) (*Schedule, error) {
+	sc := &Schedule{
+		Name:     r.Name,
+		Target:   r.Target,
+		Command:  r.Command,
+		Cron:     r.Cron,
+		At:       r.At,
+		Duration: r.Duration,
+		Enabled:  true,
+	}
+	if r.Enabled != nil {
+		sc.Enabled = *r.Enabled
+	}
+
+	switch {
+	case r.Delay < 0:
+		return nil, fmt.Errorf("%w: delay must be positive", ErrInvalid)
+	case r.Delay > 0 && (r.Cron != "" || r.At != nil):
+		return nil, fmt.Errorf("%w: delay cannot be combined with cron or at", ErrInvalid)
+	case r.Delay > 0:
+		at := now.Add(time.Duration(r.Delay))
+		sc.At = &at
+	case r.Cron == "" && r.At == nil:
+		// 沒有指定時間就立即執行（通常搭配 duration）
+		sc.At = &now
+	}
+	return sc, nil
+}
+
+func registerRoutes() {
+	handler.RegisterRoute(http.MethodGet, "/schedules", listSchedules)
+	handler.RegisterRoute(http.MethodPost, "/schedules", createSchedule)
+	handler.RegisterRoute(http.MethodGet, "/schedules/:id", getSchedule)
+	handler.RegisterRoute(http.MethodPut, "/schedules/:id", updateSchedule)
+	handler.RegisterRoute(http.MethodDelete, "/schedules/:id", deleteSchedule)
+}
+
+func listSchedules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"schedules": defaultScheduler.List()})
+}
+
+func getSchedule(c *gin.Context) {
+	sc, err := defaultScheduler.Get(c.Param("id"))
+	if err != nil {
+		replyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, sc)
+}
+
+func createSchedule(c *gin.Context) {
+	sc, ok := bindSchedule(c)
+	if !ok {
+		return
+	}
+
+	created, err := defaultScheduler.Create(c.Request.Context(), sc)
+	recordSchedule(c, "schedule.create", sc.ID, nil, sc, err)
+	if err != nil {
+		replyError(c, err)
+		return
+	}
+	trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("schedule.id", created.ID))
+	c.JSON(http.StatusCreated, created)
+}
+
+func updateSchedule(c *gin.Context) {
+	sc, ok := bindSchedule(c)
+	if !ok {
+		return
+	}
+
+	old, _ := defaultScheduler.Get(c.Param("id"))
+	updated, err := defaultScheduler.Update(c.Request.Context(), c.Param("id"), sc)
+	if !errors.Is(err, ErrNotFound) {
+		recordSchedule(c, "schedule.update", c.Param("id"), old, sc, err)
+	}
+	if err != nil {
+		replyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+func deleteSchedule(c *gin.Context) {
+	old, _ := defaultScheduler.Get(c.Param("id"))
+	err := defaultScheduler.Delete(c.Request.Context(), c.Param("id"))
+	if !errors.Is(err, ErrNotFound) {
+		recordSchedule(c, "schedule.delete", c.Param("id"), old, nil, err)
+	}
+	if err != nil {
+		replyError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// recordSchedule 將排程的新增 / 修改 / 刪除寫入稽核紀錄，device 為排程的 target
+func recordSchedule(c *gin.Context, op, id string, old, cur *Schedule, err error) {
+	e := audit.Entry{Source: "api", Operation: op, Target: id}
+	e.Result, e.Error = audit.Result(err)
+	if old != nil {
+		e.Old, e.Device = old, old.Target
+	}
+	if cur != nil {
+		e.New, e.Device = cur, cur.Target
+	}
+	audit.Record(c.Request.Context(), e)
+}
+
+func bindSchedule(c *gin.Context) (*Schedule, bool) {
+	var req scheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Warn(fmt.Sprintf("[SCHED] %s invalid JSON from=%s error=%v", c.FullPath(), c.ClientIP(), err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json", "code": "invalid_json"})
+		return nil, false
+	}
+	sc, err := req.toSchedule(time.Now())
+	if err != nil {
+		replyError(c, err)
+		return nil, false
+	}
+	return sc, true
+}
+
+func replyError(c *gin.Context, err error) {
+	status, code := http.StatusInternalServerError, "internal_error"
+	switch {
+	case errors.Is(err, ErrNotFound):
+		status, code = http.StatusNotFound, "not_found"
+	case errors.Is(err, ErrInvalid):
+		status, code = http.StatusBadRequest, "invalid_schedule"
+	case errors.Is(err, ErrNoExecutor):
+		status, code = http.StatusBadRequest, "unknown_target"
+	default:
+		logger.Error(fmt.Sprintf("[SCHED] %s %s error=%v", c.Request.Method, c.FullPath(), err))
+	}
+	c.JSON(status, gin.H{"error": err.Error(), "code": code})
+}
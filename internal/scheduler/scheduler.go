@@ -0,0 +1,558 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Executor 負責實際執行某一類 target（例如 "led"）的指令
+type Executor interface {
+	// Validate 在建立排程時檢查指令，避免到觸發時才失敗
+	Validate(cmd json.RawMessage) error
+	// Execute 執行指令並回傳執行前的狀態，供 Duration 到期時還原
+	Execute(ctx context.Context, cmd json.RawMessage) (previous json.RawMessage, err error)
+}
+
+var (
+	executorsMu sync.RWMutex
+	executors   = map[string]Executor{}
+
+	ErrNotFound      = errors.New("schedule not found")
+	ErrInvalid       = errors.New("invalid schedule")
+	ErrNoExecutor    = errors.New("no executor registered for target")
+	fireTimeout      = 10 * time.Second
+	syncInterval     = 15 * time.Second // 多副本時從 store 取得其他副本建立、修改的排程
+	tracer           = otel.Tracer("web-server-in-go/scheduler")
+	cronParser       = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+	defaultScheduler *Scheduler
+)
+
+// RegisterExecutor 註冊 target 對應的 Executor，通常在各裝置的 Init 中呼叫
+func RegisterExecutor(target string, e Executor) {
+	executorsMu.Lock()
+	defer executorsMu.Unlock()
+	executors[target] = e
+}
+
+func executorFor(target string) (Executor, bool) {
+	executorsMu.RLock()
+	defer executorsMu.RUnlock()
+	e, ok := executors[target]
+	return e, ok
+}
+
+// Duration 以 "30s"、"1h30m" 的格式做 JSON 序列化
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Schedule 是一筆排程：cron 週期性觸發，或在 At 觸發一次
+type Schedule struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name,omitempty"`
+	Target    string          `json:"target"`
+	Command   json.RawMessage `json:"command"`
+	Cron      string          `json:"cron,omitempty"`
+	At        *time.Time      `json:"at,omitempty"`
+	Duration  Duration        `json:"duration,omitempty"` // >0 時，觸發後經過 Duration 自動還原成觸發前的狀態
+	Enabled   bool            `json:"enabled"`
+	RevertOf  string          `json:"revert_of,omitempty"` // 由 Duration 產生的還原排程，指向原排程
+	NextRun   *time.Time      `json:"next_run,omitempty"`
+	LastRun   *time.Time      `json:"last_run,omitempty"`
+	LastError string          `json:"last_error,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+func (s *Schedule) clone() *Schedule {
+	c := *s
+	return &c
+}
+
+// validate 檢查欄位並計算 NextRun
+func (s *Schedule) validate(now time.Time) error {
+	if s.Target == "" {
+		return fmt.Errorf("%w: target is required", ErrInvalid)
+	}
+	if len(s.Command) == 0 {
+		return fmt.Errorf("%w: command is required", ErrInvalid)
+	}
+	if s.Cron != "" && s.At != nil {
+		return fmt.Errorf("%w: cron and at are mutually exclusive", ErrInvalid)
+	}
+	if s.Duration < 0 {
+		return fmt.Errorf("%w: duration must be positive", ErrInvalid)
+	}
+	e, ok := executorFor(s.Target)
+	if !ok {
+		return fmt.Errorf("%w %q", ErrNoExecutor, s.Target)
+	}
+	if err := e.Validate(s.Command); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if s.Cron != "" {
+		sched, err := cronParser.Parse(s.Cron)
+		if err != nil {
+			return fmt.Errorf("%w: cron: %v", ErrInvalid, err)
+		}
+		if s.Duration > 0 {
+			// 還原必須在下一次觸發前完成，否則會蓋掉下一次的結果
+			first := sched.Next(now)
+			if time.Duration(s.Duration) >= sched.Next(first).Sub(first) {
+				return fmt.Errorf("%w: duration must be shorter than the cron interval", ErrInvalid)
+			}
+		}
+	}
+	s.schedule(now)
+	return nil
+}
+
+// schedule 依目前時間更新 NextRun，停用或已過期的一次性排程為 nil
+func (s *Schedule) schedule(now time.Time) {
+	s.NextRun = nil
+	if !s.Enabled {
+		return
+	}
+	if s.Cron != "" {
+		if sched, err := cronParser.Parse(s.Cron); err == nil {
+			next := sched.Next(now)
+			s.NextRun = &next
+		}
+		return
+	}
+	if s.At != nil {
+		at := *s.At
+		s.NextRun = &at
+	}
+}
+
+// Scheduler 管理所有排程並在到期時呼叫 Executor
+type Scheduler struct {
+	mu        sync.Mutex
+	schedules map[string]*Schedule
+	store     Store
+	wake      chan struct{}
+}
+
+func New(store Store) *Scheduler {
+	return &Scheduler{
+		schedules: map[string]*Schedule{},
+		store:     store,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Init 從 store 載入排程、定期同步其他副本的修改，並註冊 /schedules API
+func Init(ctx context.Context, store Store) error {
+	s := New(store)
+	if err := s.load(ctx); err != nil {
+		return err
+	}
+	defaultScheduler = s
+	go s.syncLoop(ctx)
+	registerRoutes()
+	return nil
+}
+
+// Start 重新從 store 載入排程後啟動觸發迴圈；每次取得 leadership 都會呼叫，
+// 接手前由其他副本建立的排程因此不會遺漏
+func Start(ctx context.Context) {
+	s := defaultScheduler
+	if s == nil {
+		return
+	}
+	if err := s.load(ctx); err != nil {
+		logger.Error(fmt.Sprintf("[SCHED] reload failed, using cached schedules: %v", err))
+	}
+	go s.Run(ctx)
+}
+
+// load 以 store 的內容取代記憶體中的排程
+func (s *Scheduler) load(ctx context.Context) error {
+	list, err := s.store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("load schedules: %w", err)
+	}
+
+	now := time.Now()
+	next := make(map[string]*Schedule, len(list))
+	for _, sc := range list {
+		// 停機（或沒有 leader）期間錯過的 cron 不補執行；一次性排程（包含還原）保留原本的 At，立即補執行
+		if sc.Cron != "" {
+			sc.schedule(now)
+		}
+		next[sc.ID] = sc
+	}
+
+	s.mu.Lock()
+	s.schedules = next
+	s.notify()
+	s.mu.Unlock()
+	logger.Info(fmt.Sprintf("[SCHED] loaded %d schedule(s)", len(list)))
+	return nil
+}
+
+func (s *Scheduler) syncLoop(ctx context.Context) {
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.mu.Lock()
+		err := s.syncLocked(ctx)
+		s.mu.Unlock()
+		if err != nil {
+			logger.Warn(fmt.Sprintf("[SCHED] sync failed: %v", err))
+		}
+	}
+}
+
+// syncLocked 以 store 為準合併其他副本的修改，呼叫端須持有 s.mu。
+// 內容（不含 NextRun）相同的排程保留記憶體中的版本，避免覆蓋重新計算過的 NextRun
+func (s *Scheduler) syncLocked(ctx context.Context) error {
+	list, err := s.store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("load schedules: %w", err)
+	}
+
+	now := time.Now()
+	next := make(map[string]*Schedule, len(list))
+	changed := len(list) != len(s.schedules)
+	for _, sc := range list {
+		if cur, ok := s.schedules[sc.ID]; ok && sameDefinition(cur, sc) {
+			next[sc.ID] = cur
+			continue
+		}
+		if sc.NextRun == nil {
+			sc.schedule(now)
+		}
+		next[sc.ID] = sc
+		changed = true
+	}
+	if changed {
+		s.schedules = next
+		s.notify()
+	}
+	return nil
+}
+
+func sameDefinition(a, b *Schedule) bool {
+	a, b = a.clone(), b.clone()
+	a.NextRun, b.NextRun = nil, nil
+	ja, err1 := json.Marshal(a)
+	jb, err2 := json.Marshal(b)
+	return err1 == nil && err2 == nil && string(ja) == string(jb)
+}
+
+// List 依 NextRun 排序回傳所有排程的副本
+func (s *Scheduler) List() []*Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]*Schedule, 0, len(s.schedules))
+	for _, sc := range s.schedules {
+		out = append(out, sc.clone())
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].NextRun, out[j].NextRun
+		switch {
+		case a == nil && b == nil:
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		case a == nil:
+			return false
+		case b == nil:
+			return true
+		}
+		return a.Before(*b)
+	})
+	return out
+}
+
+func (s *Scheduler) Get(id string) (*Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc, ok := s.schedules[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return sc.clone(), nil
+}
+
+// Create 驗證並保存新排程
+func (s *Scheduler) Create(ctx context.Context, sc *Schedule) (*Schedule, error) {
+	now := time.Now()
+	sc.ID = newID()
+	sc.CreatedAt = now
+	if err := sc.validate(now); err != nil {
+		return nil, err
+	}
+
+	err := s.commit(ctx, func(m map[string]*Schedule) error {
+		m[sc.ID] = sc
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Info(fmt.Sprintf("[SCHED] created id=%s target=%s cron=%q next=%v", sc.ID, sc.Target, sc.Cron, sc.NextRun))
+	return sc.clone(), nil
+}
+
+// Update 以新內容取代既有排程，保留 ID 與建立時間
+func (s *Scheduler) Update(ctx context.Context, id string, sc *Schedule) (*Schedule, error) {
+	now := time.Now()
+	err := s.commit(ctx, func(m map[string]*Schedule) error {
+		old, ok := m[id]
+		if !ok {
+			return ErrNotFound
+		}
+		sc.ID = id
+		sc.CreatedAt = old.CreatedAt
+		sc.LastRun = old.LastRun
+		sc.RevertOf = old.RevertOf
+		if err := sc.validate(now); err != nil {
+			return err
+		}
+		m[id] = sc
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Info(fmt.Sprintf("[SCHED] updated id=%s target=%s cron=%q next=%v", id, sc.Target, sc.Cron, sc.NextRun))
+	return sc.clone(), nil
+}
+
+func (s *Scheduler) Delete(ctx context.Context, id string) error {
+	err := s.commit(ctx, func(m map[string]*Schedule) error {
+		if _, ok := m[id]; !ok {
+			return ErrNotFound
+		}
+		delete(m, id)
+		return nil
+	})
+	if err == nil {
+		logger.Info(fmt.Sprintf("[SCHED] deleted id=%s", id))
+	}
+	return err
+}
+
+// commit 先與 store 同步，再在副本上套用修改；只把新增、替換與刪除的排程寫入 store，
+// 成功後才替換記憶體中的狀態
+func (s *Scheduler) commit(ctx context.Context, fn func(map[string]*Schedule) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.syncLocked(ctx); err != nil {
+		return err
+	}
+	next := make(map[string]*Schedule, len(s.schedules))
+	for id, sc := range s.schedules {
+		next[id] = sc
+	}
+	if err := fn(next); err != nil {
+		return err
+	}
+
+	// 修改一律放入新的 *Schedule，以指標判斷是否變動
+	var put []*Schedule
+	var del []string
+	for id, sc := range next {
+		if s.schedules[id] != sc {
+			put = append(put, sc)
+		}
+	}
+	for id := range s.schedules {
+		if _, ok := next[id]; !ok {
+			del = append(del, id)
+		}
+	}
+	if err := s.store.Apply(ctx, put, del); err != nil {
+		return fmt.Errorf("persist schedules: %w", err)
+	}
+
+	s.schedules = next
+	s.notify()
+	return nil
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run 等待最近一筆到期的排程，直到 ctx 結束
+func (s *Scheduler) Run(ctx context.Context) {
+	logger.Info("[SCHED] scheduler started")
+	for {
+		var timerC <-chan time.Time
+		var timer *time.Timer
+		if next, ok := s.nextDue(); ok {
+			timer = time.NewTimer(time.Until(next))
+			timerC = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			logger.Info("[SCHED] scheduler stopped")
+			return
+		case <-s.wake:
+		case <-timerC:
+			s.fireDue(ctx)
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (s *Scheduler) nextDue() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	for _, sc := range s.schedules {
+		if sc.NextRun != nil && (next.IsZero() || sc.NextRun.Before(next)) {
+			next = *sc.NextRun
+		}
+	}
+	return next, !next.IsZero()
+}
+
+func (s *Scheduler) fireDue(ctx context.Context) {
+	now := time.Now()
+
+	s.mu.Lock()
+	var due []*Schedule
+	for _, sc := range s.schedules {
+		if sc.NextRun != nil && !sc.NextRun.After(now) {
+			due = append(due, sc.clone())
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(due, func(i, j int) bool { return due[i].NextRun.Before(*due[j].NextRun) })
+	for _, sc := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		s.fire(ctx, sc)
+	}
+}
+
+// fire 執行一筆排程並更新狀態；一次性排程執行後移除，有 Duration 時產生還原排程
+func (s *Scheduler) fire(ctx context.Context, sc *Schedule) {
+	ctx, cancel := context.WithTimeout(ctx, fireTimeout)
+	defer cancel()
+	ctx, span := tracer.Start(ctx, "scheduler.fire")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("schedule.id", sc.ID),
+		attribute.String("schedule.target", sc.Target),
+		attribute.Bool("schedule.revert", sc.RevertOf != ""),
+	)
+
+	var previous json.RawMessage
+	e, ok := executorFor(sc.Target)
+	err := fmt.Errorf("%w %q", ErrNoExecutor, sc.Target)
+	if ok {
+		previous, err = e.Execute(ctx, sc.Command)
+	}
+
+	now := time.Now()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		logger.Error(fmt.Sprintf("[SCHED] fire failed id=%s target=%s error=%v", sc.ID, sc.Target, err))
+	} else {
+		logger.Info(fmt.Sprintf("[SCHED] fired id=%s target=%s command=%s", sc.ID, sc.Target, sc.Command))
+	}
+
+	update := func(m map[string]*Schedule) error {
+		cur, ok := m[sc.ID]
+		if !ok {
+			// 觸發期間被刪除
+			return nil
+		}
+		cur = cur.clone()
+		cur.LastRun = &now
+		cur.LastError = ""
+		if err != nil {
+			cur.LastError = err.Error()
+		}
+
+		if cur.Cron != "" {
+			cur.schedule(now)
+			m[cur.ID] = cur
+		} else {
+			delete(m, cur.ID)
+		}
+
+		if err == nil && cur.Duration > 0 && len(previous) > 0 {
+			at := now.Add(time.Duration(cur.Duration))
+			revert := &Schedule{
+				ID:        newID(),
+				Name:      strings.TrimSpace("revert " + cur.Name),
+				Target:    cur.Target,
+				Command:   previous,
+				At:        &at,
+				Enabled:   true,
+				RevertOf:  cur.ID,
+				CreatedAt: now,
+			}
+			revert.schedule(now)
+			m[revert.ID] = revert
+		}
+		return nil
+	}
+	if cerr := s.commit(ctx, update); cerr != nil {
+		// 寫不進 store 也要更新記憶體，否則同一筆排程會被反覆觸發
+		logger.Error(fmt.Sprintf("[SCHED] failed to persist after firing id=%s error=%v", sc.ID, cerr))
+		s.mu.Lock()
+		_ = update(s.schedules)
+		s.mu.Unlock()
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
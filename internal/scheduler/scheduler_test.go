@@ -0,0 +1,223 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeExecutor 記錄每次執行的指令，回傳固定的 previous
+type fakeExecutor struct {
+	mu   sync.Mutex
+	runs []string
+}
+
+func (e *fakeExecutor) Validate(cmd json.RawMessage) error {
+	var v map[string]any
+	return json.Unmarshal(cmd, &v)
+}
+
+func (e *fakeExecutor) Execute(_ context.Context, cmd json.RawMessage) (json.RawMessage, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.runs = append(e.runs, string(cmd))
+	return json.RawMessage(`{"prev":true}`), nil
+}
+
+func (e *fakeExecutor) count() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.runs)
+}
+
+func newTestExecutor(t *testing.T) *fakeExecutor {
+	t.Helper()
+	e := &fakeExecutor{}
+	RegisterExecutor("test", e)
+	t.Cleanup(func() {
+		executorsMu.Lock()
+		delete(executors, "test")
+		executorsMu.Unlock()
+	})
+	return e
+}
+
+func TestReplicasShareStore(t *testing.T) {
+	newTestExecutor(t)
+	ctx := context.Background()
+	store := NewFileStore(filepath.Join(t.TempDir(), "schedules.json"))
+
+	leader, follower := New(store), New(store)
+	a, err := leader.Create(ctx, &Schedule{Target: "test", Command: json.RawMessage(`{"a":1}`), Cron: "@hourly", Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// follower 的記憶體中沒有 a，寫入時不可把 a 從 store 刪掉
+	b, err := follower.Create(ctx, &Schedule{Target: "test", Command: json.RawMessage(`{"b":1}`), Cron: "@daily", Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("store has %d schedules, want 2", len(list))
+	}
+
+	// leader 寫入前會先同步，看得到 follower 建立的 b
+	if err := leader.Delete(ctx, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leader.Get(b.ID); err != nil {
+		t.Fatalf("leader does not see follower's schedule: %v", err)
+	}
+	list, _ = store.Load(ctx)
+	if len(list) != 1 || list[0].ID != b.ID {
+		t.Fatalf("store = %+v, want only %s", list, b.ID)
+	}
+}
+
+func TestStartReloadsFromStore(t *testing.T) {
+	exec := newTestExecutor(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := NewFileStore(filepath.Join(t.TempDir(), "schedules.json"))
+
+	leader := New(store)
+	defaultScheduler = leader
+	t.Cleanup(func() { defaultScheduler = nil })
+
+	// 由其他副本建立、已到期的一次性排程
+	at := time.Now().Add(-time.Second)
+	other := New(store)
+	if _, err := other.Create(ctx, &Schedule{Target: "test", Command: json.RawMessage(`{"x":1}`), At: &at, Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	Start(ctx)
+	deadline := time.Now().Add(2 * time.Second)
+	for exec.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if exec.count() != 1 {
+		t.Fatalf("executed %d times, want 1", exec.count())
+	}
+}
+
+func TestScheduleValidate(t *testing.T) {
+	newTestExecutor(t)
+	now := time.Date(2026, 3, 10, 8, 30, 0, 0, time.UTC)
+	at := now.Add(time.Hour)
+	ptime := func(t time.Time) *time.Time { return &t }
+	cmd := json.RawMessage(`{"mode":"on"}`)
+
+	tests := []struct {
+		name    string
+		sc      Schedule
+		wantErr error
+		wantRun *time.Time
+	}{
+		{name: "cron", sc: Schedule{Target: "test", Command: cmd, Cron: "0 9 * * *", Enabled: true}, wantRun: ptime(time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC))},
+		{name: "cron descriptor", sc: Schedule{Target: "test", Command: cmd, Cron: "@hourly", Enabled: true}, wantRun: ptime(time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC))},
+		{name: "one-shot", sc: Schedule{Target: "test", Command: cmd, At: &at, Enabled: true}, wantRun: &at},
+		{name: "disabled has no next run", sc: Schedule{Target: "test", Command: cmd, Cron: "@hourly"}},
+		{name: "duration shorter than interval", sc: Schedule{Target: "test", Command: cmd, Cron: "@hourly", Duration: Duration(30 * time.Minute), Enabled: true}, wantRun: ptime(time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC))},
+		{name: "duration covers interval", sc: Schedule{Target: "test", Command: cmd, Cron: "@hourly", Duration: Duration(time.Hour)}, wantErr: ErrInvalid},
+		{name: "negative duration", sc: Schedule{Target: "test", Command: cmd, At: &at, Duration: Duration(-time.Second)}, wantErr: ErrInvalid},
+		{name: "cron and at", sc: Schedule{Target: "test", Command: cmd, Cron: "@hourly", At: &at}, wantErr: ErrInvalid},
+		{name: "bad cron", sc: Schedule{Target: "test", Command: cmd, Cron: "*/0 * * *"}, wantErr: ErrInvalid},
+		{name: "seconds field not accepted", sc: Schedule{Target: "test", Command: cmd, Cron: "0 0 9 * * *"}, wantErr: ErrInvalid},
+		{name: "missing target", sc: Schedule{Command: cmd, Cron: "@hourly"}, wantErr: ErrInvalid},
+		{name: "missing command", sc: Schedule{Target: "test", Cron: "@hourly"}, wantErr: ErrInvalid},
+		{name: "command rejected by executor", sc: Schedule{Target: "test", Command: json.RawMessage(`[`), Cron: "@hourly"}, wantErr: ErrInvalid},
+		{name: "unknown target", sc: Schedule{Target: "fan", Command: cmd, Cron: "@hourly"}, wantErr: ErrNoExecutor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := tt.sc
+			err := sc.validate(now)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			switch {
+			case tt.wantRun == nil && sc.NextRun != nil:
+				t.Fatalf("next run = %v, want none", sc.NextRun)
+			case tt.wantRun != nil && (sc.NextRun == nil || !sc.NextRun.Equal(*tt.wantRun)):
+				t.Fatalf("next run = %v, want %v", sc.NextRun, tt.wantRun)
+			}
+		})
+	}
+}
+
+func TestFire(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name       string
+		sc         Schedule
+		wantKept   bool // 觸發後原排程是否仍存在
+		wantRevert bool
+	}{
+		{name: "cron reschedules", sc: Schedule{Cron: "@hourly"}, wantKept: true},
+		{name: "one-shot is removed", sc: Schedule{At: &past}},
+		{name: "one-shot with duration schedules a revert", sc: Schedule{At: &past, Duration: Duration(time.Minute)}, wantRevert: true},
+		{name: "cron with duration keeps and reverts", sc: Schedule{Cron: "@hourly", Duration: Duration(time.Minute)}, wantKept: true, wantRevert: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exec := newTestExecutor(t)
+			ctx := context.Background()
+			s := New(NewFileStore(filepath.Join(t.TempDir(), "schedules.json")))
+
+			sc := tt.sc
+			sc.Target, sc.Command, sc.Enabled = "test", json.RawMessage(`{"mode":"on"}`), true
+			created, err := s.Create(ctx, &sc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := time.Now()
+			s.fire(ctx, created)
+
+			if exec.count() != 1 {
+				t.Fatalf("executed %d times, want 1", exec.count())
+			}
+			got, err := s.Get(created.ID)
+			if tt.wantKept {
+				if err != nil {
+					t.Fatalf("cron schedule removed: %v", err)
+				}
+				if got.LastRun == nil || got.NextRun == nil || !got.NextRun.After(before) {
+					t.Fatalf("cron schedule not rescheduled: last=%v next=%v", got.LastRun, got.NextRun)
+				}
+			} else if !errors.Is(err, ErrNotFound) {
+				t.Fatalf("one-shot schedule still present: %v", err)
+			}
+
+			var revert *Schedule
+			for _, r := range s.List() {
+				if r.RevertOf == created.ID {
+					revert = r
+				}
+			}
+			if (revert != nil) != tt.wantRevert {
+				t.Fatalf("revert schedule = %+v, want %t", revert, tt.wantRevert)
+			}
+			if revert != nil {
+				if string(revert.Command) != `{"prev":true}` || revert.NextRun == nil || revert.NextRun.Sub(before) > time.Minute+time.Second {
+					t.Fatalf("revert = %+v, want previous state about a minute later", revert)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/cache"
+)
+
+// Store 保存排程，讓排程在重啟後仍然存在。
+// 多個副本共用同一個 Store，Apply 只寫入有變動的排程，不會蓋掉其他副本建立的排程
+type Store interface {
+	Load(ctx context.Context) ([]*Schedule, error)
+	// Apply 新增或取代 put 中的排程、刪除 del 中的 ID，兩者一起生效
+	Apply(ctx context.Context, put []*Schedule, del []string) error
+}
+
+// redisStore 以 Redis hash 保存，每筆排程一個 field（ID → JSON），不設 TTL
+type redisStore struct {
+	c   cache.Cache
+	key string
+}
+
+func NewRedisStore(c cache.Cache, key string) Store {
+	return &redisStore{c: c, key: key}
+}
+
+func (s *redisStore) Load(ctx context.Context) ([]*Schedule, error) {
+	m, err := s.c.HGetAll(ctx, s.key)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*Schedule, 0, len(m))
+	for id, v := range m {
+		var sc Schedule
+		if err := json.Unmarshal(v, &sc); err != nil {
+			return nil, fmt.Errorf("schedule %s: %w", id, err)
+		}
+		list = append(list, &sc)
+	}
+	return list, nil
+}
+
+func (s *redisStore) Apply(ctx context.Context, put []*Schedule, del []string) error {
+	set := make(map[string][]byte, len(put))
+	for _, sc := range put {
+		v, err := json.Marshal(sc)
+		if err != nil {
+			return err
+		}
+		set[sc.ID] = v
+	}
+	return s.c.HApply(ctx, s.key, set, del)
+}
+
+// fileStore 將排程存成本機 JSON 檔，先寫暫存檔再 rename 避免寫到一半斷電；
+// 同一台機器上的多個 process 以 path.lock 的 flock 互斥，讀-改-寫不會互相覆蓋
+type fileStore struct {
+	path string
+}
+
+func NewFileStore(path string) Store {
+	return &fileStore{path: path}
+}
+
+func (s *fileStore) Load(_ context.Context) ([]*Schedule, error) {
+	unlock, err := s.lock(syscall.LOCK_SH)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return s.read()
+}
+
+func (s *fileStore) Apply(_ context.Context, put []*Schedule, del []string) error {
+	if len(put) == 0 && len(del) == 0 {
+		return nil
+	}
+	unlock, err := s.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	list, err := s.read()
+	if err != nil {
+		return err
+	}
+	m := make(map[string]*Schedule, len(list)+len(put))
+	for _, sc := range list {
+		m[sc.ID] = sc
+	}
+	for _, sc := range put {
+		m[sc.ID] = sc
+	}
+	for _, id := range del {
+		delete(m, id)
+	}
+	out := make([]*Schedule, 0, len(m))
+	for _, sc := range m {
+		out = append(out, sc)
+	}
+	return s.write(out)
+}
+
+func (s *fileStore) lock(how int) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(s.path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+func (s *fileStore) read() ([]*Schedule, error) {
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []*Schedule
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *fileStore) write(list []*Schedule) error {
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
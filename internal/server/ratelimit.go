@@ -0,0 +1,69 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/config"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// 超過這段時間沒有請求的 client 會被清掉
+const limiterIdle = 5 * time.Minute
+
+type clientLimiter struct {
+	lim  *rate.Limiter
+	seen time.Time
+}
+
+// RateLimit 以 client IP 做 token bucket 限流，速率取自 config.Current()，
+// 設定改變時既有的 bucket 直接套用新速率；rate_limit_rps 為 0 時不限流
+func RateLimit() gin.HandlerFunc {
+	var (
+		mu      sync.Mutex
+		clients = map[string]*clientLimiter{}
+		swept   = time.Now()
+	)
+	return func(c *gin.Context) {
+		cfg := config.Current()
+		if cfg.RateLimit <= 0 {
+			c.Next()
+			return
+		}
+		limit, now := rate.Limit(cfg.RateLimit), time.Now()
+
+		mu.Lock()
+		if now.Sub(swept) > limiterIdle {
+			for ip, cl := range clients {
+				if now.Sub(cl.seen) > limiterIdle {
+					delete(clients, ip)
+				}
+			}
+			swept = now
+		}
+		cl, ok := clients[c.ClientIP()]
+		if !ok {
+			cl = &clientLimiter{lim: rate.NewLimiter(limit, cfg.RateBurst)}
+			clients[c.ClientIP()] = cl
+		}
+		cl.seen = now
+		if cl.lim.Limit() != limit || cl.lim.Burst() != cfg.RateBurst {
+			cl.lim.SetLimitAt(now, limit)
+			cl.lim.SetBurstAt(now, cfg.RateBurst)
+		}
+		r := cl.lim.ReserveN(now, 1)
+		mu.Unlock()
+
+		if delay := r.DelayFrom(now); delay > 0 {
+			r.CancelAt(now)
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded", "code": "rate_limited"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,23 +1,25 @@
 package server
 
 import (
+	"github.com/HarrisonZz/web_server_in_go/internal/audit"
 	"github.com/HarrisonZz/web_server_in_go/internal/deps"
 	"github.com/HarrisonZz/web_server_in_go/internal/handler"
 	"github.com/HarrisonZz/web_server_in_go/internal/telemetry"
 	"github.com/gin-gonic/gin"
 
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/metric/noop"
 )
 
 func NewRouter(d deps.Deps) *gin.Engine {
 	// 建 Router：預設含 Logger/Recovery 中介層
 	r := gin.New()
-	r.Use(otelgin.Middleware("web-server-in-go"), telemetry.GinChildSpan(), gin.Logger(), gin.Recovery(), deps.InjectDeps(d))
+	// HTTP metrics 由 telemetry.GinMetrics 記錄，關掉 otelgin 內建的避免重複
+	r.Use(otelgin.Middleware("web-server-in-go", otelgin.WithMeterProvider(noop.NewMeterProvider())), telemetry.GinMetrics(), telemetry.GinChildSpan(), gin.Logger(), gin.Recovery(), RateLimit(), deps.InjectDeps(d), audit.Middleware())
 	r.NoRoute(handler.NoRoute)
 
-	routeMap := handler.GetRoutes()
-	for path, h := range routeMap {
-		r.GET(path, h)
+	for _, rt := range handler.GetRoutes() {
+		r.Handle(rt.Method(), rt.Path(), rt.Handle)
 	}
 
 	return r
@@ -0,0 +1,369 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip" // 註冊 gzip compressor
+	"gopkg.in/yaml.v3"
+)
+
+// exporter 種類
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterNone   = "none"
+)
+
+// OTLP protocol
+const (
+	ProtocolGRPC = "grpc"
+	ProtocolHTTP = "http/protobuf"
+)
+
+// OTLPConfig 對應 OTEL_EXPORTER_OTLP_* 環境變數，traces、metrics 與 logs 共用；只有 endpoint 可以依 signal 分開設定
+type OTLPConfig struct {
+	Protocol          string            `yaml:"protocol"`         // grpc | http/protobuf
+	Endpoint          string            `yaml:"endpoint"`         // URL（http:// 表示不加密）或 host:port
+	TracesEndpoint    string            `yaml:"traces_endpoint"`  // 有設定時取代 traces 的 Endpoint
+	MetricsEndpoint   string            `yaml:"metrics_endpoint"` // 有設定時取代 metrics 的 Endpoint
+	LogsEndpoint      string            `yaml:"logs_endpoint"`    // 有設定時取代 logs 的 Endpoint
+	Insecure          bool              `yaml:"insecure"`         // endpoint 為 host:port 且沒有設定憑證時才有作用，預設 false
+	Headers           map[string]string `yaml:"headers"`          // 例如 Authorization
+	Certificate       string            `yaml:"certificate"`      // CA bundle 路徑
+	ClientCertificate string            `yaml:"client_certificate"`
+	ClientKey         string            `yaml:"client_key"`
+	Compression       string            `yaml:"compression"` // gzip | none
+	Timeout           time.Duration     `yaml:"timeout"`
+
+	perSignal bool // Endpoint 來自 *_endpoint，URL 原樣使用
+}
+
+// LoadConfig 依序套用內建預設值、設定檔（不存在時略過）與 OTEL_* 環境變數，後者優先
+func LoadConfig(path string) (Config, error) {
+	cfg := Config{
+		ServiceName: "web-server-in-go",
+		Exporter:    ExporterOTLP,
+		OTLP: OTLPConfig{
+			Protocol: ProtocolHTTP,
+			Endpoint: "http://localhost:4318", // 規範的預設值；scheme 決定是否加密
+			Timeout:  10 * time.Second,
+		},
+		Sampling: defaultSampling(),
+		Logs:     LogsConfig{Exporter: ExporterNone},
+		Metrics: MetricsConfig{
+			OTLP:       true,
+			Prometheus: true,
+			AdminAddr:  ":9464",
+			Interval:   60 * time.Second,
+		},
+	}
+
+	if path != "" {
+		b, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return cfg, err
+		default:
+			if err := yaml.Unmarshal(b, &cfg); err != nil {
+				return cfg, fmt.Errorf("parse %s: %w", path, err)
+			}
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.validate()
+}
+
+// applyEnv 套用 OpenTelemetry 規範的環境變數
+func (c *Config) applyEnv() error {
+	if v := os.Getenv("OTEL_SERVICE_NAME"); v != "" {
+		c.ServiceName = v
+	}
+	if v := strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER")); v != "" {
+		if v == "console" {
+			v = ExporterStdout
+		}
+		c.Exporter = v
+	}
+
+	o := &c.OTLP
+	if v := otlpEnv("PROTOCOL"); v != "" {
+		o.Protocol = v
+	}
+	if v := otlpEnv("ENDPOINT"); v != "" {
+		o.Endpoint = v
+	}
+	if v := otlpEnv("TRACES_ENDPOINT"); v != "" {
+		o.TracesEndpoint = v
+	}
+	if v := otlpEnv("METRICS_ENDPOINT"); v != "" {
+		o.MetricsEndpoint = v
+	}
+	if v := otlpEnv("LOGS_ENDPOINT"); v != "" {
+		o.LogsEndpoint = v
+	}
+	if v := otlpEnv("INSECURE"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("OTEL_EXPORTER_OTLP_INSECURE: %w", err)
+		}
+		o.Insecure = b
+	}
+	if v := otlpEnv("HEADERS"); v != "" {
+		h, err := parseHeaders(v)
+		if err != nil {
+			return fmt.Errorf("OTEL_EXPORTER_OTLP_HEADERS: %w", err)
+		}
+		o.Headers = h
+	}
+	if v := otlpEnv("CERTIFICATE"); v != "" {
+		o.Certificate = v
+	}
+	if v := otlpEnv("CLIENT_CERTIFICATE"); v != "" {
+		o.ClientCertificate = v
+	}
+	if v := otlpEnv("CLIENT_KEY"); v != "" {
+		o.ClientKey = v
+	}
+	if v := otlpEnv("COMPRESSION"); v != "" {
+		o.Compression = v
+	}
+	if v := otlpEnv("TIMEOUT"); v != "" {
+		ms, err := strconv.Atoi(v) // 規範以毫秒為單位
+		if err != nil {
+			return fmt.Errorf("OTEL_EXPORTER_OTLP_TIMEOUT: %w", err)
+		}
+		o.Timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	if err := c.Sampling.applyEnv(); err != nil {
+		return err
+	}
+	if v := strings.ToLower(os.Getenv("OTEL_LOGS_EXPORTER")); v != "" {
+		if v == "console" {
+			v = ExporterStdout
+		}
+		c.Logs.Exporter = v
+	}
+
+	m := &c.Metrics
+	if v := os.Getenv("OTEL_METRICS_EXPORTER"); v != "" {
+		m.OTLP, m.Prometheus = false, false
+		for _, e := range strings.Split(strings.ToLower(v), ",") {
+			switch strings.TrimSpace(e) {
+			case ExporterOTLP:
+				m.OTLP = true
+			case "prometheus":
+				m.Prometheus = true
+			case ExporterNone:
+			default:
+				return fmt.Errorf("OTEL_METRICS_EXPORTER: unknown exporter %q", e)
+			}
+		}
+	}
+	if v := os.Getenv("OTEL_METRIC_EXPORT_INTERVAL"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms <= 0 {
+			return fmt.Errorf("OTEL_METRIC_EXPORT_INTERVAL: invalid value %q", v)
+		}
+		m.Interval = time.Duration(ms) * time.Millisecond
+	}
+	if v := os.Getenv("METRICS_ADDR"); v != "" {
+		m.AdminAddr = v
+	}
+	return nil
+}
+
+func otlpEnv(name string) string {
+	return os.Getenv("OTEL_EXPORTER_OTLP_" + name)
+}
+
+// forSignal 回傳以 signal 專用 endpoint 取代 Endpoint 的副本
+func (o OTLPConfig) forSignal(endpoint string) OTLPConfig {
+	if endpoint != "" {
+		o.Endpoint = endpoint
+		o.perSignal = true
+	}
+	return o
+}
+
+// parseHeaders 解析 key1=value1,key2=value2，value 為 URL encoded
+func parseHeaders(s string) (map[string]string, error) {
+	h := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid header %q", kv)
+		}
+		uv, err := url.QueryUnescape(strings.TrimSpace(v))
+		if err != nil {
+			return nil, err
+		}
+		h[strings.TrimSpace(k)] = uv
+	}
+	return h, nil
+}
+
+func (c Config) validate() error {
+	switch c.Exporter {
+	case ExporterOTLP, ExporterStdout, ExporterNone:
+	default:
+		return fmt.Errorf("unknown exporter %q (want otlp, stdout or none)", c.Exporter)
+	}
+	switch c.Logs.Exporter {
+	case ExporterOTLP, ExporterStdout, ExporterNone:
+	default:
+		return fmt.Errorf("unknown logs exporter %q (want otlp, stdout or none)", c.Logs.Exporter)
+	}
+	switch c.OTLP.Protocol {
+	case ProtocolGRPC, ProtocolHTTP:
+	default:
+		return fmt.Errorf("unsupported OTLP protocol %q (want grpc or http/protobuf)", c.OTLP.Protocol)
+	}
+	switch c.OTLP.Compression {
+	case "", "none", "gzip":
+	default:
+		return fmt.Errorf("unsupported OTLP compression %q", c.OTLP.Compression)
+	}
+	return c.Sampling.validate()
+}
+
+// endpointURL 在 endpoint 是完整 URL 時回傳；signal 專用的 endpoint 原樣使用，
+// 共用的 Endpoint 則在原本的路徑後補上 signal 的路徑（例如 /otlp → /otlp/v1/traces）
+func (o OTLPConfig) endpointURL(signalPath string) (string, bool) {
+	u, err := url.Parse(o.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	if o.Protocol == ProtocolHTTP && !o.perSignal {
+		u.Path = strings.TrimSuffix(u.Path, "/") + signalPath
+	}
+	return u.String(), true
+}
+
+// tlsConfig 載入 CA bundle 與 client 憑證；都沒設定時回傳 nil，使用系統 CA
+func (o OTLPConfig) tlsConfig() (*tls.Config, error) {
+	if o.Certificate == "" && o.ClientCertificate == "" {
+		return nil, nil
+	}
+	tc := &tls.Config{MinVersion: tls.VersionTLS12}
+	if o.Certificate != "" {
+		pem, err := os.ReadFile(o.Certificate)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", o.Certificate)
+		}
+		tc.RootCAs = pool
+	}
+	if o.ClientCertificate != "" {
+		cert, err := tls.LoadX509KeyPair(o.ClientCertificate, o.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+// otlpOptionSet 把共用的 OTLP 設定對應到某個 exporter 套件的 Option 型別
+type otlpOptionSet[O any] struct {
+	timeout     func(time.Duration) O
+	endpointURL func(string) O
+	endpoint    func(string) O
+	insecure    func() O
+	tls         func(*tls.Config) O
+	headers     func(map[string]string) O
+	gzip        func() O
+}
+
+// otlpOptions 依 OTLPConfig 產生 exporter 的 Option；traces、metrics 與 logs 都走這裡。
+// endpoint 為 URL 時由 scheme 決定是否加密；host:port 時只有 Insecure 且沒有設定憑證才不加密
+func otlpOptions[O any](o OTLPConfig, signalPath string, set otlpOptionSet[O]) ([]O, error) {
+	tc, err := o.tlsConfig()
+	if err != nil {
+		return nil, fmt.Errorf("otlp tls: %w", err)
+	}
+
+	opts := []O{set.timeout(o.Timeout)}
+	if u, ok := o.endpointURL(signalPath); ok {
+		opts = append(opts, set.endpointURL(u))
+	} else {
+		opts = append(opts, set.endpoint(o.Endpoint))
+		if o.Insecure && tc == nil {
+			opts = append(opts, set.insecure())
+		}
+	}
+	if tc != nil {
+		opts = append(opts, set.tls(tc))
+	}
+	if len(o.Headers) > 0 {
+		opts = append(opts, set.headers(o.Headers))
+	}
+	if o.Compression == "gzip" {
+		opts = append(opts, set.gzip())
+	}
+	return opts, nil
+}
+
+// newTraceExporter 依設定建立 exporter；none 時回傳 nil。
+// OTLP exporter 建立時不會連線，collector 不存在也不會卡住啟動
+func newTraceExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case ExporterNone:
+		return nil, nil
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	}
+
+	o := cfg.OTLP.forSignal(cfg.OTLP.TracesEndpoint)
+	if o.Protocol == ProtocolGRPC {
+		opts, err := otlpOptions(o, "", otlpOptionSet[otlptracegrpc.Option]{
+			timeout:     otlptracegrpc.WithTimeout,
+			endpointURL: otlptracegrpc.WithEndpointURL,
+			endpoint:    otlptracegrpc.WithEndpoint,
+			insecure:    otlptracegrpc.WithInsecure,
+			tls: func(tc *tls.Config) otlptracegrpc.Option {
+				return otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tc))
+			},
+			headers: otlptracegrpc.WithHeaders,
+			gzip:    func() otlptracegrpc.Option { return otlptracegrpc.WithCompressor("gzip") },
+		})
+		if err != nil {
+			return nil, err
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	}
+
+	opts, err := otlpOptions(o, "/v1/traces", otlpOptionSet[otlptracehttp.Option]{
+		timeout:     otlptracehttp.WithTimeout,
+		endpointURL: otlptracehttp.WithEndpointURL,
+		endpoint:    otlptracehttp.WithEndpoint,
+		insecure:    otlptracehttp.WithInsecure,
+		tls:         otlptracehttp.WithTLSClientConfig,
+		headers:     otlptracehttp.WithHeaders,
+		gzip:        func() otlptracehttp.Option { return otlptracehttp.WithCompression(otlptracehttp.GzipCompression) },
+	})
+	if err != nil {
+		return nil, err
+	}
+	return otlptracehttp.New(ctx, opts...)
+}
@@ -0,0 +1,237 @@
+package telemetry
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordSet 把每個 Option 記成字串，方便比對
+var recordSet = otlpOptionSet[string]{
+	timeout:     func(d time.Duration) string { return "timeout=" + d.String() },
+	endpointURL: func(u string) string { return "url=" + u },
+	endpoint:    func(e string) string { return "endpoint=" + e },
+	insecure:    func() string { return "insecure" },
+	tls:         func(*tls.Config) string { return "tls" },
+	headers:     func(h map[string]string) string { return fmt.Sprintf("headers=%d", len(h)) },
+	gzip:        func() string { return "gzip" },
+}
+
+func writeCA(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewTLSServer(nil)
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "ca.crt")
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOTLPOptions(t *testing.T) {
+	ca := writeCA(t)
+	tests := []struct {
+		name string
+		cfg  OTLPConfig
+		path string
+		want string
+	}{
+		{
+			name: "host:port defaults to TLS",
+			cfg:  OTLPConfig{Endpoint: "collector:4317", Timeout: time.Second},
+			want: "timeout=1s endpoint=collector:4317",
+		},
+		{
+			name: "host:port insecure",
+			cfg:  OTLPConfig{Endpoint: "collector:4317", Insecure: true, Timeout: time.Second},
+			want: "timeout=1s endpoint=collector:4317 insecure",
+		},
+		{
+			name: "certificate wins over insecure",
+			cfg:  OTLPConfig{Endpoint: "collector:4317", Insecure: true, Certificate: ca, Timeout: time.Second},
+			want: "timeout=1s endpoint=collector:4317 tls",
+		},
+		{
+			name: "http url gets the signal path",
+			cfg:  OTLPConfig{Protocol: ProtocolHTTP, Endpoint: "http://collector:4318", Insecure: true, Timeout: time.Second},
+			path: "/v1/traces",
+			want: "timeout=1s url=http://collector:4318/v1/traces",
+		},
+		{
+			name: "base path gets the signal path appended",
+			cfg:  OTLPConfig{Protocol: ProtocolHTTP, Endpoint: "http://gw/otlp/", Timeout: time.Second},
+			path: "/v1/traces",
+			want: "timeout=1s url=http://gw/otlp/v1/traces",
+		},
+		{
+			name: "signal endpoint is used as given",
+			cfg:  OTLPConfig{Protocol: ProtocolHTTP, Endpoint: "http://gw/otlp", Timeout: time.Second}.forSignal("http://traces:4318/custom"),
+			path: "/v1/traces",
+			want: "timeout=1s url=http://traces:4318/custom",
+		},
+		{
+			name: "signal endpoint without a path is not extended",
+			cfg:  OTLPConfig{Protocol: ProtocolHTTP, Endpoint: "http://gw/otlp", Timeout: time.Second}.forSignal("http://metrics:4318"),
+			path: "/v1/metrics",
+			want: "timeout=1s url=http://metrics:4318",
+		},
+		{
+			name: "empty signal endpoint falls back to the base",
+			cfg:  OTLPConfig{Protocol: ProtocolHTTP, Endpoint: "http://gw/otlp", Timeout: time.Second}.forSignal(""),
+			path: "/v1/logs",
+			want: "timeout=1s url=http://gw/otlp/v1/logs",
+		},
+		{
+			name: "headers and gzip",
+			cfg:  OTLPConfig{Protocol: ProtocolHTTP, Endpoint: "https://collector", Headers: map[string]string{"a": "b"}, Compression: "gzip", Timeout: time.Second},
+			path: "/v1/logs",
+			want: "timeout=1s url=https://collector/v1/logs headers=1 gzip",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := otlpOptions(tt.cfg, tt.path, recordSet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(opts, " "); got != tt.want {
+				t.Fatalf("options = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOTLPOptionsBadCertificate(t *testing.T) {
+	cfg := OTLPConfig{Endpoint: "collector:4317", Certificate: filepath.Join(t.TempDir(), "missing.crt")}
+	if _, err := otlpOptions(cfg, "", recordSet); err == nil {
+		t.Fatal("expected an error for a missing CA bundle")
+	}
+}
+
+// otelEnv 是 LoadConfig 會讀取的環境變數；測試前全部清空，避免受執行環境影響
+var otelEnv = []string{
+	"OTEL_SERVICE_NAME", "OTEL_TRACES_EXPORTER", "OTEL_LOGS_EXPORTER", "OTEL_METRICS_EXPORTER", "OTEL_METRIC_EXPORT_INTERVAL", "METRICS_ADDR",
+	"OTEL_TRACES_SAMPLER", "OTEL_TRACES_SAMPLER_ARG", "TRACES_SAMPLE_RATE_LIMIT",
+	"OTEL_EXPORTER_OTLP_PROTOCOL", "OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT",
+	"OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", "OTEL_EXPORTER_OTLP_LOGS_ENDPOINT", "OTEL_EXPORTER_OTLP_INSECURE",
+	"OTEL_EXPORTER_OTLP_HEADERS", "OTEL_EXPORTER_OTLP_CERTIFICATE", "OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE",
+	"OTEL_EXPORTER_OTLP_CLIENT_KEY", "OTEL_EXPORTER_OTLP_COMPRESSION", "OTEL_EXPORTER_OTLP_TIMEOUT",
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "telemetry.yaml")
+	yaml := `
+service_name: from-file
+exporter: stdout
+otlp:
+  protocol: grpc
+  endpoint: collector:4317
+  insecure: true
+  timeout: 3s
+sampling:
+  sampler: traceidratio
+  ratio: 0.5
+logs:
+  exporter: otlp
+`
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		env     map[string]string
+		check   func(Config) string // 回傳不符合的說明，空字串表示通過
+		wantErr string
+	}{
+		{
+			name: "defaults without a file",
+			path: filepath.Join(t.TempDir(), "missing.yaml"),
+			check: func(c Config) string {
+				if c.ServiceName != "web-server-in-go" || c.Exporter != ExporterOTLP || c.OTLP.Protocol != ProtocolHTTP ||
+					c.OTLP.Endpoint != "http://localhost:4318" || c.OTLP.Insecure || c.Logs.Exporter != ExporterNone ||
+					c.OTLP.Timeout != 10*time.Second || !c.Metrics.OTLP || !c.Metrics.Prometheus {
+					return fmt.Sprintf("%+v", c)
+				}
+				return ""
+			},
+		},
+		{
+			name: "file overrides defaults",
+			path: path,
+			check: func(c Config) string {
+				if c.ServiceName != "from-file" || c.Exporter != ExporterStdout || c.OTLP.Protocol != ProtocolGRPC ||
+					c.OTLP.Endpoint != "collector:4317" || !c.OTLP.Insecure || c.OTLP.Timeout != 3*time.Second ||
+					c.Sampling.Sampler != SamplerRatio || c.Sampling.Ratio != 0.5 || c.Logs.Exporter != ExporterOTLP {
+					return fmt.Sprintf("%+v", c)
+				}
+				// 檔案沒寫的欄位保留預設值
+				if c.Metrics.AdminAddr != ":9464" || len(c.Sampling.Rules) != len(defaultSampling().Rules) {
+					return fmt.Sprintf("defaults lost: %+v", c)
+				}
+				return ""
+			},
+		},
+		{
+			name: "env overrides file",
+			path: path,
+			env: map[string]string{
+				"OTEL_SERVICE_NAME": "from-env", "OTEL_TRACES_EXPORTER": "console", "OTEL_LOGS_EXPORTER": "none",
+				"OTEL_EXPORTER_OTLP_PROTOCOL": "http/protobuf", "OTEL_EXPORTER_OTLP_ENDPOINT": "https://otel.example.com",
+				"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "https://traces.example.com", "OTEL_EXPORTER_OTLP_INSECURE": "false",
+				"OTEL_EXPORTER_OTLP_HEADERS": "Authorization=Bearer%20abc", "OTEL_EXPORTER_OTLP_TIMEOUT": "1500",
+				"OTEL_TRACES_SAMPLER": "ALWAYS_OFF", "OTEL_METRICS_EXPORTER": "prometheus", "OTEL_METRIC_EXPORT_INTERVAL": "5000",
+			},
+			check: func(c Config) string {
+				if c.ServiceName != "from-env" || c.Exporter != ExporterStdout || c.Logs.Exporter != ExporterNone ||
+					c.OTLP.Protocol != ProtocolHTTP || c.OTLP.Endpoint != "https://otel.example.com" ||
+					c.OTLP.TracesEndpoint != "https://traces.example.com" || c.OTLP.Insecure ||
+					c.OTLP.Headers["Authorization"] != "Bearer abc" || c.OTLP.Timeout != 1500*time.Millisecond ||
+					c.Sampling.Sampler != SamplerAlwaysOff || c.Metrics.OTLP || !c.Metrics.Prometheus ||
+					c.Metrics.Interval != 5*time.Second {
+					return fmt.Sprintf("%+v", c)
+				}
+				return ""
+			},
+		},
+		{name: "bad insecure", path: path, env: map[string]string{"OTEL_EXPORTER_OTLP_INSECURE": "maybe"}, wantErr: "OTEL_EXPORTER_OTLP_INSECURE"},
+		{name: "bad timeout", path: path, env: map[string]string{"OTEL_EXPORTER_OTLP_TIMEOUT": "5s"}, wantErr: "OTEL_EXPORTER_OTLP_TIMEOUT"},
+		{name: "bad headers", path: path, env: map[string]string{"OTEL_EXPORTER_OTLP_HEADERS": "novalue"}, wantErr: "OTEL_EXPORTER_OTLP_HEADERS"},
+		{name: "unknown metrics exporter", path: path, env: map[string]string{"OTEL_METRICS_EXPORTER": "statsd"}, wantErr: "OTEL_METRICS_EXPORTER"},
+		{name: "unknown traces exporter", path: path, env: map[string]string{"OTEL_TRACES_EXPORTER": "zipkin"}, wantErr: "unknown exporter"},
+		{name: "unknown logs exporter", path: path, env: map[string]string{"OTEL_LOGS_EXPORTER": "file"}, wantErr: "unknown logs exporter"},
+		{name: "bad protocol", path: path, env: map[string]string{"OTEL_EXPORTER_OTLP_PROTOCOL": "http/json"}, wantErr: "unsupported OTLP protocol"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, k := range otelEnv {
+				t.Setenv(k, "")
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			cfg, err := LoadConfig(tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if msg := tt.check(cfg); msg != "" {
+				t.Fatalf("unexpected config: %s", msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package telemetry
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// GinMetrics 記錄每個 route 的 RED metrics（OTel HTTP semantic conventions）：
+// http.server.request.duration 的 count 即為請求數，依 http.response.status_code 可算出錯誤率；
+// 5xx 另外帶 error.type，方便直接篩選
+func GinMetrics() gin.HandlerFunc {
+	meter := otel.Meter("web-server-in-go/http")
+	duration, _ := meter.Float64Histogram("http.server.request.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of HTTP server requests."),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10),
+	)
+	active, _ := meter.Int64UpDownCounter("http.server.active_requests",
+		metric.WithUnit("{request}"),
+		metric.WithDescription("Number of active HTTP server requests."),
+	)
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		method := attribute.String("http.request.method", c.Request.Method)
+		active.Add(c.Request.Context(), 1, metric.WithAttributes(method))
+
+		c.Next()
+
+		// 沒有對應 route 時不用原始 path，避免 cardinality 爆炸
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := c.Writer.Status()
+		attrs := []attribute.KeyValue{
+			method,
+			attribute.String("http.route", route),
+			attribute.Int("http.response.status_code", status),
+		}
+		if status >= 500 {
+			attrs = append(attrs, attribute.String("error.type", strconv.Itoa(status)))
+		}
+		duration.Record(c.Request.Context(), time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+		active.Add(c.Request.Context(), -1, metric.WithAttributes(method))
+	}
+}
@@ -0,0 +1,75 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	"go.opentelemetry.io/otel/log/global"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"google.golang.org/grpc/credentials"
+)
+
+// LogsConfig 決定 logger 的內容是否另外經由 OTel LoggerProvider 送出；檔案輸出（LOG_FILE）不受影響
+type LogsConfig struct {
+	Exporter string `yaml:"exporter"` // otlp | stdout | none（OTEL_LOGS_EXPORTER），預設 none
+}
+
+// initLogs 在 exporter 不是 none 時建立 LoggerProvider 並設為 global，logger 套件會把每一筆 log 送過去；
+// record 帶有 resource 與 ctx 中 span 的 trace context
+func initLogs(ctx context.Context, cfg Config, res *resource.Resource) (func(context.Context) error, error) {
+	if cfg.Logs.Exporter == ExporterNone {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exp, err := newLogExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	lp := sdklog.NewLoggerProvider(
+		sdklog.WithResource(res),
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exp)),
+	)
+	global.SetLoggerProvider(lp)
+	return lp.Shutdown, nil
+}
+
+func newLogExporter(ctx context.Context, cfg Config) (sdklog.Exporter, error) {
+	if cfg.Logs.Exporter == ExporterStdout {
+		return stdoutlog.New()
+	}
+
+	o := cfg.OTLP.forSignal(cfg.OTLP.LogsEndpoint)
+	if o.Protocol == ProtocolGRPC {
+		opts, err := otlpOptions(o, "", otlpOptionSet[otlploggrpc.Option]{
+			timeout:     otlploggrpc.WithTimeout,
+			endpointURL: otlploggrpc.WithEndpointURL,
+			endpoint:    otlploggrpc.WithEndpoint,
+			insecure:    otlploggrpc.WithInsecure,
+			tls:         func(tc *tls.Config) otlploggrpc.Option { return otlploggrpc.WithTLSCredentials(credentials.NewTLS(tc)) },
+			headers:     otlploggrpc.WithHeaders,
+			gzip:        func() otlploggrpc.Option { return otlploggrpc.WithCompressor("gzip") },
+		})
+		if err != nil {
+			return nil, err
+		}
+		return otlploggrpc.New(ctx, opts...)
+	}
+
+	opts, err := otlpOptions(o, "/v1/logs", otlpOptionSet[otlploghttp.Option]{
+		timeout:     otlploghttp.WithTimeout,
+		endpointURL: otlploghttp.WithEndpointURL,
+		endpoint:    otlploghttp.WithEndpoint,
+		insecure:    otlploghttp.WithInsecure,
+		tls:         otlploghttp.WithTLSClientConfig,
+		headers:     otlploghttp.WithHeaders,
+		gzip:        func() otlploghttp.Option { return otlploghttp.WithCompression(otlploghttp.GzipCompression) },
+	})
+	if err != nil {
+		return nil, err
+	}
+	return otlploghttp.New(ctx, opts...)
+}
@@ -0,0 +1,126 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"google.golang.org/grpc/credentials"
+)
+
+// MetricsConfig 決定 metrics 的輸出方式，兩者可同時啟用
+type MetricsConfig struct {
+	OTLP       bool          `yaml:"otlp"`       // 以 OTLP 定期推送（與 traces 共用 otlp 設定）
+	Prometheus bool          `yaml:"prometheus"` // 在 AdminAddr 提供 /metrics 給 Prometheus 抓取
+	AdminAddr  string        `yaml:"admin_addr"` // 與服務分開的 port，避免 /metrics 對外公開
+	Interval   time.Duration `yaml:"interval"`   // OTLP 推送間隔
+}
+
+// initMetrics 建立 MeterProvider 並設為 global，同時開始收集 Go runtime metrics；
+// 回傳的 shutdown 會停止 admin server 並送出最後一批 metrics
+func initMetrics(ctx context.Context, cfg Config, res *resource.Resource) (func(context.Context) error, error) {
+	opts := []sdkmetric.Option{sdkmetric.WithResource(res)}
+	m := cfg.Metrics
+
+	if m.OTLP {
+		exp, err := newMetricExporter(ctx, cfg.OTLP.forSignal(cfg.OTLP.MetricsEndpoint))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exp, sdkmetric.WithInterval(m.Interval))))
+	}
+
+	var admin *http.Server
+	if m.Prometheus {
+		// 使用獨立的 registry，只輸出 OTel 與 process collector 的資料（Go runtime 由 OTel runtime metrics 提供）
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+		exp, err := otelprom.New(otelprom.WithRegisterer(reg))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, sdkmetric.WithReader(exp))
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+		admin = &http.Server{Addr: m.AdminAddr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	}
+
+	mp := sdkmetric.NewMeterProvider(opts...)
+	otel.SetMeterProvider(mp)
+	if err := runtime.Start(runtime.WithMeterProvider(mp)); err != nil {
+		_ = mp.Shutdown(ctx)
+		return nil, err
+	}
+
+	if admin != nil {
+		// 先 Listen，port 被占用時直接回報錯誤
+		ln, err := net.Listen("tcp", admin.Addr)
+		if err != nil {
+			_ = mp.Shutdown(ctx)
+			return nil, fmt.Errorf("metrics admin listen: %w", err)
+		}
+		go func() {
+			if err := admin.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				otel.Handle(err)
+			}
+		}()
+	}
+
+	return func(ctx context.Context) error {
+		var errs []error
+		if admin != nil {
+			errs = append(errs, admin.Shutdown(ctx))
+		}
+		errs = append(errs, mp.Shutdown(ctx))
+		return errors.Join(errs...)
+	}, nil
+}
+
+func newMetricExporter(ctx context.Context, o OTLPConfig) (sdkmetric.Exporter, error) {
+	if o.Protocol == ProtocolGRPC {
+		opts, err := otlpOptions(o, "", otlpOptionSet[otlpmetricgrpc.Option]{
+			timeout:     otlpmetricgrpc.WithTimeout,
+			endpointURL: otlpmetricgrpc.WithEndpointURL,
+			endpoint:    otlpmetricgrpc.WithEndpoint,
+			insecure:    otlpmetricgrpc.WithInsecure,
+			tls: func(tc *tls.Config) otlpmetricgrpc.Option {
+				return otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(tc))
+			},
+			headers: otlpmetricgrpc.WithHeaders,
+			gzip:    func() otlpmetricgrpc.Option { return otlpmetricgrpc.WithCompressor("gzip") },
+		})
+		if err != nil {
+			return nil, err
+		}
+		return otlpmetricgrpc.New(ctx, opts...)
+	}
+
+	opts, err := otlpOptions(o, "/v1/metrics", otlpOptionSet[otlpmetrichttp.Option]{
+		timeout:     otlpmetrichttp.WithTimeout,
+		endpointURL: otlpmetrichttp.WithEndpointURL,
+		endpoint:    otlpmetrichttp.WithEndpoint,
+		insecure:    otlpmetrichttp.WithInsecure,
+		tls:         otlpmetrichttp.WithTLSClientConfig,
+		headers:     otlpmetrichttp.WithHeaders,
+		gzip:        func() otlpmetrichttp.Option { return otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression) },
+	})
+	if err != nil {
+		return nil, err
+	}
+	return otlpmetrichttp.New(ctx, opts...)
+}
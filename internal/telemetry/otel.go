@@ -2,57 +2,50 @@ package telemetry
 
 import (
 	"context"
+	"errors"
 
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 
 	"go.opentelemetry.io/otel/trace"
 )
 
 type Config struct {
-	ServiceName string // 必填：Tempo / Grafana 裡看到的 service 名稱
-	Endpoint    string // OTLP HTTP endpoint，例如 "otel-collector:4318"
-	Insecure    bool   // Collector 沒 TLS 的話設 true
+	ServiceName string         `yaml:"service_name"` // 必填：Tempo / Grafana 裡看到的 service 名稱
+	Exporter    string         `yaml:"exporter"`     // otlp | stdout | none
+	OTLP        OTLPConfig     `yaml:"otlp"`
+	Sampling    SamplingConfig `yaml:"sampling"`
+	Metrics     MetricsConfig  `yaml:"metrics"`
+	Logs        LogsConfig     `yaml:"logs"`
+	K8s         K8sResource    `yaml:"-"` // 執行環境提供，不由設定檔指定
 }
 
 var tracer trace.Tracer
 
 func Init(ctx context.Context, cfg Config) (func(context.Context) error, error) {
-	// 1) OTLP HTTP client
-	opts := []otlptracehttp.Option{
-		otlptracehttp.WithEndpoint(cfg.Endpoint),
-	}
-	if cfg.Insecure {
-		opts = append(opts, otlptracehttp.WithInsecure())
-	}
-
-	client := otlptracehttp.NewClient(opts...)
-	exporter, err := otlptrace.New(ctx, client)
+	// 1) Exporter（otlp grpc / http、stdout 或 none）
+	exporter, err := newTraceExporter(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	// 2) Resource (服務資訊)
-	res, err := resource.New(ctx,
-		resource.WithFromEnv(),
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String(cfg.ServiceName),
-		),
-	)
+	// 2) Resource（服務、建置、host / process / container 與 k8s 資訊）
+	res, err := newResource(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
 
 	// 3) TracerProvider
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
+	// none 時仍建立 TracerProvider，log 與稽核紀錄才有 trace id
+	tpOpts := []sdktrace.TracerProviderOption{
 		sdktrace.WithResource(res),
-	)
+		sdktrace.WithSampler(newSampler(cfg.Sampling)),
+	}
+	if exporter != nil {
+		tpOpts = append(tpOpts, sdktrace.WithBatcher(exporter))
+	}
+	tp := sdktrace.NewTracerProvider(tpOpts...)
 
 	// 4) 設為 global
 	otel.SetTracerProvider(tp)
@@ -66,7 +59,25 @@ func Init(ctx context.Context, cfg Config) (func(context.Context) error, error)
 	// 5) 準備一個預設 tracer
 	tracer = tp.Tracer(cfg.ServiceName + "/http")
 
-	return tp.Shutdown, nil
+	// 6) MeterProvider（OTLP / Prometheus）與 Go runtime metrics
+	shutdownMetrics, err := initMetrics(ctx, cfg, res)
+	if err != nil {
+		_ = tp.Shutdown(ctx)
+		return nil, err
+	}
+
+	// 7) LoggerProvider（OTEL_LOGS_EXPORTER），logger 的輸出另外以 OTLP 送出
+	shutdownLogs, err := initLogs(ctx, cfg, res)
+	if err != nil {
+		_ = shutdownMetrics(ctx)
+		_ = tp.Shutdown(ctx)
+		return nil, err
+	}
+
+	// 先停 metrics 與 logs 再停 traces，各自都會送出最後一批資料
+	return func(ctx context.Context) error {
+		return errors.Join(shutdownMetrics(ctx), shutdownLogs(ctx), tp.Shutdown(ctx))
+	}, nil
 }
 
 func Tracer() trace.Tracer {
@@ -0,0 +1,82 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"runtime"
+
+	"github.com/HarrisonZz/web_server_in_go/internal/buildinfo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// semconv v1.26 尚未定義 vcs.*，使用新版規範的 key
+const vcsRevisionKey = attribute.Key("vcs.ref.head.revision")
+
+// K8sResource 是 resource 中的 k8s.* 屬性，由 main 以 kubernetes.WorkloadFromEnv 填入；空字串的欄位不輸出
+type K8sResource struct {
+	Namespace string
+	Pod       string
+	PodUID    string
+	Node      string
+	Container string
+}
+
+// newResource 合併 OTEL_RESOURCE_ATTRIBUTES、host / os / process / container 偵測結果、k8s 與建置資訊，
+// 後面的優先；部分偵測失敗（例如不在 container 中）時仍使用已取得的屬性
+func newResource(ctx context.Context, cfg Config) (*resource.Resource, error) {
+	bi := buildinfo.Get()
+	attrs := []attribute.KeyValue{
+		semconv.ServiceNameKey.String(cfg.ServiceName),
+		semconv.ServiceVersionKey.String(bi.Version),
+		hostArch(),
+	}
+	if bi.Commit != "" {
+		attrs = append(attrs, vcsRevisionKey.String(bi.Commit))
+	}
+	for k, v := range map[attribute.Key]string{
+		semconv.K8SNamespaceNameKey: cfg.K8s.Namespace,
+		semconv.K8SPodNameKey:       cfg.K8s.Pod,
+		semconv.K8SPodUIDKey:        cfg.K8s.PodUID,
+		semconv.K8SNodeNameKey:      cfg.K8s.Node,
+		semconv.K8SContainerNameKey: cfg.K8s.Container,
+	} {
+		if v != "" {
+			attrs = append(attrs, k.String(v))
+		}
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithOS(),
+		// 不含 command args 與 owner，避免把參數中的密碼送出去
+		resource.WithProcessPID(),
+		resource.WithProcessExecutableName(),
+		resource.WithProcessRuntimeName(),
+		resource.WithProcessRuntimeVersion(),
+		resource.WithContainer(),
+		resource.WithAttributes(attrs...),
+	)
+	if errors.Is(err, resource.ErrPartialResource) {
+		otel.Handle(err)
+		return res, nil
+	}
+	return res, err
+}
+
+// hostArch 把 GOARCH 轉成 semconv 的 host.arch 值
+func hostArch() attribute.KeyValue {
+	switch runtime.GOARCH {
+	case "arm":
+		return semconv.HostArchARM32
+	case "386":
+		return semconv.HostArchX86
+	case "ppc64", "ppc64le":
+		return semconv.HostArchPPC64
+	}
+	return semconv.HostArchKey.String(runtime.GOARCH)
+}
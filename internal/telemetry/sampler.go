@@ -0,0 +1,232 @@
+package telemetry
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+// OTEL_TRACES_SAMPLER 支援的值
+const (
+	SamplerAlwaysOn        = "always_on"
+	SamplerAlwaysOff       = "always_off"
+	SamplerRatio           = "traceidratio"
+	SamplerParentAlwaysOn  = "parentbased_always_on"
+	SamplerParentAlwaysOff = "parentbased_always_off"
+	SamplerParentRatio     = "parentbased_traceidratio"
+
+	parentBasedPrefix = "parentbased_"
+)
+
+// rule 的決定
+const (
+	SampleAlways = "always" // 一定取樣，不受 ratio 與限流影響
+	SampleNever  = "never"  // 一定丟棄
+	SampleRatio  = "ratio"  // 以 rule 的 ratio 取樣，仍受限流
+)
+
+// SamplingConfig 決定 root span 的取樣方式；本地的子 span 一律依 parent，上游傳來的 parent 只在 parentbased_* 時採用
+type SamplingConfig struct {
+	Sampler   string         `yaml:"sampler"`    // OTEL_TRACES_SAMPLER
+	Ratio     float64        `yaml:"ratio"`      // OTEL_TRACES_SAMPLER_ARG，traceidratio 系列使用
+	RateLimit float64        `yaml:"rate_limit"` // 每秒最多取樣幾個 trace，0 表示不限（TRACES_SAMPLE_RATE_LIMIT）
+	Rules     []SamplingRule `yaml:"rules"`      // 依序比對，第一個符合的生效
+}
+
+// SamplingRule 依 route（http.route）與 method 覆蓋預設的取樣決定，只套用在 server span（root 或 remote parent）；
+// route 結尾的 * 表示前綴比對
+type SamplingRule struct {
+	Route  string  `yaml:"route"`
+	Method string  `yaml:"method"` // 空字串表示任何 method
+	Sample string  `yaml:"sample"` // always | never | ratio
+	Ratio  float64 `yaml:"ratio"`
+}
+
+// defaultSampling：kube-probe 不取樣，改變 LED 的請求一定取樣
+func defaultSampling() SamplingConfig {
+	return SamplingConfig{
+		Sampler: SamplerParentAlwaysOn,
+		Ratio:   1,
+		Rules: []SamplingRule{
+			{Route: "/healthz", Sample: SampleNever},
+			{Route: "/readyz", Sample: SampleNever},
+			{Route: "/led", Method: "POST", Sample: SampleAlways},
+		},
+	}
+}
+
+func (s *SamplingConfig) applyEnv() error {
+	if v := os.Getenv("OTEL_TRACES_SAMPLER"); v != "" {
+		s.Sampler = strings.ToLower(v)
+	}
+	if v := os.Getenv("OTEL_TRACES_SAMPLER_ARG"); v != "" {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("OTEL_TRACES_SAMPLER_ARG: %w", err)
+		}
+		s.Ratio = r
+	}
+	if v := os.Getenv("TRACES_SAMPLE_RATE_LIMIT"); v != "" {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("TRACES_SAMPLE_RATE_LIMIT: %w", err)
+		}
+		s.RateLimit = r
+	}
+	return nil
+}
+
+func (s SamplingConfig) validate() error {
+	switch s.Sampler {
+	case SamplerAlwaysOn, SamplerAlwaysOff, SamplerRatio,
+		SamplerParentAlwaysOn, SamplerParentAlwaysOff, SamplerParentRatio:
+	default:
+		return fmt.Errorf("unsupported sampler %q", s.Sampler)
+	}
+	if s.Ratio < 0 || s.Ratio > 1 {
+		return fmt.Errorf("sampler ratio %v must be between 0 and 1", s.Ratio)
+	}
+	if s.RateLimit < 0 {
+		return fmt.Errorf("sampler rate limit %v must be >= 0", s.RateLimit)
+	}
+	for i, r := range s.Rules {
+		if r.Route == "" {
+			return fmt.Errorf("sampling rule %d: route is required", i)
+		}
+		switch r.Sample {
+		case SampleAlways, SampleNever:
+		case SampleRatio:
+			if r.Ratio < 0 || r.Ratio > 1 {
+				return fmt.Errorf("sampling rule %d: ratio %v must be between 0 and 1", i, r.Ratio)
+			}
+		default:
+			return fmt.Errorf("sampling rule %d: sample must be always, never or ratio", i)
+		}
+	}
+	return nil
+}
+
+// newSampler 組出 ParentBased(rules → 基本取樣 → 限流)。同一個 process 內的子 span（例如 GinChildSpan）
+// 沒有 http.route，一律沿用 parent 的決定；非 parentbased_* 時只有來自上游（remote）的 parent 會被忽略，
+// 改以 rules 重新決定
+func newSampler(cfg SamplingConfig) sdktrace.Sampler {
+	base := strings.TrimPrefix(cfg.Sampler, parentBasedPrefix)
+	var root sdktrace.Sampler
+	switch base {
+	case SamplerAlwaysOff:
+		root = sdktrace.NeverSample()
+	case SamplerRatio:
+		root = sdktrace.TraceIDRatioBased(cfg.Ratio)
+	default:
+		root = sdktrace.AlwaysSample()
+	}
+
+	rs := &ruleSampler{base: root}
+	for _, r := range cfg.Rules {
+		cr := compiledRule{SamplingRule: r, method: strings.ToUpper(r.Method)}
+		cr.route, cr.prefix = strings.CutSuffix(r.Route, "*")
+		if r.Sample == SampleRatio {
+			cr.sampler = sdktrace.TraceIDRatioBased(r.Ratio)
+		}
+		rs.rules = append(rs.rules, cr)
+	}
+	if cfg.RateLimit > 0 {
+		rs.limiter = rate.NewLimiter(rate.Limit(cfg.RateLimit), int(math.Max(1, math.Ceil(cfg.RateLimit))))
+	}
+
+	if strings.HasPrefix(cfg.Sampler, parentBasedPrefix) {
+		return sdktrace.ParentBased(rs)
+	}
+	return sdktrace.ParentBased(rs,
+		sdktrace.WithRemoteParentSampled(rs),
+		sdktrace.WithRemoteParentNotSampled(rs),
+	)
+}
+
+type compiledRule struct {
+	SamplingRule
+	route   string
+	prefix  bool
+	method  string
+	sampler sdktrace.Sampler
+}
+
+func (r compiledRule) match(route, method string) bool {
+	if r.method != "" && r.method != method {
+		return false
+	}
+	if r.prefix {
+		return strings.HasPrefix(route, r.route)
+	}
+	return route == r.route
+}
+
+// ruleSampler 依 span 開始時的 http.route / http.request.method（otelgin 設定）套用 rules
+type ruleSampler struct {
+	rules   []compiledRule
+	base    sdktrace.Sampler
+	limiter *rate.Limiter
+}
+
+func (s *ruleSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	var route, method string
+	for _, a := range p.Attributes {
+		switch a.Key {
+		case "http.route":
+			route = a.Value.AsString()
+		case "http.request.method", "http.method":
+			method = a.Value.AsString()
+		}
+	}
+
+	sampler := s.base
+	if r, ok := s.match(route, method); ok {
+		switch r.Sample {
+		case SampleAlways:
+			return s.result(p, sdktrace.RecordAndSample)
+		case SampleNever:
+			return s.result(p, sdktrace.Drop)
+		}
+		sampler = r.sampler
+	}
+
+	res := sampler.ShouldSample(p)
+	if res.Decision == sdktrace.RecordAndSample && s.limiter != nil && !s.limiter.Allow() {
+		return s.result(p, sdktrace.Drop)
+	}
+	return res
+}
+
+// match 回傳第一個符合的 rule；沒有 route（非 HTTP 的 root span）時不套用 rules
+func (s *ruleSampler) match(route, method string) (compiledRule, bool) {
+	if route == "" {
+		return compiledRule{}, false
+	}
+	for _, r := range s.rules {
+		if r.match(route, method) {
+			return r, true
+		}
+	}
+	return compiledRule{}, false
+}
+
+func (s *ruleSampler) result(p sdktrace.SamplingParameters, d sdktrace.SamplingDecision) sdktrace.SamplingResult {
+	return sdktrace.SamplingResult{
+		Decision:   d,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (s *ruleSampler) Description() string {
+	desc := fmt.Sprintf("RuleSampler{rules=%d,base=%s", len(s.rules), s.base.Description())
+	if s.limiter != nil {
+		desc += fmt.Sprintf(",rate_limit=%v", float64(s.limiter.Limit()))
+	}
+	return desc + "}"
+}
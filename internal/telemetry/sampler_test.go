@@ -0,0 +1,172 @@
+package telemetry
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSamplingConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     SamplingConfig
+		wantErr string
+	}{
+		{name: "default", cfg: defaultSampling()},
+		{name: "ratio rule", cfg: SamplingConfig{Sampler: SamplerRatio, Ratio: 0.5, Rules: []SamplingRule{{Route: "/api/*", Sample: SampleRatio, Ratio: 0.1}}}},
+		{name: "unknown sampler", cfg: SamplingConfig{Sampler: "jaeger_remote"}, wantErr: "unsupported sampler"},
+		{name: "ratio above 1", cfg: SamplingConfig{Sampler: SamplerRatio, Ratio: 1.5}, wantErr: "between 0 and 1"},
+		{name: "negative ratio", cfg: SamplingConfig{Sampler: SamplerRatio, Ratio: -0.1}, wantErr: "between 0 and 1"},
+		{name: "negative rate limit", cfg: SamplingConfig{Sampler: SamplerAlwaysOn, RateLimit: -1}, wantErr: "rate limit"},
+		{name: "rule without route", cfg: SamplingConfig{Sampler: SamplerAlwaysOn, Rules: []SamplingRule{{Sample: SampleNever}}}, wantErr: "route is required"},
+		{name: "rule with bad sample", cfg: SamplingConfig{Sampler: SamplerAlwaysOn, Rules: []SamplingRule{{Route: "/x", Sample: "sometimes"}}}, wantErr: "sample must be"},
+		{name: "rule ratio above 1", cfg: SamplingConfig{Sampler: SamplerAlwaysOn, Rules: []SamplingRule{{Route: "/x", Sample: SampleRatio, Ratio: 2}}}, wantErr: "rule 0: ratio"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func samplingParams(parent context.Context, route, method string) sdktrace.SamplingParameters {
+	var attrs []attribute.KeyValue
+	if route != "" {
+		attrs = append(attrs, attribute.String("http.route", route))
+	}
+	if method != "" {
+		attrs = append(attrs, attribute.String("http.request.method", method))
+	}
+	return sdktrace.SamplingParameters{
+		ParentContext: parent,
+		TraceID:       trace.TraceID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10},
+		Name:          "GET " + route,
+		Kind:          trace.SpanKindServer,
+		Attributes:    attrs,
+	}
+}
+
+func TestRuleSampler(t *testing.T) {
+	rules := []SamplingRule{
+		{Route: "/healthz", Sample: SampleNever},
+		{Route: "/led", Method: "post", Sample: SampleAlways},
+		{Route: "/devices/*", Sample: SampleRatio, Ratio: 0},
+	}
+	sampledParent := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0xaa},
+		SpanID:     trace.SpanID{0xbb},
+		TraceFlags: trace.FlagsSampled,
+	}))
+	remoteParent := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0xaa},
+		SpanID:     trace.SpanID{0xbb},
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	tests := []struct {
+		name    string
+		sampler string
+		limit   float64
+		parent  context.Context
+		route   string
+		method  string
+		calls   int
+		want    int // 取樣的次數
+	}{
+		{name: "no rule uses base", sampler: SamplerAlwaysOn, route: "/ping", calls: 1, want: 1},
+		{name: "base always_off", sampler: SamplerAlwaysOff, route: "/ping", calls: 1, want: 0},
+		{name: "never rule", sampler: SamplerAlwaysOn, route: "/healthz", calls: 1, want: 0},
+		{name: "always rule beats always_off", sampler: SamplerAlwaysOff, route: "/led", method: "POST", calls: 1, want: 1},
+		{name: "method must match", sampler: SamplerAlwaysOff, route: "/led", method: "GET", calls: 1, want: 0},
+		{name: "prefix rule with ratio 0", sampler: SamplerAlwaysOn, route: "/devices/:name/registers", calls: 1, want: 0},
+		{name: "no route skips rules", sampler: SamplerAlwaysOff, calls: 1, want: 0},
+		{name: "rate limit", sampler: SamplerAlwaysOn, limit: 1, route: "/ping", calls: 5, want: 1},
+		{name: "always rule ignores rate limit", sampler: SamplerAlwaysOn, limit: 1, route: "/led", method: "POST", calls: 5, want: 5},
+		{name: "parentbased follows sampled parent", sampler: SamplerParentAlwaysOff, parent: sampledParent, route: "/healthz", calls: 1, want: 1},
+		{name: "parentbased follows remote parent", sampler: SamplerParentAlwaysOn, parent: remoteParent, route: "/healthz", calls: 1, want: 1},
+		{name: "non parentbased local child follows parent", sampler: SamplerAlwaysOn, parent: sampledParent, route: "/healthz", calls: 1, want: 1},
+		{name: "non parentbased applies rules to remote parent", sampler: SamplerAlwaysOn, parent: remoteParent, route: "/healthz", calls: 1, want: 0},
+		{name: "local child ignores rate limit", sampler: SamplerAlwaysOn, limit: 1, parent: sampledParent, route: "/ping", calls: 5, want: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSampler(SamplingConfig{Sampler: tt.sampler, Ratio: 1, RateLimit: tt.limit, Rules: rules})
+			parent := tt.parent
+			if parent == nil {
+				parent = context.Background()
+			}
+			got := 0
+			for i := 0; i < tt.calls; i++ {
+				if s.ShouldSample(samplingParams(parent, tt.route, tt.method)).Decision == sdktrace.RecordAndSample {
+					got++
+				}
+			}
+			if got != tt.want {
+				t.Fatalf("sampled %d of %d, want %d", got, tt.calls, tt.want)
+			}
+		})
+	}
+}
+
+// TestChildSpans 以真正的 TracerProvider 建立 root 與沒有 http.route 的子 span（如 GinChildSpan）
+func TestChildSpans(t *testing.T) {
+	tests := []struct {
+		name        string
+		sampler     string
+		route       string
+		wantRoot    bool
+		wantSampled int // 5 個子 span 中取樣的數量
+	}{
+		{name: "dropped root drops children", sampler: SamplerAlwaysOn, route: "/healthz", wantRoot: false, wantSampled: 0},
+		{name: "parentbased dropped root drops children", sampler: SamplerParentAlwaysOn, route: "/healthz", wantRoot: false, wantSampled: 0},
+		{name: "sampled root keeps children within the rate limit", sampler: SamplerAlwaysOn, route: "/ping", wantRoot: true, wantSampled: 5},
+		{name: "always_off root with always rule", sampler: SamplerAlwaysOff, route: "/led", wantRoot: true, wantSampled: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(newSampler(SamplingConfig{
+				Sampler:   tt.sampler,
+				Ratio:     1,
+				RateLimit: 1,
+				Rules: []SamplingRule{
+					{Route: "/healthz", Sample: SampleNever},
+					{Route: "/led", Sample: SampleAlways},
+				},
+			})))
+			t.Cleanup(func() { tp.Shutdown(context.Background()) })
+			tr := tp.Tracer("test")
+
+			ctx, root := tr.Start(context.Background(), "GET "+tt.route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(attribute.String("http.route", tt.route), attribute.String("http.request.method", "GET")))
+			defer root.End()
+			if got := root.SpanContext().IsSampled(); got != tt.wantRoot {
+				t.Fatalf("root sampled = %v, want %v", got, tt.wantRoot)
+			}
+			got := 0
+			for i := 0; i < 5; i++ {
+				_, child := tr.Start(ctx, "i2c.write")
+				if child.SpanContext().IsSampled() {
+					got++
+				}
+				child.End()
+			}
+			if got != tt.wantSampled {
+				t.Fatalf("sampled %d of 5 children, want %d", got, tt.wantSampled)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+// Package util 放多個 package 共用的小工具
+package util
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidSince 是 ParseSince 無法解析時回傳的錯誤，訊息可直接回給 client
+var ErrInvalidSince = errors.New("since must be RFC3339, a unix timestamp or a duration like 1h")
+
+// Getenv 回傳環境變數，未設定或為空字串時回傳 def
+func Getenv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// ParseSince 接受 RFC3339 時間、unix timestamp 或相對時間（例如 "15m" 表示 15 分鐘前）；空字串回傳零值
+func ParseSince(v string, now time.Time) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil && d > 0 {
+		return now.Add(-d), nil
+	}
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Time{}, ErrInvalidSince
+}
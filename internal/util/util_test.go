@@ -0,0 +1,46 @@
+package util
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "empty", in: "", want: time.Time{}},
+		{name: "rfc3339", in: "2024-01-01T10:30:00Z", want: time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)},
+		{name: "rfc3339 with offset", in: "2024-01-01T18:30:00+08:00", want: time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)},
+		{name: "duration", in: "15m", want: now.Add(-15 * time.Minute)},
+		{name: "compound duration", in: "1h30m", want: now.Add(-90 * time.Minute)},
+		{name: "unix timestamp", in: "1704067200", want: time.Unix(1704067200, 0)},
+		{name: "zero is a unix timestamp", in: "0", want: time.Unix(0, 0)},
+		{name: "negative duration", in: "-1h", wantErr: true},
+		{name: "date only", in: "2024-01-01", wantErr: true},
+		{name: "garbage", in: "yesterday", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSince(tt.in, now)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSince) {
+					t.Fatalf("err = %v, want ErrInvalidSince", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Fatalf("ParseSince(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
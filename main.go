@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	_ "embed"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
@@ -11,14 +14,26 @@ import (
 
 	"strconv"
 
+	"github.com/HarrisonZz/web_server_in_go/internal/audit"
+	"github.com/HarrisonZz/web_server_in_go/internal/buildinfo"
 	"github.com/HarrisonZz/web_server_in_go/internal/cache"
+	"github.com/HarrisonZz/web_server_in_go/internal/config"
 	"github.com/HarrisonZz/web_server_in_go/internal/deps"
+	"github.com/HarrisonZz/web_server_in_go/internal/handler"
 	"github.com/HarrisonZz/web_server_in_go/internal/i2cdevice"
+	"github.com/HarrisonZz/web_server_in_go/internal/kubernetes"
 	"github.com/HarrisonZz/web_server_in_go/internal/logger"
+	"github.com/HarrisonZz/web_server_in_go/internal/mqttbridge"
+	"github.com/HarrisonZz/web_server_in_go/internal/scheduler"
 	"github.com/HarrisonZz/web_server_in_go/internal/server"
 	"github.com/HarrisonZz/web_server_in_go/internal/telemetry"
 )
 
+// defaultRegisters 是隨程式發佈的 register map，I2C_REGISTER_MAP 指定的檔案不存在時使用
+//
+//go:embed config/registers.yaml
+var defaultRegisters []byte
+
 func getenv(key, def string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -29,11 +44,15 @@ func getenv(key, def string) string {
 func init() {
 
 	setlog()
-	i2cdevice.InitI2C()
+	i2cdevice.InitI2C(defaultRegisters)
 }
 
+// setlog 預設寫檔給 Fluent Bit 收；LOG_FILE=false 時不寫檔，經由 OTEL_LOGS_EXPORTER 送出（沒有時改寫 stderr，見 logToStderr）
 func setlog() {
 
+	if on, err := strconv.ParseBool(getenv("LOG_FILE", "true")); err == nil && !on {
+		return
+	}
 	logPath := os.Getenv("LOG_PATH")
 	if logPath == "" {
 		wd, err := os.Getwd()
@@ -49,7 +68,19 @@ func setlog() {
 	}
 }
 
+// logToStderr 在 LOG_FILE=false 又沒有 OTel logs 輸出（設定為 none 或 Init 失敗）時改寫 stderr，log 不會整個消失
+func logToStderr(tcfg telemetry.Config) {
+	if logger.Logger == nil && tcfg.Logs.Exporter == telemetry.ExporterNone {
+		logger.SetOutput(os.Stderr)
+	}
+}
+
+// kubeconfig 未指定時依序使用 KUBECONFIG、~/.kube/config
+var kubeconfig = flag.String("kubeconfig", "", "path to a kubeconfig file for running outside the cluster")
+
 func main() {
+	flag.Parse()
+	logger.SetLevel(config.Current().LogLevel)
 
 	port := getenv("PORT", "8080")
 
@@ -65,23 +96,137 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	// 1) 初始化 OTel
-	shutdown, err := telemetry.Init(ctx, telemetry.Config{
-		ServiceName: "web-server-in-go",
-		Endpoint:    "otel-collector-opentelemetry-collector.logging.svc.cluster.local:4318", // 之後接你的 Collector Service
-		Insecure:    true,                                                                    // Collector 沒 TLS 就 true
-	})
+	// 1) 初始化 OTel：設定檔（TELEMETRY_CONFIG）+ OTEL_* 環境變數；失敗時不匯出 trace / metrics / logs，服務照常啟動
+	tcfg, err := telemetry.LoadConfig(getenv("TELEMETRY_CONFIG", "config/telemetry.yaml"))
 	if err != nil {
-		logger.Error(fmt.Sprintf("failed to init telemetry: %v", err))
-		return
+		tcfg.Exporter, tcfg.Logs.Exporter, tcfg.Metrics.OTLP, tcfg.Metrics.Prometheus = telemetry.ExporterNone, telemetry.ExporterNone, false, false
+	}
+	logToStderr(tcfg)
+	if err != nil {
+		logger.Error(fmt.Sprintf("invalid telemetry config, exporters disabled: %v", err))
+	}
+	// resource 帶上 pod / node 身分，只用 Downward API，不必等 kubernetes.Start
+	kcfg := kubernetes.ConfigFromEnv()
+	kcfg.Kubeconfig = *kubeconfig
+	tcfg.K8s = telemetry.K8sResource(kubernetes.WorkloadFromEnv(kcfg))
+	shutdown, err := telemetry.Init(ctx, tcfg)
+	if err != nil {
+		tcfg.Exporter, tcfg.Logs.Exporter, tcfg.Metrics.OTLP, tcfg.Metrics.Prometheus = telemetry.ExporterNone, telemetry.ExporterNone, false, false
+		logToStderr(tcfg)
+		logger.Error(fmt.Sprintf("failed to init telemetry, exporters disabled: %v", err))
+		if shutdown, err = telemetry.Init(ctx, tcfg); err != nil {
+			logger.Error(fmt.Sprintf("failed to init telemetry: %v", err))
+			return
+		}
+	}
+	bi := buildinfo.Get()
+	logger.Info(fmt.Sprintf("version=%s commit=%s", bi.Version, bi.Commit))
+	logger.Info(fmt.Sprintf("telemetry exporter=%s protocol=%s endpoint=%s metrics_otlp=%t prometheus=%t admin=%s logs=%s",
+		tcfg.Exporter, tcfg.OTLP.Protocol, tcfg.OTLP.Endpoint, tcfg.Metrics.OTLP, tcfg.Metrics.Prometheus, tcfg.Metrics.AdminAddr, tcfg.Logs.Exporter))
+	defer func() {
+		sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(sctx); err != nil {
+			logger.Error(fmt.Sprintf("otel shutdown error: %v", err))
+		}
+	}()
+
+	// 稽核紀錄預設寫本機 JSONL（含輪替），AUDIT_STORE=redis 時改寫 Redis stream
+	if getenv("AUDIT_STORE", "file") == "redis" {
+		maxLen, _ := strconv.ParseInt(getenv("AUDIT_STREAM_MAXLEN", "100000"), 10, 64)
+		audit.Init(audit.NewStreamStore(cache.Client(), "audit:log", maxLen))
+	} else {
+		maxMB, _ := strconv.Atoi(getenv("AUDIT_MAX_SIZE_MB", "10"))
+		backups, _ := strconv.Atoi(getenv("AUDIT_MAX_BACKUPS", "5"))
+		if astore, err := audit.NewFileStore(getenv("AUDIT_FILE", "data/audit.jsonl"), int64(maxMB)<<20, backups); err != nil {
+			logger.Error(fmt.Sprintf("failed to open audit log: %v", err))
+		} else {
+			audit.Init(astore)
+		}
+	}
+	// 關機時等背景 writer 寫完剩下的紀錄；在 cache.Close 之前執行
+	defer audit.Close()
+
+	// node 資訊由 informer 持續更新，改變時清除 /os 的快取
+	kubernetes.OnChange(func(_, cur *kubernetes.Node) {
+		if err := cache.Del(context.Background(), handler.OSInfoCacheKey); err != nil {
+			logger.Warn(fmt.Sprintf("Cache invalidate failed for key=%s: %v", handler.OSInfoCacheKey, err))
+		}
+	})
+	if err := kubernetes.Start(ctx, kcfg); err != nil {
+		logger.Warn(fmt.Sprintf("Node info unavailable: %v", err))
+	}
+
+	// 重要狀態改變送成 Kubernetes Event，叢集外只寫 log
+	if err := kubernetes.StartEvents(ctx); err != nil && !errors.Is(err, kubernetes.ErrNoClient) {
+		logger.Warn(fmt.Sprintf("Kubernetes events disabled: %v", err))
+	}
+	i2cdevice.OnAvailabilityChange(func(up bool, err error) {
+		if up {
+			kubernetes.Eventf(kubernetes.EventNormal, kubernetes.ReasonDeviceAvailable, "I2C device available again")
+			return
+		}
+		kubernetes.Eventf(kubernetes.EventWarning, kubernetes.ReasonDeviceUnavailable, "I2C device unavailable: %v", err)
+	})
+	// 執行期設定（log level、快取 TTL、限流）可由 ConfigMap / Secret 即時更新，
+	// 不合法的更新整份拒絕並送出 ConfigRejected event
+	config.OnChange(func(old, cur config.Runtime) {
+		logger.SetLevel(cur.LogLevel)
+		logger.Info(fmt.Sprintf("runtime config updated: %+v", cur))
+	})
+	if src := kubernetes.ConfigSourceFromEnv(); src.Enabled() {
+		src.SecretKeys = config.IsKey
+		err := kubernetes.WatchConfig(ctx, src, func(data map[string]string) error {
+			_, err := config.Apply(data)
+			return err
+		})
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Config watch disabled: %v", err))
+		}
+	}
+
+	cache.Watch(ctx, 10*time.Second, func(up bool, err error) {
+		if up {
+			logger.Info("Redis available again")
+			kubernetes.Eventf(kubernetes.EventNormal, kubernetes.ReasonCacheRecovered, "Redis cache available again")
+			return
+		}
+		logger.Error(fmt.Sprintf("Redis unavailable, serving without cache: %v", err))
+		kubernetes.Eventf(kubernetes.EventWarning, kubernetes.ReasonCacheDegraded, "Redis cache unavailable: %v", err)
+	})
+
+	i2cdevice.StartReconciler(ctx)
+	i2cdevice.StartSampler(ctx)
+
+	// 排程預設存在 Redis，SCHEDULE_STORE=file 時改存本機檔案
+	var store scheduler.Store = scheduler.NewRedisStore(cache, "sched:items")
+	if getenv("SCHEDULE_STORE", "redis") == "file" {
+		store = scheduler.NewFileStore(getenv("SCHEDULE_FILE", "data/schedules.json"))
+	}
+	if err := scheduler.Init(ctx, store); err != nil {
+		logger.Error(fmt.Sprintf("failed to init scheduler: %v", err))
 	} else {
-		defer func() {
-			sctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-			if err := shutdown(sctx); err != nil {
-				logger.Error(fmt.Sprintf("otel shutdown error: %v", err))
+		// 多副本共用排程時只有 leader 觸發，失去 leadership 時 ctx 取消、迴圈停止
+		kubernetes.OnStartedLeading(scheduler.Start)
+	}
+
+	// 叢集內以 Lease 選出 leader，叢集外退回本機鎖檔；LEADER_ELECTION=off 時永遠是 leader
+	// 選舉無法啟動時（鎖檔打不開、backend 設錯）自己當 leader，寧可多副本重複觸發也不要排程全部停擺
+	if err := kubernetes.StartLeaderElection(ctx, kubernetes.LeaderConfigFromEnv()); err != nil {
+		logger.Error(fmt.Sprintf("failed to start leader election, running as leader: %v", err))
+		kubernetes.Eventf(kubernetes.EventWarning, kubernetes.ReasonLeaderFallback, "Leader election unavailable, running as leader without election: %v", err)
+		_ = kubernetes.StartLeaderElection(ctx, kubernetes.LeaderConfig{Backend: kubernetes.LeaderBackendOff})
+	}
+
+	// MQTT_BROKER 有設定時才啟用 MQTT bridge
+	if mcfg := mqttbridge.ConfigFromEnv(); mcfg.Broker != "" {
+		if dev, ok := i2cdevice.NewBridge(); ok {
+			if _, err := mqttbridge.Start(ctx, mcfg, dev); err != nil {
+				logger.Error(fmt.Sprintf("failed to start MQTT bridge: %v", err))
 			}
-		}()
+		} else {
+			logger.Info("Skipping MQTT bridge (I2C device not found)")
+		}
 	}
 
 	r := server.NewRouter(deps.Deps{Cache: cache})